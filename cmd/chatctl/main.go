@@ -0,0 +1,304 @@
+// chatctl - административные команды, которые выполняются без запуска сервера
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/auth"
+	"realtime_chat_platform/internal/blobgc"
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/media"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/password"
+	"realtime_chat_platform/internal/quota"
+	"realtime_chat_platform/internal/storage"
+
+	"gorm.io/gorm"
+)
+
+// прежние адреса аватаров: статика из web/static/uploads и открытый маршрут /uploads/avatars
+var legacyAvatarURLPrefixes = []string{"/static/uploads/avatars/", "/uploads/avatars/"}
+
+var commands = map[string]func(args []string) error{
+	"migrate-storage":  migrateStorage,
+	"regen-thumbnails": regenThumbnails,
+	"gc-storage":       gcStorage,
+	"recalc-usage":     recalcUsage,
+	"create-owner":     createOwner,
+	"link-identity":    linkIdentity,
+}
+
+func main() {
+	if len(os.Args) < 2 || commands[os.Args[1]] == nil {
+		fmt.Fprintln(os.Stderr, "usage: chatctl <command> [flags]")
+		fmt.Fprintln(os.Stderr, "commands:")
+		fmt.Fprintln(os.Stderr, "  migrate-storage   copy stored files between storage backends")
+		fmt.Fprintln(os.Stderr, "  regen-thumbnails  rebuild thumbnails, dimensions and blurhash of attachments")
+		fmt.Fprintln(os.Stderr, "  gc-storage        delete stored files no longer referenced by avatars or attachments")
+		fmt.Fprintln(os.Stderr, "  recalc-usage      recompute storage usage of users and rooms from stored files")
+		fmt.Fprintln(os.Stderr, "  create-owner      create an owner account or promote an existing user to owner")
+		fmt.Fprintln(os.Stderr, "  link-identity     link an LDAP entry or SSO subject to an existing account")
+		os.Exit(2)
+	}
+
+	if err := commands[os.Args[1]](os.Args[2:]); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// копирует файлы между хранилищами, например при переходе с локального диска на S3
+func migrateStorage(args []string) error {
+	flags := flag.NewFlagSet("migrate-storage", flag.ExitOnError)
+	from := flags.String("from", "local", "source backend: local or s3")
+	to := flags.String("to", config.StorageBackend, "destination backend: local or s3")
+	fromDir := flags.String("from-dir", "", "read from this directory instead of the source backend, e.g. web/static/uploads")
+	toDir := flags.String("to-dir", "", "write to this directory instead of the destination backend")
+	prefix := flags.String("prefix", "", "copy only keys with this prefix, e.g. avatars/")
+	dryRun := flags.Bool("dry-run", false, "only report what would be copied")
+	rewriteAvatars := flags.Bool("rewrite-avatars", false, "point avatar URLs under "+strings.Join(legacyAvatarURLPrefixes, " or ")+" to the signed download route")
+	flags.Parse(args)
+
+	source, err := openStore(*from, *fromDir)
+	if err != nil {
+		return err
+	}
+	destination, err := openStore(*to, *toDir)
+	if err != nil {
+		return err
+	}
+
+	copied, bytes, err := storage.Copy(source, destination, *prefix, *dryRun, func(info storage.BlobInfo, copied bool) {
+		if copied {
+			log.Printf("copy %s (%d bytes)", info.Key, info.Size)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("%d files, %d bytes copied (dry run: %t)", copied, bytes, *dryRun)
+
+	if *rewriteAvatars && !*dryRun {
+		database.InitDB()
+		for _, prefix := range legacyAvatarURLPrefixes {
+			result := database.DB.Model(&models.User{}).
+				Where("avatar LIKE ?", prefix+"%").
+				UpdateColumn("avatar", gorm.Expr("? || SUBSTR(avatar, ?)", models.AvatarURLPrefix, len(prefix)+1))
+			if result.Error != nil {
+				return result.Error
+			}
+			log.Printf("%d avatar URLs under %s updated", result.RowsAffected, prefix)
+		}
+	}
+	return nil
+}
+
+// заново строит превью вложений: по умолчанию только не обработанных и с ошибкой
+func regenThumbnails(args []string) error {
+	flags := flag.NewFlagSet("regen-thumbnails", flag.ExitOnError)
+	id := flags.Uint("id", 0, "process only the attachment with this ID")
+	all := flags.Bool("all", false, "also rebuild attachments that were processed successfully")
+	flags.Parse(args)
+
+	database.InitDB()
+	if err := storage.Init(); err != nil {
+		return err
+	}
+
+	query := database.DB.Model(&models.Attachment{}).Where("content_type LIKE ? OR content_type LIKE ?", "image/%", "video/%").
+		Where("scan_status NOT IN ?", []string{models.ScanPending, models.ScanFailed})
+	if *id != 0 {
+		query = query.Where("id = ?", *id)
+	} else if !*all {
+		query = query.Where("media_status <> ?", models.MediaReady)
+	}
+	var attachments []models.Attachment
+	if err := query.Order("id").Find(&attachments).Error; err != nil {
+		return err
+	}
+
+	failed := 0
+	for i := range attachments {
+		attachment := &attachments[i]
+		if err := media.Process(attachment); err != nil {
+			failed++
+			log.Printf("attachment %d: %v", attachment.ID, err)
+			continue
+		}
+		log.Printf("attachment %d: %dx%d %s", attachment.ID, attachment.Width, attachment.Height, attachment.Blurhash)
+	}
+	log.Printf("%d attachments processed, %d failed", len(attachments)-failed, failed)
+	return nil
+}
+
+// удаляет файлы без ссылок из хранилища, не дожидаясь фоновой очистки
+func gcStorage(args []string) error {
+	flags := flag.NewFlagSet("gc-storage", flag.ExitOnError)
+	grace := flags.Duration("grace", config.BlobGCGrace, "keep unreferenced files younger than this")
+	dryRun := flags.Bool("dry-run", false, "only report what would be deleted")
+	flags.Parse(args)
+
+	database.InitDB()
+	if err := storage.Init(); err != nil {
+		return err
+	}
+
+	report, err := blobgc.Collect(storage.Store, *grace, *dryRun, func(info storage.BlobInfo) {
+		log.Printf("delete %s (%d bytes, modified %s)", info.Key, info.Size, info.ModTime.Format(time.RFC3339))
+	})
+	if err != nil {
+		return err
+	}
+	log.Printf("%d of %d files deleted, %d bytes reclaimed (dry run: %t)", report.Deleted, report.Scanned, report.ReclaimedBytes, *dryRun)
+	return nil
+}
+
+// пересчитывает счетчики занятого места; нужен после обновления и если счетчики разошлись с данными
+func recalcUsage(args []string) error {
+	flags := flag.NewFlagSet("recalc-usage", flag.ExitOnError)
+	flags.Parse(args)
+
+	database.InitDB()
+	if err := quota.Recalculate(); err != nil {
+		return err
+	}
+	log.Printf("storage usage recalculated")
+	return nil
+}
+
+// назначает владельца сервера. Через API роль может выдать только тот, у кого она уже есть,
+// поэтому первый владелец создается здесь, с доступом к серверу, а не по имени из конфигурации.
+// Новый пользователь получает пароль из стандартного ввода
+func createOwner(args []string) error {
+	flags := flag.NewFlagSet("create-owner", flag.ExitOnError)
+	username := flags.String("username", "", "account to create or promote")
+	flags.Parse(args)
+	if *username == "" {
+		return fmt.Errorf("-username is required")
+	}
+
+	database.InitDB()
+
+	var user models.User
+	err := database.DB.Where("username = ?", *username).First(&user).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		fmt.Fprint(os.Stderr, "password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return fmt.Errorf("read password: %w", err)
+		}
+		plain := strings.TrimRight(line, "\r\n")
+		if err := password.DefaultPolicy.Validate(plain); err != nil {
+			return err
+		}
+		hash, err := password.Hash(plain)
+		if err != nil {
+			return err
+		}
+
+		user = models.User{
+			Username:   *username,
+			Password:   hash,
+			Role:       models.RoleOwner,
+			Status:     models.UserStatusActive,
+			LastActive: time.Now(),
+		}
+		if err := database.DB.Create(&user).Error; err != nil {
+			return err
+		}
+		audit.RecordSystem(audit.Event{
+			Action:     models.AuditRoleChange,
+			TargetType: "user",
+			TargetID:   user.ID,
+			Changes:    audit.Changes{"role": {Before: nil, After: models.RoleOwner}},
+			Details:    "created by chatctl create-owner",
+		})
+		log.Printf("owner %s created", user.Username)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if user.Role == models.RoleOwner && user.Status == models.UserStatusActive {
+		log.Printf("%s is already an owner", user.Username)
+		return nil
+	}
+
+	// ожидающий одобрения пользователь активируется: одобрять заявки на пустом сервере некому
+	previous := user.Role
+	err = database.DB.Model(&user).Updates(map[string]interface{}{
+		"role":   models.RoleOwner,
+		"status": models.UserStatusActive,
+	}).Error
+	if err != nil {
+		return err
+	}
+	audit.RecordSystem(audit.Event{
+		Action:     models.AuditRoleChange,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    audit.Changes{"role": {Before: previous, After: models.RoleOwner}},
+		Details:    "promoted by chatctl create-owner",
+	})
+	log.Printf("%s is now an owner", user.Username)
+	return nil
+}
+
+// связывает существующую учетную запись с записью каталога или субъектом SSO.
+// Вход через LDAP и SSO сам не присваивает одноименные локальные учетные записи,
+// поэтому связь подтверждает администратор. Локальный пароль при этом сохраняется
+func linkIdentity(args []string) error {
+	flags := flag.NewFlagSet("link-identity", flag.ExitOnError)
+	username := flags.String("username", "", "local account to link")
+	provider := flags.String("provider", auth.LDAPProvider, "ldap or the OIDC issuer URL")
+	subject := flags.String("subject", "", "directory entry DN for ldap, sub claim for OIDC")
+	flags.Parse(args)
+	if *username == "" || *subject == "" {
+		return fmt.Errorf("-username and -subject are required")
+	}
+	// DN записей каталога хранятся в нижнем регистре
+	if *provider == auth.LDAPProvider {
+		*subject = strings.ToLower(*subject)
+	}
+
+	database.InitDB()
+
+	var user models.User
+	if err := database.DB.Where("username = ?", *username).First(&user).Error; err != nil {
+		return fmt.Errorf("user %s: %w", *username, err)
+	}
+
+	var existing models.Identity
+	if err := database.DB.Where("provider = ? AND subject = ?", *provider, *subject).First(&existing).Error; err == nil {
+		return fmt.Errorf("%s %s is already linked to user %d", *provider, *subject, existing.UserID)
+	}
+
+	identity := models.Identity{UserID: user.ID, Provider: *provider, Subject: *subject}
+	if err := database.DB.Create(&identity).Error; err != nil {
+		return err
+	}
+	audit.RecordSystem(audit.Event{
+		Action:     models.AuditIdentityLink,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Details:    fmt.Sprintf("%s %s linked by chatctl link-identity", *provider, *subject),
+	})
+	log.Printf("%s linked to %s %s", user.Username, *provider, *subject)
+	return nil
+}
+
+func openStore(backend, dir string) (storage.BlobStore, error) {
+	if dir != "" {
+		return storage.NewLocal(dir), nil
+	}
+	return storage.New(backend)
+}
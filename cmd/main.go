@@ -4,9 +4,19 @@ import (
 	"log"
 	"net/http"
 
+	"realtime_chat_platform/internal/automod"
+	"realtime_chat_platform/internal/blobgc"
+	"realtime_chat_platform/internal/config"
 	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/fileurl"
 	"realtime_chat_platform/internal/handlers"
+	"realtime_chat_platform/internal/media"
 	"realtime_chat_platform/internal/middleware"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/quarantine"
+	"realtime_chat_platform/internal/rbac"
+	"realtime_chat_platform/internal/scanner"
+	"realtime_chat_platform/internal/storage"
 	"realtime_chat_platform/internal/websocket"
 
 	"github.com/gin-gonic/gin"
@@ -16,13 +26,53 @@ func main() {
 	// инициализация базы данных
 	database.InitDB()
 
+	// ключ подписи ссылок на файлы
+	if err := fileurl.Init(); err != nil {
+		log.Fatal("Failed to initialize file URL signing:", err)
+	}
+
+	// подключение хранилища файлов
+	if err := storage.Init(); err != nil {
+		log.Fatal("Failed to initialize storage:", err)
+	}
+
+	// проверка загрузок на вредоносное содержимое
+	if err := scanner.Init(); err != nil {
+		log.Fatal("Failed to initialize scanner:", err)
+	}
+	quarantine.Start(config.ScanWorkers)
+
+	// фоновая обработка превью вложений
+	media.Start(config.MediaWorkers)
+
+	// удаление файлов, на которые больше нет ссылок
+	blobgc.Start(config.BlobGCInterval, config.BlobGCGrace)
+
+	// загрузка правил автомодерации
+	if err := automod.Reload(); err != nil {
+		log.Fatal("Failed to load automod rules:", err)
+	}
+
 	// запуск WebSocket хаба
 	go websocket.GlobalHub.Run()
 
 	r := gin.Default()
 
+	// адрес клиента для журнала аудита и токенов берется из X-Forwarded-For только от своих прокси
+	if err := r.SetTrustedProxies(config.TrustedProxies); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES:", err)
+	}
+
 	// сервер статических файлов
-	r.Static("/static", "./web/static")
+	r.StaticFS("/static", handlers.StaticDir("./web/static"))
+
+	// загруженные файлы отдаются только по подписанным ссылкам
+	files := r.Group("/files", middleware.RequireSignedURL())
+	{
+		files.GET("/avatars/:name", handlers.ServeAvatarHandler)
+		files.GET("/attachments/:id", handlers.DownloadAttachmentHandler)
+		files.GET("/attachments/:id/thumbnail", handlers.DownloadThumbnailHandler)
+	}
 	r.LoadHTMLGlob("web/templates/*")
 
 	// маршруты
@@ -43,8 +93,18 @@ func main() {
 	{
 		api.POST("/register", handlers.RegisterHandler)
 		api.POST("/login", handlers.LoginHandler)
-		api.GET("/messages", handlers.GetMessageHistory)
-		api.GET("/users/online", handlers.GetOnlineUsers)
+		api.GET("/verify-email", handlers.VerifyEmailHandler)
+		api.GET("/auth/providers", handlers.AuthProvidersHandler)
+		api.GET("/auth/oidc/login", handlers.OIDCLoginHandler)
+		api.GET("/auth/oidc/callback", handlers.OIDCCallbackHandler)
+		api.POST("/auth/passkey/login/begin", handlers.BeginPasskeyLoginHandler)
+		api.POST("/auth/passkey/login/finish", handlers.FinishPasskeyLoginHandler)
+		api.GET("/roles", handlers.ListRolesHandler)
+		api.GET("/messages", middleware.OptionalAuth(), handlers.GetMessageHistory)
+		api.POST("/messages/:id/report", middleware.AuthMiddleware(), middleware.RequireScope(models.ScopeMessagesWrite), handlers.ReportMessageHandler)
+		api.POST("/attachments", middleware.AuthMiddleware(), middleware.RequireScope(models.ScopeMessagesWrite), middleware.RequireVerifiedEmail(), handlers.UploadAttachmentHandler)
+		api.DELETE("/attachments/:id", middleware.AuthMiddleware(), middleware.RequireScope(models.ScopeMessagesWrite), handlers.DeleteAttachmentHandler)
+		api.GET("/users/online", middleware.OptionalAuth(), handlers.GetOnlineUsers)
 		api.GET("/ws", func(c *gin.Context) {
 			websocket.WebSocketHandler(c.Writer, c.Request)
 		})
@@ -53,14 +113,86 @@ func main() {
 		profile := api.Group("/profile")
 		profile.Use(middleware.AuthMiddleware())
 		{
-			profile.GET("/", handlers.GetProfileHandler)
-			profile.PUT("/", handlers.UpdateProfileHandler)
-			profile.PUT("/password", handlers.ChangePasswordHandler)
-			profile.POST("/avatar", handlers.UploadAvatarHandler)
+			profile.GET("/", middleware.RequireScope(models.ScopeProfileRead), handlers.GetProfileHandler)
+			profile.PUT("/", middleware.RequireScope(models.ScopeProfileWrite), handlers.UpdateProfileHandler)
+			profile.POST("/avatar", middleware.RequireScope(models.ScopeProfileWrite), middleware.RequireVerifiedEmail(), handlers.UploadAvatarHandler)
+			profile.GET("/usage", middleware.RequireScope(models.ScopeProfileRead), handlers.GetStorageUsageHandler)
+		}
+
+		// управление учетной записью доступно только при интерактивном входе
+		account := profile.Group("")
+		account.Use(middleware.RequireSession())
+		{
+			account.PUT("/password", handlers.ChangePasswordHandler)
+			account.PUT("/email", handlers.ChangeEmailHandler)
+			account.POST("/email/resend", handlers.ResendVerificationHandler)
+			account.GET("/passkeys", handlers.ListPasskeysHandler)
+			account.POST("/passkeys/register/begin", handlers.BeginPasskeyRegistrationHandler)
+			account.POST("/passkeys/register/finish", handlers.FinishPasskeyRegistrationHandler)
+			account.PUT("/passkeys/:id", handlers.RenamePasskeyHandler)
+			account.DELETE("/passkeys/:id", handlers.DeletePasskeyHandler)
+			account.GET("/tokens", handlers.ListAPITokensHandler)
+			account.POST("/tokens", handlers.CreateAPITokenHandler)
+			account.DELETE("/tokens/:id", handlers.DeleteAPITokenHandler)
+		}
+
+		// маршруты администрирования
+		admin := api.Group("/admin")
+		admin.Use(middleware.AuthMiddleware(), middleware.RequireSession(), middleware.RequireAdmin())
+		{
+			admin.GET("/invites", middleware.RequirePermission(rbac.InvitesManage), handlers.ListInvitesHandler)
+			admin.POST("/invites", middleware.RequirePermission(rbac.InvitesManage), handlers.CreateInviteHandler)
+			admin.DELETE("/invites/:id", middleware.RequirePermission(rbac.InvitesManage), handlers.RevokeInviteHandler)
+			admin.GET("/users/pending", middleware.RequirePermission(rbac.UsersApprove), handlers.ListPendingUsersHandler)
+			admin.POST("/users/:id/approve", middleware.RequirePermission(rbac.UsersApprove), handlers.ApproveUserHandler)
+			admin.POST("/users/:id/reject", middleware.RequirePermission(rbac.UsersApprove), handlers.RejectUserHandler)
+			admin.PUT("/users/:id/role", middleware.RequirePermission(rbac.RolesAssign), handlers.SetUserRoleHandler)
+			admin.GET("/audit", middleware.RequirePermission(rbac.AuditRead), handlers.ListAuditHandler)
+			admin.GET("/automod/rules", middleware.RequirePermission(rbac.AutomodManage), handlers.ListAutomodRulesHandler)
+			admin.POST("/automod/rules", middleware.RequirePermission(rbac.AutomodManage), handlers.CreateAutomodRuleHandler)
+			admin.PUT("/automod/rules/:id", middleware.RequirePermission(rbac.AutomodManage), handlers.UpdateAutomodRuleHandler)
+			admin.DELETE("/automod/rules/:id", middleware.RequirePermission(rbac.AutomodManage), handlers.DeleteAutomodRuleHandler)
+			admin.POST("/automod/reload", middleware.RequirePermission(rbac.AutomodManage), handlers.ReloadAutomodHandler)
+			admin.POST("/automod/test", middleware.RequirePermission(rbac.AutomodManage), handlers.TestAutomodHandler)
+			admin.GET("/storage/top", middleware.RequirePermission(rbac.StorageManage), handlers.ListStorageConsumersHandler)
+			admin.PUT("/users/:id/quota", middleware.RequirePermission(rbac.StorageManage), handlers.SetUserQuotaHandler)
+			admin.PUT("/rooms/:id/quota", middleware.RequirePermission(rbac.StorageManage), handlers.SetRoomQuotaHandler)
+		}
+
+		// маршруты модерации
+		moderation := api.Group("/moderation")
+		moderation.Use(middleware.AuthMiddleware(), middleware.RequireSession(), middleware.RequirePermission(rbac.UsersModerate))
+		{
+			moderation.GET("/actions", handlers.ListModerationActionsHandler)
+			moderation.POST("/users/:id/ban", handlers.BanUserHandler)
+			moderation.DELETE("/users/:id/ban", handlers.UnbanUserHandler)
+			moderation.POST("/users/:id/mute", handlers.MuteUserHandler)
+			moderation.DELETE("/users/:id/mute", handlers.UnmuteUserHandler)
+			moderation.POST("/users/:id/kick", handlers.KickUserHandler)
+			moderation.POST("/users/:id/shadowban", handlers.ShadowBanUserHandler)
+			moderation.DELETE("/users/:id/shadowban", handlers.UnshadowBanUserHandler)
+			moderation.GET("/raid-mode", handlers.GetRaidModeHandler)
+			moderation.PUT("/raid-mode", handlers.SetRaidModeHandler)
+			moderation.GET("/reports", handlers.ListReportsHandler)
+			moderation.GET("/reports/:id", handlers.GetReportHandler)
+			moderation.POST("/reports/:id/resolve", handlers.ResolveReportHandler)
+		}
+
+		// маршруты комнат
+		rooms := api.Group("/rooms")
+		rooms.Use(middleware.AuthMiddleware())
+		{
+			rooms.GET("", handlers.ListRoomsHandler)
+			rooms.POST("", middleware.RequireSession(), middleware.RequirePermission(rbac.RoomsCreate), handlers.CreateRoomHandler)
+			rooms.GET("/:id/members", handlers.ListRoomMembersHandler)
+			rooms.GET("/:id/limits", handlers.GetRoomLimitsHandler)
+			rooms.PUT("/:id/settings", middleware.RequireSession(), middleware.RequireRoomPermission(rbac.RoomsManage), handlers.UpdateRoomSettingsHandler)
+			rooms.PUT("/:id/members/:user_id/role", middleware.RequireSession(), middleware.RequireRoomPermission(rbac.RolesAssign), handlers.SetRoomMemberRoleHandler)
 		}
 
 		// маршрут публичного профиля пользователя
-		api.GET("/users/:username/profile", handlers.GetUserProfileHandler)
+		api.GET("/users/:username/profile", middleware.OptionalAuth(), handlers.GetUserProfileHandler)
+		api.GET("/users/:username/avatar.svg", handlers.DefaultAvatarHandler)
 	}
 
 	log.Println("Server starting on :8080")
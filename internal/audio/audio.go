@@ -0,0 +1,192 @@
+// Package audio проверяет записи голосовых сообщений: Opus в контейнере Ogg или WebM.
+// Контейнер разбирается без декодирования звука: длительность считается по заголовкам
+// пакетов Opus, а форма волны - по их размерам
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// WaveformSamples - число столбцов формы волны
+const WaveformSamples = 64
+
+// частота, в которой Opus считает длительность и pre-skip
+const opusSampleRate = 48000
+
+// ErrUnsupported - файл не является записью Opus в Ogg или WebM
+var ErrUnsupported = errors.New("voice messages must be Opus audio in an Ogg or WebM container")
+
+// InvalidError - контейнер или пакеты записи повреждены
+type InvalidError struct {
+	Reason string
+}
+
+func (e *InvalidError) Error() string {
+	return "invalid voice recording: " + e.Reason
+}
+
+func invalid(reason string) error {
+	return &InvalidError{Reason: reason}
+}
+
+// Info - результат проверки записи
+type Info struct {
+	ContentType string // audio/ogg или audio/webm
+	Duration    time.Duration
+	// громкость по времени, значения от 0 до 100
+	Waveform []int
+}
+
+// пакет Opus: длительность в отсчетах 48 кГц и размер в байтах
+type packet struct {
+	samples int
+	size    int
+}
+
+// поток Opus, извлеченный из контейнера
+type opusStream struct {
+	preSkip int
+	packets []packet
+	// позиция последней страницы Ogg с учетом обрезки конца; -1, если ее нет
+	granule int64
+}
+
+// Probe проверяет контейнер и кодек записи и возвращает ее длительность и форму волны
+func Probe(data []byte) (*Info, error) {
+	var (
+		stream      *opusStream
+		contentType string
+		err         error
+	)
+	switch {
+	case bytes.HasPrefix(data, []byte("OggS")):
+		contentType = "audio/ogg"
+		stream, err = parseOgg(data)
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		contentType = "audio/webm"
+		stream, err = parseWebM(data)
+	default:
+		return nil, ErrUnsupported
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(stream.packets) == 0 {
+		return nil, invalid("no audio")
+	}
+
+	total := 0
+	for _, p := range stream.packets {
+		total += p.samples
+	}
+	// в Ogg конец записи задает позиция последней страницы, в WebM - сумма пакетов.
+	// Позиция может только обрезать конец: больше пакетов, чем есть, она не добавит
+	samples := int64(total)
+	if stream.granule >= 0 {
+		samples = min(stream.granule, samples)
+	}
+	samples = max(samples-int64(stream.preSkip), 0)
+
+	return &Info{
+		ContentType: contentType,
+		Duration:    time.Duration(samples) * time.Second / opusSampleRate,
+		Waveform:    waveform(stream.packets, total),
+	}, nil
+}
+
+// разбирает заголовок OpusHead и возвращает pre-skip - число отсчетов в начале, которые не воспроизводятся
+func parseOpusHead(head []byte) (int, error) {
+	if len(head) < 19 || !bytes.HasPrefix(head, []byte("OpusHead")) {
+		return 0, ErrUnsupported
+	}
+	if head[8]>>4 != 0 {
+		return 0, invalid(fmt.Sprintf("unsupported Opus version %d", head[8]))
+	}
+	if head[9] == 0 {
+		return 0, invalid("no audio channels")
+	}
+	return int(binary.LittleEndian.Uint16(head[10:12])), nil
+}
+
+// длительность пакета Opus по байту TOC (RFC 6716, раздел 3.1)
+func opusSamples(data []byte) (int, error) {
+	// пустой пакет обозначает потерю и не воспроизводится
+	if len(data) == 0 {
+		return 0, nil
+	}
+
+	config := data[0] >> 3
+	var frame int
+	switch {
+	case config < 12: // SILK: 10, 20, 40, 60 мс
+		frame = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16: // гибридный режим: 10, 20 мс
+		frame = []int{480, 960}[config%2]
+	default: // CELT: 2.5, 5, 10, 20 мс
+		frame = []int{120, 240, 480, 960}[config%4]
+	}
+
+	frames := 1
+	switch data[0] & 3 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(data) < 2 || data[1]&0x3F == 0 {
+			return 0, invalid("malformed Opus packet")
+		}
+		frames = int(data[1] & 0x3F)
+	}
+	// пакет не длиннее 120 мс
+	if frame*frames > 5760 {
+		return 0, invalid("malformed Opus packet")
+	}
+	return frame * frames, nil
+}
+
+// строит форму волны по битрейту пакетов: кодер Opus с переменным битрейтом тратит
+// на громкие и насыщенные фрагменты больше байт, чем на тишину, поэтому размеры
+// пакетов повторяют огибающую громкости. Значения нормируются к 0..100
+func waveform(packets []packet, total int) []int {
+	n := min(WaveformSamples, len(packets))
+	if n == 0 || total == 0 {
+		return nil
+	}
+
+	size := make([]float64, n)
+	duration := make([]float64, n)
+	position := 0
+	for _, p := range packets {
+		i := min(position*n/total, n-1)
+		size[i] += float64(p.size)
+		duration[i] += float64(p.samples)
+		position += p.samples
+	}
+
+	rate := make([]float64, n)
+	low, high := math.Inf(1), 0.0
+	for i := range rate {
+		if duration[i] == 0 {
+			continue
+		}
+		rate[i] = size[i] / duration[i]
+		low, high = min(low, rate[i]), max(high, rate[i])
+	}
+
+	samples := make([]int, n)
+	for i := range samples {
+		if duration[i] == 0 {
+			continue
+		}
+		if high == low {
+			samples[i] = 100
+		} else {
+			samples[i] = int(math.Round((rate[i] - low) / (high - low) * 100))
+		}
+	}
+	return samples
+}
@@ -0,0 +1,230 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// заголовок OpusHead: версия 1, один канал, pre-skip 312
+func opusHead() []byte {
+	head := append([]byte("OpusHead"), 1, 1)
+	head = binary.LittleEndian.AppendUint16(head, 312)
+	head = binary.LittleEndian.AppendUint32(head, 48000)
+	return append(head, 0, 0, 0)
+}
+
+// пакет CELT 20 мс (960 отсчетов) заданного размера
+func opusPacket(size int) []byte {
+	packet := bytes.Repeat([]byte{0x55}, size)
+	packet[0] = 31 << 3
+	return packet
+}
+
+// пакеты записи длительностью count*20 мс с меняющимся размером
+func opusPackets(count int) [][]byte {
+	packets := make([][]byte, count)
+	for i := range packets {
+		packets[i] = opusPacket(20 + i%40)
+	}
+	return packets
+}
+
+// собирает страницу Ogg с правильной контрольной суммой
+func oggPage(headerType byte, granule int64, sequence uint32, packets ...[]byte) []byte {
+	var lacing, body []byte
+	for _, p := range packets {
+		for n := len(p); ; n -= 255 {
+			if n < 255 {
+				lacing = append(lacing, byte(n))
+				break
+			}
+			lacing = append(lacing, 255)
+		}
+		body = append(body, p...)
+	}
+
+	page := append([]byte("OggS"), 0, headerType)
+	page = binary.LittleEndian.AppendUint64(page, uint64(granule))
+	page = binary.LittleEndian.AppendUint32(page, 0x1234)
+	page = binary.LittleEndian.AppendUint32(page, sequence)
+	page = append(page, 0, 0, 0, 0, byte(len(lacing)))
+	page = append(append(page, lacing...), body...)
+	binary.LittleEndian.PutUint32(page[22:], oggCRC(page))
+	return page
+}
+
+// страницы заголовков OpusHead и OpusTags
+func oggHeaders() []byte {
+	data := oggPage(0x02, 0, 0, opusHead())
+	return append(data, oggPage(0, 0, 1, []byte("OpusTags\x00\x00\x00\x00\x00\x00\x00\x00"))...)
+}
+
+// запись Ogg Opus из count пакетов по 20 мс
+func oggRecording(count int) []byte {
+	return append(oggHeaders(), oggPage(0x04, int64(count*960), 2, opusPackets(count)...)...)
+}
+
+// элемент EBML с размером в 8 байт; size < 0 записывает неизвестный размер
+func ebml(id uint32, payload []byte, size int64) []byte {
+	var out []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	if size < 0 {
+		out = append(out, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF)
+	} else {
+		out = append(out, 0x01)
+		out = append(out, binary.BigEndian.AppendUint64(nil, uint64(size))[1:]...)
+	}
+	return append(out, payload...)
+}
+
+func element(id uint32, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	return ebml(id, body, int64(len(body)))
+}
+
+// запись WebM так, как ее пишет MediaRecorder: Segment и Cluster неизвестного размера
+func webmRecording(count int, trackType byte, codec string) []byte {
+	header := element(ebmlHeaderID, element(docTypeID, []byte("webm")))
+	tracks := element(tracksID, element(trackEntryID,
+		element(trackNumberID, []byte{1}),
+		element(trackTypeID, []byte{trackType}),
+		element(codecIDID, []byte(codec)),
+		element(codecPrivateID, opusHead()),
+	))
+
+	var blocks []byte
+	for _, p := range opusPackets(count) {
+		blocks = append(blocks, element(simpleBlockID, []byte{0x81, 0, 0, 0x80}, p)...)
+	}
+	cluster := ebml(clusterID, blocks, -1)
+	return append(header, ebml(segmentID, append(tracks, cluster...), -1)...)
+}
+
+func TestProbe(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+	}{
+		{"ogg", oggRecording(150), "audio/ogg"},
+		{"webm", webmRecording(150, 2, "A_OPUS"), "audio/webm"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Probe(tt.data)
+			if err != nil {
+				t.Fatalf("Probe: %v", err)
+			}
+			if info.ContentType != tt.contentType {
+				t.Errorf("content type = %s, want %s", info.ContentType, tt.contentType)
+			}
+			// 150 пакетов по 20 мс без pre-skip
+			want := 3*time.Second - 312*time.Second/opusSampleRate
+			if info.Duration != want {
+				t.Errorf("duration = %v, want %v", info.Duration, want)
+			}
+			if len(info.Waveform) != WaveformSamples {
+				t.Fatalf("waveform has %d samples, want %d", len(info.Waveform), WaveformSamples)
+			}
+			for _, v := range info.Waveform {
+				if v < 0 || v > 100 {
+					t.Fatalf("waveform value %d out of range", v)
+				}
+			}
+		})
+	}
+}
+
+func TestProbeOggGranuleCannotExtendRecording(t *testing.T) {
+	data := append(oggHeaders(), oggPage(0x04, 1<<62, 2, opusPackets(10)...)...)
+
+	info, err := Probe(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Duration <= 0 || info.Duration > 200*time.Millisecond {
+		t.Fatalf("duration = %v, want at most the 200ms of packets", info.Duration)
+	}
+}
+
+func TestProbeRejectsMalformed(t *testing.T) {
+	ogg := oggRecording(5)
+	badCRC := bytes.Clone(ogg)
+	badCRC[len(badCRC)-1] ^= 0xFF
+
+	noStart := oggPage(0, 0, 0, opusHead())
+
+	laced := webmRecording(5, 2, "A_OPUS")
+	laced[bytes.LastIndex(laced, []byte{0x81, 0, 0, 0x80})+3] = 0x82
+
+	tests := []struct {
+		name        string
+		data        []byte
+		unsupported bool
+	}{
+		{"empty", nil, true},
+		{"not audio", []byte("RIFF....WAVEfmt "), true},
+		{"ogg truncated page header", ogg[:20], false},
+		{"ogg truncated body", ogg[:len(ogg)-3], false},
+		{"ogg checksum mismatch", badCRC, false},
+		{"ogg without stream start", noStart, false},
+		{"ogg headers only", oggHeaders(), false},
+		{"ogg without OpusTags", append(oggPage(0x02, 0, 0, opusHead()), oggPage(0, 0, 1, opusPacket(30))...), false},
+		{"ogg zero-frame packet", append(oggHeaders(), oggPage(0x04, 960, 2, []byte{31<<3 | 3, 0})...), false},
+		{"ogg not opus", oggPage(0x02, 0, 0, []byte("\x01vorbis\x00\x00\x00\x00\x02\x44\xac\x00\x00")), true},
+		{"webm header of unknown size", []byte{0x1A, 0x45, 0xDF, 0xA3, 0xFF, 0x42, 0x82, 0x84, 'w', 'e', 'b', 'm'}, false},
+		{"webm header only", []byte{0x1A, 0x45, 0xDF, 0xA3}, false},
+		{"webm truncated header", element(ebmlHeaderID, element(docTypeID, []byte("webm")))[:10], false},
+		{"webm matroska doctype", element(ebmlHeaderID, element(docTypeID, []byte("matroska"))), true},
+		{"webm with video", webmRecording(5, videoTrackType, "V_VP8"), true},
+		{"webm vorbis", webmRecording(5, 2, "A_VORBIS"), true},
+		{"webm laced block", laced, false},
+		{"webm leaf of unknown size", append(element(ebmlHeaderID, element(docTypeID, []byte("webm"))), ebml(codecIDID, nil, -1)...), false},
+		{"webm without audio", element(ebmlHeaderID, element(docTypeID, []byte("webm"))), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			info, err := Probe(tt.data)
+			if err == nil {
+				t.Fatalf("Probe accepted malformed input: %+v", info)
+			}
+			var invalidErr *InvalidError
+			if tt.unsupported && !errors.Is(err, ErrUnsupported) {
+				t.Fatalf("error = %v, want ErrUnsupported", err)
+			}
+			if !tt.unsupported && !errors.As(err, &invalidErr) {
+				t.Fatalf("error = %v, want InvalidError", err)
+			}
+		})
+	}
+}
+
+// обрезанная в любом месте запись не должна ронять разбор
+func TestProbeTruncated(t *testing.T) {
+	for _, data := range [][]byte{oggRecording(20), webmRecording(20, 2, "A_OPUS")} {
+		for n := range data {
+			Probe(data[:n])
+		}
+	}
+}
+
+func FuzzProbe(f *testing.F) {
+	f.Add(oggRecording(3))
+	f.Add(webmRecording(3, 2, "A_OPUS"))
+	f.Add([]byte{0x1A, 0x45, 0xDF, 0xA3, 0xFF})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		info, err := Probe(data)
+		if err == nil && (info.Duration < 0 || len(info.Waveform) > WaveformSamples) {
+			t.Fatalf("unexpected info %+v", info)
+		}
+	})
+}
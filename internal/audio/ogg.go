@@ -0,0 +1,130 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// таблица CRC страниц Ogg: полином 0x04c11db7 без отражения битов
+var oggCRCTable = func() (table [256]uint32) {
+	for i := range table {
+		r := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if r&0x80000000 != 0 {
+				r = r<<1 ^ 0x04c11db7
+			} else {
+				r <<= 1
+			}
+		}
+		table[i] = r
+	}
+	return table
+}()
+
+// разбирает страницы Ogg (RFC 3533) и собирает пакеты первого логического потока.
+// Первые два пакета потока Opus - заголовки OpusHead и OpusTags (RFC 7845)
+func parseOgg(data []byte) (*opusStream, error) {
+	stream := &opusStream{granule: -1}
+	var (
+		serial  uint32
+		started bool
+		headers int
+		partial []byte
+	)
+
+	for pos := 0; pos < len(data); {
+		if len(data)-pos < 27 || !bytes.HasPrefix(data[pos:], []byte("OggS")) {
+			return nil, invalid("truncated Ogg page")
+		}
+		if data[pos+4] != 0 {
+			return nil, invalid("unsupported Ogg version")
+		}
+		headerType := data[pos+5]
+		granule := int64(binary.LittleEndian.Uint64(data[pos+6:]))
+		pageSerial := binary.LittleEndian.Uint32(data[pos+14:])
+		segments := int(data[pos+26])
+
+		bodyStart := pos + 27 + segments
+		if bodyStart > len(data) {
+			return nil, invalid("truncated Ogg page")
+		}
+		lacing := data[pos+27 : bodyStart]
+		end := bodyStart
+		for _, l := range lacing {
+			end += int(l)
+		}
+		if end > len(data) {
+			return nil, invalid("truncated Ogg page")
+		}
+		if oggCRC(data[pos:end]) != binary.LittleEndian.Uint32(data[pos+22:]) {
+			return nil, invalid("Ogg page checksum mismatch")
+		}
+
+		if !started {
+			if headerType&0x02 == 0 {
+				return nil, invalid("missing Ogg stream start")
+			}
+			serial, started = pageSerial, true
+		}
+		// остальные логические потоки (например, видео) не нужны
+		if pageSerial != serial {
+			pos = end
+			continue
+		}
+
+		body := data[bodyStart:end]
+		for _, l := range lacing {
+			partial = append(partial, body[:l]...)
+			body = body[l:]
+			// сегмент короче 255 байт завершает пакет, иначе пакет продолжается
+			if l == 255 {
+				continue
+			}
+
+			switch headers {
+			case 0:
+				preSkip, err := parseOpusHead(partial)
+				if err != nil {
+					return nil, err
+				}
+				stream.preSkip = preSkip
+				headers++
+			case 1:
+				if !bytes.HasPrefix(partial, []byte("OpusTags")) {
+					return nil, invalid("missing OpusTags header")
+				}
+				headers++
+			default:
+				samples, err := opusSamples(partial)
+				if err != nil {
+					return nil, err
+				}
+				stream.packets = append(stream.packets, packet{samples: samples, size: len(partial)})
+			}
+			partial = partial[:0]
+		}
+
+		// -1 означает, что на странице не завершается ни один пакет
+		if headers == 2 && granule != -1 {
+			stream.granule = granule
+		}
+		pos = end
+	}
+
+	if headers < 2 {
+		return nil, ErrUnsupported
+	}
+	return stream, nil
+}
+
+// CRC страницы Ogg считается с обнуленным полем контрольной суммы
+func oggCRC(page []byte) uint32 {
+	var crc uint32
+	for i, b := range page {
+		if i >= 22 && i < 26 {
+			b = 0
+		}
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	return crc
+}
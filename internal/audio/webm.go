@@ -0,0 +1,224 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+	"strings"
+)
+
+// идентификаторы элементов EBML, которые нужны для извлечения пакетов Opus
+const (
+	ebmlHeaderID   = 0x1A45DFA3
+	docTypeID      = 0x4282
+	segmentID      = 0x18538067
+	tracksID       = 0x1654AE6B
+	trackEntryID   = 0xAE
+	trackNumberID  = 0xD7
+	trackTypeID    = 0x83
+	codecIDID      = 0x86
+	codecPrivateID = 0x63A2
+	clusterID      = 0x1F43B675
+	blockGroupID   = 0xA0
+	blockID        = 0xA1
+	simpleBlockID  = 0xA3
+)
+
+// тип дорожки Matroska для видео
+const videoTrackType = 1
+
+type webmTrack struct {
+	number    uint64
+	trackType uint64
+	codec     string
+	private   []byte
+}
+
+// разбирает WebM (Matroska) и собирает пакеты дорожки Opus. Элементы обходятся подряд:
+// в составные (Segment, Cluster, Tracks...) парсер заходит, остальные пропускает по размеру.
+// Так обрабатываются и записи MediaRecorder, у которых размер Segment и Cluster неизвестен
+func parseWebM(data []byte) (*opusStream, error) {
+	id, body, end, err := readElement(data, 0)
+	if err != nil || id != ebmlHeaderID {
+		return nil, invalid("missing EBML header")
+	}
+	if end < 0 {
+		return nil, invalid("EBML header of unknown size")
+	}
+	if docType, err := findString(data[body:end], docTypeID); err != nil || strings.TrimRight(docType, "\x00") != "webm" {
+		return nil, ErrUnsupported
+	}
+
+	stream := &opusStream{granule: -1}
+	var (
+		tracks []*webmTrack
+		opus   *webmTrack
+	)
+	for pos := end; pos < len(data); {
+		id, body, end, err := readElement(data, pos)
+		if err != nil {
+			return nil, err
+		}
+
+		switch id {
+		case segmentID, clusterID, tracksID, blockGroupID:
+			pos = body
+			continue
+		case trackEntryID:
+			tracks = append(tracks, &webmTrack{})
+			pos = body
+			continue
+		}
+		if end < 0 {
+			return nil, invalid(fmt.Sprintf("element %#x of unknown size", id))
+		}
+
+		value := data[body:end]
+		var track *webmTrack
+		if len(tracks) > 0 {
+			track = tracks[len(tracks)-1]
+		}
+		switch {
+		case id == trackNumberID && track != nil:
+			track.number = readUint(value)
+		case id == trackTypeID && track != nil:
+			track.trackType = readUint(value)
+		case id == codecIDID && track != nil:
+			track.codec = strings.TrimRight(string(value), "\x00")
+		case id == codecPrivateID && track != nil:
+			track.private = value
+		case id == simpleBlockID || id == blockID:
+			// дорожки описываются до первого кластера
+			if opus == nil {
+				if opus, err = opusTrack(tracks); err != nil {
+					return nil, err
+				}
+				if stream.preSkip, err = parseOpusHead(opus.private); err != nil {
+					return nil, err
+				}
+			}
+			frame, number, err := blockFrame(value)
+			if err != nil {
+				return nil, err
+			}
+			if number != opus.number {
+				break
+			}
+			samples, err := opusSamples(frame)
+			if err != nil {
+				return nil, err
+			}
+			stream.packets = append(stream.packets, packet{samples: samples, size: len(frame)})
+		}
+		pos = end
+	}
+
+	if opus == nil {
+		if _, err := opusTrack(tracks); err != nil {
+			return nil, err
+		}
+	}
+	return stream, nil
+}
+
+// выбирает дорожку Opus; запись с видео голосовым сообщением не считается
+func opusTrack(tracks []*webmTrack) (*webmTrack, error) {
+	var opus *webmTrack
+	for _, track := range tracks {
+		if track.trackType == videoTrackType {
+			return nil, ErrUnsupported
+		}
+		if track.codec == "A_OPUS" && opus == nil {
+			opus = track
+		}
+	}
+	if opus == nil {
+		return nil, ErrUnsupported
+	}
+	return opus, nil
+}
+
+// возвращает данные блока и номер его дорожки. Поддерживаются только блоки без лейсинга:
+// так Opus пишут MediaRecorder и ffmpeg
+func blockFrame(block []byte) ([]byte, uint64, error) {
+	number, n, err := readVint(block, false)
+	if err != nil || len(block) < n+3 {
+		return nil, 0, invalid("malformed block")
+	}
+	// за номером дорожки идут относительное время (2 байта) и флаги
+	if flags := block[n+2]; flags&0x06 != 0 {
+		return nil, 0, invalid("laced blocks are not supported")
+	}
+	return block[n+3:], number, nil
+}
+
+// читает заголовок элемента в позиции pos: идентификатор, начало и конец содержимого.
+// Для элемента неизвестного размера end равен -1
+func readElement(data []byte, pos int) (id uint64, body, end int, err error) {
+	id, n, err := readVint(data[pos:], true)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	size, m, err := readVint(data[pos+n:], false)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	body = pos + n + m
+	// все единицы в значении размера означают неизвестный размер
+	if size == 1<<(7*m)-1 {
+		return id, body, -1, nil
+	}
+	if size > uint64(len(data)-body) {
+		return 0, 0, 0, invalid(fmt.Sprintf("truncated element %#x", id))
+	}
+	return id, body, body + int(size), nil
+}
+
+// читает целое переменной длины EBML. Длина задается числом ведущих нулей первого байта;
+// у идентификаторов маркер длины остается частью значения, у размеров отбрасывается
+func readVint(data []byte, keepMarker bool) (uint64, int, error) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, invalid("malformed EBML")
+	}
+	length := bits.LeadingZeros8(data[0]) + 1
+	if len(data) < length {
+		return 0, 0, invalid("malformed EBML")
+	}
+
+	value := uint64(data[0])
+	if !keepMarker {
+		value &= 0xFF >> length
+	}
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+	}
+	return value, length, nil
+}
+
+func readUint(data []byte) uint64 {
+	if len(data) > 8 {
+		return 0
+	}
+	var buf [8]byte
+	copy(buf[8-len(data):], data)
+	return binary.BigEndian.Uint64(buf[:])
+}
+
+// ищет строковый элемент среди непосредственных потомков
+func findString(data []byte, target uint64) (string, error) {
+	for pos := 0; pos < len(data); {
+		id, body, end, err := readElement(data, pos)
+		if err != nil {
+			return "", err
+		}
+		if end < 0 {
+			return "", invalid(fmt.Sprintf("element %#x of unknown size", id))
+		}
+		if id == target {
+			return string(data[body:end]), nil
+		}
+		pos = end
+	}
+	return "", invalid(fmt.Sprintf("element %#x not found", target))
+}
@@ -0,0 +1,90 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Change - значение поля до и после изменения
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// Changes - изменения по полям
+type Changes map[string]Change
+
+// Event описывает одно событие для журнала
+type Event struct {
+	Action     string
+	TargetType string
+	TargetID   uint
+	Changes    Changes
+	Details    string
+}
+
+// Diff оставляет только поля, значения которых действительно изменились
+func Diff(before, after map[string]interface{}) Changes {
+	changes := Changes{}
+	for field, next := range after {
+		previous := before[field]
+		if !reflect.DeepEqual(previous, next) {
+			changes[field] = Change{Before: previous, After: next}
+		}
+	}
+	return changes
+}
+
+// Record пишет событие от имени текущего пользователя запроса с его IP
+func Record(c *gin.Context, event Event) {
+	actorID := c.GetUint("user_id")
+	write(actorID, c.ClientIP(), event)
+}
+
+// RecordAs пишет событие от имени указанного пользователя, например при входе, когда user_id еще не установлен
+func RecordAs(c *gin.Context, actorID uint, event Event) {
+	write(actorID, c.ClientIP(), event)
+}
+
+// RecordSystem пишет событие, инициированное сервером (автомодерация, фоновые задачи)
+func RecordSystem(event Event) {
+	write(0, "", event)
+}
+
+func write(actorID uint, ip string, event Event) {
+	entry := models.AuditEntry{
+		Action:     event.Action,
+		ActorID:    actorID,
+		TargetType: event.TargetType,
+		TargetID:   event.TargetID,
+		IP:         ip,
+		Details:    event.Details,
+	}
+
+	if actorID != 0 {
+		var actor models.User
+		if err := database.DB.Select("username").First(&actor, actorID).Error; err == nil {
+			entry.ActorUsername = actor.Username
+		}
+	}
+
+	if len(event.Changes) > 0 {
+		data, err := json.Marshal(event.Changes)
+		if err != nil {
+			data = []byte(fmt.Sprintf(`{"error":%q}`, err.Error()))
+		}
+		entry.Changes = data
+	}
+
+	// сбой записи аудита не должен ломать основное действие, но обязан попасть в лог
+	if err := database.DB.Create(&entry).Error; err != nil {
+		log.Printf("Error writing audit entry %s: %v", event.Action, err)
+	}
+}
@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"errors"
+	"log"
+	"strings"
+
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/models"
+)
+
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator проверяет логин и пароль в одном источнике учетных записей
+type Authenticator interface {
+	Name() string
+	// Authenticate возвращает локального пользователя при успешной проверке
+	Authenticate(username, password string) (*models.User, error)
+}
+
+// Backends опрашиваются по порядку из AUTH_BACKENDS до первого успеха
+var Backends = buildBackends(config.AuthBackends)
+
+func buildBackends(names []string) []Authenticator {
+	var backends []Authenticator
+	for _, name := range names {
+		switch strings.ToLower(name) {
+		case "local":
+			backends = append(backends, LocalAuthenticator{})
+		case "ldap":
+			backends = append(backends, NewLDAPAuthenticator())
+		default:
+			log.Printf("Unknown auth backend %q, skipping", name)
+		}
+	}
+
+	// без единого источника вход был бы невозможен
+	if len(backends) == 0 {
+		backends = append(backends, LocalAuthenticator{})
+	}
+	return backends
+}
+
+// проверяет учетные данные во всех источниках по очереди;
+// недоступный источник не мешает входу через следующий
+func Authenticate(username, password string) (*models.User, error) {
+	for _, backend := range Backends {
+		user, err := backend.Authenticate(username, password)
+		if err == nil {
+			return user, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			log.Printf("Auth backend %s failed: %v", backend.Name(), err)
+		}
+	}
+	return nil, ErrInvalidCredentials
+}
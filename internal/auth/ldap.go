@@ -0,0 +1,286 @@
+package auth
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/go-ldap/ldap/v3"
+	"gorm.io/gorm"
+)
+
+// LDAPProvider - значение Identity.Provider для пользователей из каталога
+const LDAPProvider = "ldap"
+
+// ErrIdentityConflict - имя из каталога занято локальной учетной записью, не связанной с ним
+var ErrIdentityConflict = errors.New("username belongs to an unlinked local account")
+
+// LDAPAuthenticator проверяет пароль bind'ом к LDAP/Active Directory
+// и синхронизирует имя, email и роль пользователя из каталога
+type LDAPAuthenticator struct {
+	URL                string
+	StartTLS           bool
+	InsecureSkipVerify bool
+	BindDN             string
+	BindPassword       string
+	UserBase           string
+	// фильтр поиска, %s заменяется экранированным именем пользователя
+	UserFilter      string
+	UsernameAttr    string
+	DisplayNameAttr string
+	EmailAttr       string
+	GroupAttr       string
+	RequiredGroup   string
+	GroupRoles      map[string]string
+	ConnectTimeout  time.Duration
+}
+
+func NewLDAPAuthenticator() *LDAPAuthenticator {
+	return &LDAPAuthenticator{
+		URL:                config.LDAPURL,
+		StartTLS:           config.LDAPStartTLS,
+		InsecureSkipVerify: config.LDAPInsecureSkipVerify,
+		BindDN:             config.LDAPBindDN,
+		BindPassword:       config.LDAPBindPassword,
+		UserBase:           config.LDAPUserBase,
+		UserFilter:         config.LDAPUserFilter,
+		UsernameAttr:       config.LDAPUsernameAttr,
+		DisplayNameAttr:    config.LDAPDisplayNameAttr,
+		EmailAttr:          config.LDAPEmailAttr,
+		GroupAttr:          config.LDAPGroupAttr,
+		RequiredGroup:      config.LDAPRequiredGroup,
+		GroupRoles:         parseGroupRoles(config.LDAPGroupRoles),
+		ConnectTimeout:     10 * time.Second,
+	}
+}
+
+// разбирает строку вида "admin:cn=chat-admins,ou=groups,dc=corp;moderator:cn=..."
+func parseGroupRoles(value string) map[string]string {
+	roles := make(map[string]string)
+	for _, entry := range strings.Split(value, ";") {
+		role, group, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found || group == "" {
+			continue
+		}
+		roles[strings.ToLower(strings.TrimSpace(group))] = strings.TrimSpace(role)
+	}
+	return roles
+}
+
+func (a *LDAPAuthenticator) Name() string {
+	return "ldap"
+}
+
+func (a *LDAPAuthenticator) Authenticate(username, password string) (*models.User, error) {
+	// пустой пароль означает анонимный bind, который сервер считает успешным
+	if username == "" || password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := a.connect()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := a.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+
+	groups := entry.GetAttributeValues(a.GroupAttr)
+	if a.RequiredGroup != "" && !containsFold(groups, a.RequiredGroup) {
+		log.Printf("LDAP user %s is not a member of %s", username, a.RequiredGroup)
+		return nil, ErrInvalidCredentials
+	}
+
+	return a.syncUser(entry, groups)
+}
+
+func (a *LDAPAuthenticator) connect() (*ldap.Conn, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: a.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(a.URL,
+		ldap.DialWithTLSConfig(tlsConfig),
+		ldap.DialWithDialer(&net.Dialer{Timeout: a.ConnectTimeout}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+// ищет запись пользователя от имени служебной учетной записи
+func (a *LDAPAuthenticator) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	if a.BindDN != "" {
+		if err := conn.Bind(a.BindDN, a.BindPassword); err != nil {
+			return nil, fmt.Errorf("service bind: %w", err)
+		}
+	}
+
+	request := ldap.NewSearchRequest(
+		a.UserBase,
+		ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, 0, false,
+		fmt.Sprintf(a.UserFilter, ldap.EscapeFilter(username)),
+		[]string{a.UsernameAttr, a.DisplayNameAttr, a.EmailAttr, a.GroupAttr},
+		nil,
+	)
+
+	result, err := conn.Search(request)
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, fmt.Errorf("filter matches more than one entry for %s", username)
+		}
+		return nil, err
+	}
+	if len(result.Entries) != 1 {
+		return nil, ErrInvalidCredentials
+	}
+
+	return result.Entries[0], nil
+}
+
+// создает или обновляет локального пользователя по записи каталога
+func (a *LDAPAuthenticator) syncUser(entry *ldap.Entry, groups []string) (*models.User, error) {
+	username := entry.GetAttributeValue(a.UsernameAttr)
+	if username == "" {
+		return nil, errors.New("directory entry has no username attribute")
+	}
+
+	var user models.User
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var identity models.Identity
+		err := tx.Where("provider = ? AND subject = ?", LDAPProvider, strings.ToLower(entry.DN)).First(&identity).Error
+		if err == nil {
+			return tx.First(&user, identity.UserID).Error
+		}
+
+		// одноименная локальная учетная запись не связывается сама: иначе любая запись каталога
+		// забрала бы чужой аккаунт. Связь создает администратор командой chatctl link-identity,
+		// а до тех пор владелец входит по локальному паролю
+		err = tx.Where("username = ?", username).First(&user).Error
+		if err == nil {
+			return fmt.Errorf("%w: %s", ErrIdentityConflict, username)
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		user = models.User{
+			Username:   username,
+			Password:   "!",
+			Status:     models.UserStatusActive,
+			LastActive: time.Now(),
+		}
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		log.Printf("Provisioned user %s from LDAP entry %s", username, entry.DN)
+
+		return tx.Create(&models.Identity{
+			UserID:   user.ID,
+			Provider: LDAPProvider,
+			Subject:  strings.ToLower(entry.DN),
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	updates := make(map[string]interface{})
+	if displayName := entry.GetAttributeValue(a.DisplayNameAttr); displayName != "" && displayName != user.Nickname {
+		updates["nickname"] = displayName
+	}
+	if email := strings.ToLower(entry.GetAttributeValue(a.EmailAttr)); email != "" && email != user.Email {
+		var count int64
+		database.DB.Model(&models.User{}).Where("email = ? AND id <> ?", email, user.ID).Count(&count)
+		if count == 0 {
+			updates["email"] = email
+			updates["email_verified"] = true
+		}
+	}
+	previousRole := user.Role
+	if a.managesRole(user.Role) {
+		if role := a.roleForGroups(groups); role != user.Role {
+			updates["role"] = role
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+			log.Printf("Error syncing LDAP attributes for %s: %v", username, err)
+		} else if role, ok := updates["role"]; ok {
+			audit.RecordSystem(audit.Event{
+				Action:     models.AuditRoleChange,
+				TargetType: "user",
+				TargetID:   user.ID,
+				Changes:    audit.Changes{"role": {Before: previousRole, After: role}},
+				Details:    "LDAP group sync",
+			})
+		}
+	}
+
+	return &user, nil
+}
+
+// синхронизация управляет только ролями, которые может выдать GroupRoles, и member.
+// Роль вне этого набора, например owner из chatctl create-owner или admin, выданный
+// вручную без группы admin в LDAP_GROUP_ROLES, при входе не меняется
+func (a *LDAPAuthenticator) managesRole(role string) bool {
+	if len(a.GroupRoles) == 0 {
+		return false
+	}
+	if role == "" || role == models.RoleMember {
+		return true
+	}
+	for _, mapped := range a.GroupRoles {
+		if mapped == role {
+			return true
+		}
+	}
+	return false
+}
+
+// выбирает самую привилегированную роль среди групп пользователя
+func (a *LDAPAuthenticator) roleForGroups(groups []string) string {
+	role := models.RoleMember
+	for _, group := range groups {
+		if mapped, ok := a.GroupRoles[strings.ToLower(group)]; ok && models.RoleRank(mapped) > models.RoleRank(role) {
+			role = mapped
+		}
+	}
+	return role
+}
+
+func containsFold(values []string, target string) bool {
+	for _, value := range values {
+		if strings.EqualFold(value, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"path/filepath"
+	"testing"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+func TestLDAPGroupSyncManagesOnlyMappedRoles(t *testing.T) {
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	database.InitDB()
+
+	a := &LDAPAuthenticator{
+		UsernameAttr: "uid",
+		GroupAttr:    "memberOf",
+		GroupRoles:   map[string]string{"cn=mods": models.RoleModerator},
+	}
+
+	tests := []struct {
+		name   string
+		role   string
+		groups []string
+		want   string
+	}{
+		{"member joins a mapped group", models.RoleMember, []string{"cn=mods"}, models.RoleModerator},
+		{"moderator leaves the group", models.RoleModerator, nil, models.RoleMember},
+		{"local owner is kept", models.RoleOwner, nil, models.RoleOwner},
+		{"local admin is kept", models.RoleAdmin, []string{"cn=mods"}, models.RoleAdmin},
+		{"unchanged role", models.RoleMember, nil, models.RoleMember},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dn := "uid=user" + string(rune('a'+i)) + ",dc=corp"
+			user := models.User{Username: "user" + string(rune('a'+i)), Password: "!", Status: models.UserStatusActive, Role: tt.role}
+			database.DB.Create(&user)
+			database.DB.Create(&models.Identity{UserID: user.ID, Provider: LDAPProvider, Subject: dn})
+
+			entry := ldap.NewEntry(dn, map[string][]string{"uid": {user.Username}})
+			if _, err := a.syncUser(entry, tt.groups); err != nil {
+				t.Fatal(err)
+			}
+
+			var stored models.User
+			database.DB.First(&stored, user.ID)
+			if stored.Role != tt.want {
+				t.Fatalf("role = %s, want %s", stored.Role, tt.want)
+			}
+
+			var entries int64
+			database.DB.Model(&models.AuditEntry{}).Where("action = ? AND target_id = ?", models.AuditRoleChange, user.ID).Count(&entries)
+			if changed := tt.role != tt.want; (entries == 1) != changed || entries > 1 {
+				t.Fatalf("%d role change audit entries, role changed %t", entries, changed)
+			}
+		})
+	}
+}
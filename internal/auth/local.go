@@ -0,0 +1,39 @@
+package auth
+
+import (
+	"log"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/password"
+)
+
+// LocalAuthenticator проверяет пароль, хранящийся в БД
+type LocalAuthenticator struct{}
+
+func (LocalAuthenticator) Name() string {
+	return "local"
+}
+
+func (LocalAuthenticator) Authenticate(username, plain string) (*models.User, error) {
+	var user models.User
+	if err := database.DB.Where("username = ?", username).First(&user).Error; err != nil {
+		return nil, ErrInvalidCredentials
+	}
+
+	ok, needsRehash, err := password.Verify(user.Password, plain)
+	if err != nil || !ok {
+		return nil, ErrInvalidCredentials
+	}
+
+	// пересчет хеша, созданного устаревшим алгоритмом или параметрами
+	if needsRehash {
+		if hashedPassword, err := password.Hash(plain); err == nil {
+			if err := database.DB.Model(&user).UpdateColumn("password", hashedPassword).Error; err != nil {
+				log.Printf("Error rehashing password on login: %v", err)
+			}
+		}
+	}
+
+	return &user, nil
+}
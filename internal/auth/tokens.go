@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/moderation"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// APITokenPrefix отличает персональные токены от JWT сессии
+const APITokenPrefix = "rcp_"
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrUserPending  = errors.New("account is pending approval")
+)
+
+// BanError - владелец токена забанен; текст ошибки объясняет причину и срок бана
+type BanError struct {
+	Ban *models.ModerationAction
+}
+
+func (e *BanError) Error() string {
+	return moderation.Describe(e.Ban)
+}
+
+// Principal - владелец проверенного bearer токена
+type Principal struct {
+	User models.User
+	// TokenID == 0 для JWT сессии, которая дает полный доступ
+	TokenID uint
+	Scopes  []string
+}
+
+// IsSession сообщает, выполнен ли вход интерактивно, а не персональным токеном
+func (p *Principal) IsSession() bool {
+	return p.TokenID == 0
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	if p.IsSession() {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// проверяет JWT сессии или персональный токен и возвращает его владельца
+func ResolveBearer(tokenString, remoteIP string) (*Principal, error) {
+	var principal Principal
+
+	if strings.HasPrefix(tokenString, APITokenPrefix) {
+		var token models.APIToken
+		if err := database.DB.Where("token_hash = ?", HashAPIToken(tokenString)).First(&token).Error; err != nil {
+			return nil, ErrInvalidToken
+		}
+		if token.Expired(time.Now()) {
+			return nil, ErrTokenExpired
+		}
+		if err := database.DB.First(&principal.User, token.UserID).Error; err != nil {
+			return nil, ErrInvalidToken
+		}
+
+		principal.TokenID = token.ID
+		principal.Scopes = token.ScopeList()
+		touchAPIToken(&token, remoteIP)
+	} else {
+		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+			return []byte(config.JWTSecret), nil
+		}, jwt.WithValidMethods([]string{"HS256"}))
+		if err != nil || !token.Valid {
+			return nil, ErrInvalidToken
+		}
+
+		claims, ok := token.Claims.(jwt.MapClaims)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		userID, ok := claims["user_id"].(float64)
+		if !ok {
+			return nil, ErrInvalidToken
+		}
+		if err := database.DB.First(&principal.User, uint(userID)).Error; err != nil {
+			return nil, ErrInvalidToken
+		}
+	}
+
+	if principal.User.Status == models.UserStatusPending {
+		return nil, ErrUserPending
+	}
+	if ban := moderation.Active(principal.User.ID, models.ModerationBan); ban != nil {
+		return nil, &BanError{Ban: ban}
+	}
+
+	return &principal, nil
+}
+
+// обновляет сведения о последнем использовании не чаще раза в минуту
+func touchAPIToken(token *models.APIToken, remoteIP string) {
+	now := time.Now()
+	if token.LastUsedAt != nil && now.Sub(*token.LastUsedAt) < time.Minute && token.LastUsedIP == remoteIP {
+		return
+	}
+	database.DB.Model(token).UpdateColumns(map[string]interface{}{
+		"last_used_at": now,
+		"last_used_ip": remoteIP,
+	})
+}
+
+// генерирует новый персональный токен
+func GenerateAPIToken() (string, error) {
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return APITokenPrefix + hex.EncodeToString(raw), nil
+}
+
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
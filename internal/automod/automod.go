@@ -0,0 +1,432 @@
+package automod
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// минимальное число букв, начиная с которого проверяется доля заглавных
+const minCapsLetters = 10
+
+// домены, ссылки на которые считаются приглашениями в сторонние чаты
+var inviteDomains = []string{"discord.gg", "discord.com/invite", "t.me/joinchat", "t.me/+", "chat.whatsapp.com"}
+
+var (
+	linkPattern    = regexp.MustCompile(`(?i)\b(?:https?://|www\.)[^\s<>"]+`)
+	mentionPattern = regexp.MustCompile(`(?:^|\s)@[\p{L}\p{N}_]+`)
+)
+
+var actionRank = map[string]int{
+	models.AutomodFlag:   1,
+	models.AutomodRedact: 2,
+	models.AutomodBlock:  3,
+	models.AutomodMute:   4,
+}
+
+// Match - сработавшее правило
+type Match struct {
+	RuleID uint   `json:"rule_id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Action string `json:"action"`
+	DryRun bool   `json:"dry_run"`
+}
+
+// Result - итог проверки сообщения; действия правил в режиме dry-run в него не входят
+type Result struct {
+	Content     string  `json:"content"`
+	Action      string  `json:"action"`
+	Rule        string  `json:"rule"`
+	MuteMinutes int     `json:"mute_minutes"`
+	Matches     []Match `json:"matches"`
+}
+
+// Blocked сообщает, что сообщение не должно быть сохранено
+func (r *Result) Blocked() bool {
+	return r.Action == models.AutomodBlock || r.Action == models.AutomodMute
+}
+
+// Flagged сообщает, что сообщение нужно отправить в очередь модерации
+func (r *Result) Flagged() bool {
+	for _, match := range r.Matches {
+		if match.Action == models.AutomodFlag && !match.DryRun {
+			return true
+		}
+	}
+	return false
+}
+
+// MuteDuration возвращает срок автоматического мута; 0 - бессрочно
+func (r *Result) MuteDuration() time.Duration {
+	return time.Duration(r.MuteMinutes) * time.Minute
+}
+
+type compiledRule struct {
+	rule    models.AutomodRule
+	regex   *regexp.Regexp
+	domains []string
+}
+
+type sentMessage struct {
+	content string
+	at      time.Time
+}
+
+type engine struct {
+	mutex   sync.RWMutex
+	rules   []compiledRule
+	history map[uint][]sentMessage
+	histMu  sync.Mutex
+}
+
+var current = &engine{history: make(map[uint][]sentMessage)}
+
+// загружает включенные правила из БД; вызывается при старте и после каждого изменения правил
+func Reload() error {
+	var rules []models.AutomodRule
+	if err := database.DB.Where("enabled = ?", true).Order("id").Find(&rules).Error; err != nil {
+		return err
+	}
+
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c, err := compile(rule)
+		if err != nil {
+			log.Printf("Skipping automod rule %d (%s): %v", rule.ID, rule.Name, err)
+			continue
+		}
+		compiled = append(compiled, c)
+	}
+
+	current.mutex.Lock()
+	current.rules = compiled
+	current.mutex.Unlock()
+
+	log.Printf("Automod loaded %d rules", len(compiled))
+	return nil
+}
+
+// проверяет корректность правила перед сохранением
+func Validate(rule models.AutomodRule) error {
+	if _, ok := actionRank[rule.Action]; !ok {
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+	_, err := compile(rule)
+	return err
+}
+
+func compile(rule models.AutomodRule) (compiledRule, error) {
+	c := compiledRule{rule: rule}
+
+	switch rule.Type {
+	case models.AutomodWords:
+		words := splitList(rule.Pattern)
+		if len(words) == 0 {
+			return c, fmt.Errorf("word list is empty")
+		}
+		// длинные слова первыми: из слов с общим началом в одной позиции выбирается самое длинное
+		sort.SliceStable(words, func(i, j int) bool { return len(words[i]) > len(words[j]) })
+		quoted := make([]string, len(words))
+		for i, word := range words {
+			quoted[i] = regexp.QuoteMeta(word)
+		}
+		// \b в RE2 учитывает только ASCII, поэтому границы слова проверяет wordMatches
+		c.regex = regexp.MustCompile(`(?i)(?:` + strings.Join(quoted, "|") + `)`)
+	case models.AutomodRegex:
+		regex, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return c, fmt.Errorf("invalid regex: %w", err)
+		}
+		c.regex = regex
+	case models.AutomodLinkDeny, models.AutomodLinkAllow:
+		c.domains = splitList(rule.Pattern)
+		if rule.Type == models.AutomodLinkDeny && len(c.domains) == 0 {
+			return c, fmt.Errorf("domain list is empty")
+		}
+	case models.AutomodInvite:
+		// приглашения часто пишут без схемы, поэтому ищутся по доменам, а не среди ссылок
+		domains := append(append([]string{}, inviteDomains...), splitList(rule.Pattern)...)
+		quoted := make([]string, len(domains))
+		for i, domain := range domains {
+			quoted[i] = regexp.QuoteMeta(strings.TrimSuffix(domain, "/"))
+		}
+		c.regex = regexp.MustCompile(`(?i)(?:https?://)?(?:www\.)?(?:` + strings.Join(quoted, "|") + `)/?[^\s<>"]+`)
+	case models.AutomodCaps:
+		if rule.Threshold <= 0 || rule.Threshold > 100 {
+			return c, fmt.Errorf("threshold must be a percentage between 1 and 100")
+		}
+	case models.AutomodMentions:
+		if rule.Threshold <= 0 {
+			return c, fmt.Errorf("threshold must be positive")
+		}
+	case models.AutomodRepeat:
+		if rule.Threshold < 2 || rule.WindowSeconds <= 0 {
+			return c, fmt.Errorf("repeat rule needs threshold >= 2 and window_seconds > 0")
+		}
+	default:
+		return c, fmt.Errorf("unknown rule type %q", rule.Type)
+	}
+
+	return c, nil
+}
+
+// Check прогоняет сообщение через правила, обновляет счетчики срабатываний
+// и запоминает сообщение для правил повторов
+func Check(userID uint, content string) Result {
+	result := evaluate(userID, content, current.snapshot())
+	current.remember(userID, content)
+
+	for _, match := range result.Matches {
+		now := time.Now()
+		err := database.DB.Model(&models.AutomodRule{}).Where("id = ?", match.RuleID).
+			UpdateColumns(map[string]interface{}{"hits": gorm.Expr("hits + 1"), "last_hit_at": now}).Error
+		if err != nil {
+			log.Printf("Error updating automod hit counter: %v", err)
+		}
+		if match.DryRun {
+			log.Printf("Automod dry-run: rule %q would %s message from user %d", match.Name, match.Action, userID)
+		}
+	}
+	return result
+}
+
+// Test проверяет текст правилами без побочных эффектов; ruleSet по умолчанию - загруженные правила
+func Test(content string, ruleSet []models.AutomodRule) (Result, error) {
+	rules := current.snapshot()
+	if ruleSet != nil {
+		rules = make([]compiledRule, 0, len(ruleSet))
+		for _, rule := range ruleSet {
+			c, err := compile(rule)
+			if err != nil {
+				return Result{}, err
+			}
+			rules = append(rules, c)
+		}
+	}
+	return evaluate(0, content, rules), nil
+}
+
+func (e *engine) snapshot() []compiledRule {
+	e.mutex.RLock()
+	defer e.mutex.RUnlock()
+	return e.rules
+}
+
+func evaluate(userID uint, content string, rules []compiledRule) Result {
+	result := Result{Content: content, Matches: []Match{}}
+
+	for _, rule := range rules {
+		spans, matched := rule.match(userID, result.Content)
+		if !matched {
+			continue
+		}
+
+		result.Matches = append(result.Matches, Match{
+			RuleID: rule.rule.ID,
+			Name:   rule.rule.Name,
+			Type:   rule.rule.Type,
+			Action: rule.rule.Action,
+			DryRun: rule.rule.DryRun,
+		})
+		if rule.rule.DryRun {
+			continue
+		}
+
+		if rule.rule.Action == models.AutomodRedact {
+			result.Content = redact(result.Content, rule.rule.Type, spans)
+		}
+		if actionRank[rule.rule.Action] > actionRank[result.Action] {
+			result.Action = rule.rule.Action
+			result.Rule = rule.rule.Name
+			result.MuteMinutes = rule.rule.MuteMinutes
+		}
+	}
+
+	return result
+}
+
+// возвращает найденные фрагменты (если правило их выделяет) и признак срабатывания
+func (r *compiledRule) match(userID uint, content string) ([][]int, bool) {
+	switch r.rule.Type {
+	case models.AutomodWords:
+		spans := wordMatches(r.regex, content)
+		return spans, len(spans) > 0
+
+	case models.AutomodRegex, models.AutomodInvite:
+		spans := r.regex.FindAllStringIndex(content, -1)
+		return spans, len(spans) > 0
+
+	case models.AutomodLinkDeny, models.AutomodLinkAllow:
+		var spans [][]int
+		for _, span := range linkPattern.FindAllStringIndex(content, -1) {
+			link := content[span[0]:span[1]]
+			listed := linkMatches(link, r.domains)
+			if (r.rule.Type == models.AutomodLinkAllow) != listed {
+				spans = append(spans, span)
+			}
+		}
+		return spans, len(spans) > 0
+
+	case models.AutomodCaps:
+		letters, upper := 0, 0
+		for _, ch := range content {
+			if unicode.IsLetter(ch) {
+				letters++
+				if unicode.IsUpper(ch) {
+					upper++
+				}
+			}
+		}
+		return nil, letters >= minCapsLetters && upper*100 >= letters*r.rule.Threshold
+
+	case models.AutomodMentions:
+		return nil, len(mentionPattern.FindAllString(content, -1)) > r.rule.Threshold
+
+	case models.AutomodRepeat:
+		if userID == 0 {
+			return nil, false
+		}
+		since := time.Now().Add(-time.Duration(r.rule.WindowSeconds) * time.Second)
+		return nil, current.repeats(userID, content, since)+1 >= r.rule.Threshold
+	}
+	return nil, false
+}
+
+// находит вхождения слов, не окруженные буквами, цифрами или _. Граница проверяется
+// вне регулярного выражения, чтобы разделитель между соседними словами не поглощался
+// совпадением и повторы через один символ находились все
+func wordMatches(regex *regexp.Regexp, content string) [][]int {
+	var spans [][]int
+	for pos := 0; pos < len(content); {
+		loc := regex.FindStringIndex(content[pos:])
+		if loc == nil {
+			break
+		}
+		start, end := pos+loc[0], pos+loc[1]
+		before, _ := utf8.DecodeLastRuneInString(content[:start])
+		after, _ := utf8.DecodeRuneInString(content[end:])
+		if !isWordRune(before) && !isWordRune(after) {
+			spans = append(spans, []int{start, end})
+			pos = end
+			continue
+		}
+		// слово внутри другого слова: поиск продолжается со следующего символа
+		_, size := utf8.DecodeRuneInString(content[start:])
+		pos = start + size
+	}
+	return spans
+}
+
+func isWordRune(r rune) bool {
+	return r == '_' || unicode.IsLetter(r) || unicode.IsNumber(r)
+}
+
+// проверяет, есть ли в тексте ссылка
+func ContainsLink(content string) bool {
+	return linkPattern.MatchString(content)
+}
+
+// проверяет, относится ли ссылка к одному из доменов (поддомены включаются)
+func linkMatches(link string, domains []string) bool {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return false
+	}
+	host := strings.ToLower(strings.TrimPrefix(parsed.Hostname(), "www."))
+	target := host + parsed.EscapedPath()
+
+	for _, domain := range domains {
+		domain = strings.ToLower(domain)
+		if strings.Contains(domain, "/") {
+			if strings.HasPrefix(target, domain) {
+				return true
+			}
+			continue
+		}
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+func redact(content, ruleType string, spans [][]int) string {
+	if len(spans) == 0 {
+		if ruleType == models.AutomodCaps {
+			return strings.ToLower(content)
+		}
+		return "[redacted]"
+	}
+
+	sort.Slice(spans, func(i, j int) bool { return spans[i][0] < spans[j][0] })
+	var builder strings.Builder
+	last := 0
+	for _, span := range spans {
+		if span[0] < last {
+			continue
+		}
+		builder.WriteString(content[last:span[0]])
+		builder.WriteString("***")
+		last = span[1]
+	}
+	builder.WriteString(content[last:])
+	return builder.String()
+}
+
+// считает одинаковые сообщения пользователя после указанного момента
+func (e *engine) repeats(userID uint, content string, since time.Time) int {
+	e.histMu.Lock()
+	defer e.histMu.Unlock()
+
+	count := 0
+	normalized := strings.ToLower(strings.TrimSpace(content))
+	for _, sent := range e.history[userID] {
+		if sent.at.After(since) && sent.content == normalized {
+			count++
+		}
+	}
+	return count
+}
+
+// хранит последние сообщения пользователя для правил повторов
+func (e *engine) remember(userID uint, content string) {
+	if userID == 0 {
+		return
+	}
+
+	e.histMu.Lock()
+	defer e.histMu.Unlock()
+
+	const keep = 20
+	history := append(e.history[userID], sentMessage{content: strings.ToLower(strings.TrimSpace(content)), at: time.Now()})
+	if len(history) > keep {
+		history = history[len(history)-keep:]
+	}
+	e.history[userID] = history
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.FieldsFunc(value, func(r rune) bool { return r == ',' || r == '\n' }) {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,40 @@
+package automod
+
+import (
+	"testing"
+
+	"realtime_chat_platform/internal/models"
+)
+
+func TestWordRuleRedactsEveryOccurrence(t *testing.T) {
+	rule := models.AutomodRule{Name: "words", Type: models.AutomodWords, Action: models.AutomodRedact, Pattern: "bad, badword, плохо"}
+
+	tests := []struct {
+		content string
+		want    string
+		matched bool
+	}{
+		{"bad bad bad", "*** *** ***", true},
+		{"bad,bad.bad", "***,***.***", true},
+		{"BAD Bad", "*** ***", true},
+		{"плохо плохо", "*** ***", true},
+		{"a badword here", "a *** here", true},
+		{"badwords badly abad bad_ bad1", "badwords badly abad bad_ bad1", false},
+		{"xbad bad", "xbad ***", true},
+		{"неплохо", "неплохо", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		result, err := Test(tt.content, []models.AutomodRule{rule})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if matched := len(result.Matches) > 0; matched != tt.matched {
+			t.Errorf("%q: matched = %t, want %t", tt.content, matched, tt.matched)
+		}
+		if result.Content != tt.want {
+			t.Errorf("%q redacted to %q, want %q", tt.content, result.Content, tt.want)
+		}
+	}
+}
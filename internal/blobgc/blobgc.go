@@ -0,0 +1,114 @@
+// Package blobgc удаляет из хранилища файлы, на которые больше не ссылаются аватары
+// пользователей и вложения: старые аватары после замены, превью удаленных вложений
+package blobgc
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/storage"
+)
+
+// префиксы ключей, которыми управляет сервер; остальное содержимое хранилища не трогается
+var managedPrefixes = []string{models.AvatarKeyPrefix, models.AttachmentKeyPrefix, models.QuarantineKeyPrefix, "thumbnails/"}
+
+// Report - итог одного прохода
+type Report struct {
+	Scanned        int
+	Deleted        int
+	ReclaimedBytes int64
+}
+
+// Collect удаляет файлы без ссылок, которые старше grace. Срок защищает только что
+// загруженные файлы: запись в БД появляется после сохранения файла.
+// При dryRun файлы только перечисляются. onDelete вызывается для каждого удаляемого файла
+func Collect(store storage.BlobStore, grace time.Duration, dryRun bool, onDelete func(storage.BlobInfo)) (Report, error) {
+	var report Report
+
+	// ссылки читаются до обхода хранилища: файлы, появившиеся позже, моложе grace
+	referenced, err := referencedKeys()
+	if err != nil {
+		return report, err
+	}
+	cutoff := time.Now().Add(-grace)
+
+	var orphans []storage.BlobInfo
+	for _, prefix := range managedPrefixes {
+		err := store.List(prefix, func(info storage.BlobInfo) error {
+			report.Scanned++
+			if !referenced[info.Key] && info.ModTime.Before(cutoff) {
+				orphans = append(orphans, info)
+			}
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	for _, info := range orphans {
+		if onDelete != nil {
+			onDelete(info)
+		}
+		if !dryRun {
+			if err := store.Delete(info.Key); err != nil {
+				return report, err
+			}
+		}
+		report.Deleted++
+		report.ReclaimedBytes += info.Size
+	}
+	return report, nil
+}
+
+// Start периодически запускает очистку основного хранилища
+func Start(interval, grace time.Duration) {
+	if interval <= 0 {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			report, err := Collect(storage.Store, grace, false, nil)
+			if err != nil {
+				log.Printf("Storage cleanup failed: %v", err)
+				continue
+			}
+			if report.Deleted > 0 {
+				log.Printf("Storage cleanup: %d of %d files deleted, %d bytes reclaimed", report.Deleted, report.Scanned, report.ReclaimedBytes)
+			}
+		}
+	}()
+}
+
+// собирает ключи всех файлов, на которые есть ссылки в БД
+func referencedKeys() (map[string]bool, error) {
+	referenced := make(map[string]bool)
+
+	// удаленные (soft delete) пользователи тоже учитываются: их можно восстановить
+	var users []models.User
+	if err := database.DB.Unscoped().Select("id", "avatar").Where("avatar LIKE ?", models.AvatarURLPrefix+"%").Find(&users).Error; err != nil {
+		return nil, err
+	}
+	for _, user := range users {
+		for _, url := range user.AvatarVariants() {
+			referenced[models.AvatarKeyPrefix+strings.TrimPrefix(url, models.AvatarURLPrefix)] = true
+		}
+	}
+
+	var attachments []models.Attachment
+	if err := database.DB.Select("id", "path", "thumbnail_path").Find(&attachments).Error; err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		referenced[attachment.Path] = true
+		if attachment.ThumbnailPath != "" {
+			referenced[attachment.ThumbnailPath] = true
+		}
+	}
+	return referenced, nil
+}
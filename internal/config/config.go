@@ -0,0 +1,278 @@
+package config
+
+import (
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// режимы работы с email при регистрации
+const (
+	EmailModeOff      = "off"
+	EmailModeOptional = "optional"
+	EmailModeRequired = "required"
+)
+
+// режимы регистрации
+const (
+	RegistrationOpen     = "open"
+	RegistrationInvite   = "invite"
+	RegistrationDomain   = "domain"
+	RegistrationApproval = "approval"
+)
+
+// внешний адрес сервера для ссылок, которые получают пользователи
+var PublicURL = strings.TrimRight(getEnv("PUBLIC_URL", "http://localhost:8080"), "/")
+
+// адреса и подсети обратных прокси, которым можно верить в X-Forwarded-For; без них
+// адресом клиента считается адрес соединения
+var TrustedProxies = getListEnv("TRUSTED_PROXIES")
+
+// email при регистрации: off, optional или required
+var EmailMode = getEnv("EMAIL_MODE", EmailModeOptional)
+
+// срок действия ссылки подтверждения email
+var EmailVerificationTTL = getDurationEnv("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+
+// настройки SMTP; без SMTPHost письма только пишутся в лог
+var (
+	SMTPHost     = getEnv("SMTP_HOST", "")
+	SMTPPort     = getIntEnv("SMTP_PORT", 587)
+	SMTPUsername = getEnv("SMTP_USERNAME", "")
+	SMTPPassword = getEnv("SMTP_PASSWORD", "")
+	SMTPFrom     = getEnv("SMTP_FROM", "chat@localhost")
+)
+
+// кто может создать аккаунт: open, invite, domain или approval
+var RegistrationMode = getEnv("REGISTRATION_MODE", RegistrationOpen)
+
+// домены email, разрешенные в режиме domain
+var RegistrationDomains = getListEnv("REGISTRATION_DOMAINS")
+
+// вход через OpenID Connect; отключен, если OIDCIssuer пуст
+var (
+	OIDCIssuer       = getEnv("OIDC_ISSUER", "")
+	OIDCClientID     = getEnv("OIDC_CLIENT_ID", "")
+	OIDCClientSecret = getEnv("OIDC_CLIENT_SECRET", "")
+	OIDCRedirectURL  = getEnv("OIDC_REDIRECT_URL", PublicURL+"/api/auth/oidc/callback")
+	OIDCScopes       = strings.Fields(getEnv("OIDC_SCOPES", "openid profile email"))
+	OIDCProviderName = getEnv("OIDC_PROVIDER_NAME", "SSO")
+	// claim с именем пользователя для аккаунтов, созданных при первом входе
+	OIDCUsernameClaim = getEnv("OIDC_USERNAME_CLAIM", "preferred_username")
+	// создавать локальный аккаунт при первом входе через SSO
+	OIDCAutoProvision = getBoolEnv("OIDC_AUTO_PROVISION", false)
+	// связывать вход через SSO с аккаунтом с тем же подтвержденным email
+	OIDCLinkByEmail = getBoolEnv("OIDC_LINK_BY_EMAIL", false)
+)
+
+// параметры WebAuthn для входа по ключам доступа
+var (
+	WebAuthnRPID    = getEnv("WEBAUTHN_RP_ID", hostname(PublicURL))
+	WebAuthnRPName  = getEnv("WEBAUTHN_RP_NAME", "Realtime Chat Platform")
+	WebAuthnOrigins = getListEnv("WEBAUTHN_ORIGINS")
+)
+
+// источники учетных данных для входа по паролю в порядке проверки: local, ldap
+var AuthBackends = getListEnv("AUTH_BACKENDS")
+
+// вход через LDAP / Active Directory
+var (
+	LDAPURL                = getEnv("LDAP_URL", "ldap://localhost:389")
+	LDAPStartTLS           = getBoolEnv("LDAP_START_TLS", false)
+	LDAPInsecureSkipVerify = getBoolEnv("LDAP_INSECURE_SKIP_VERIFY", false)
+	LDAPBindDN             = getEnv("LDAP_BIND_DN", "")
+	LDAPBindPassword       = getEnv("LDAP_BIND_PASSWORD", "")
+	LDAPUserBase           = getEnv("LDAP_USER_BASE", "")
+	LDAPUserFilter         = getEnv("LDAP_USER_FILTER", "(&(objectClass=person)(uid=%s))")
+	LDAPUsernameAttr       = getEnv("LDAP_USERNAME_ATTR", "uid")
+	LDAPDisplayNameAttr    = getEnv("LDAP_DISPLAY_NAME_ATTR", "displayName")
+	LDAPEmailAttr          = getEnv("LDAP_EMAIL_ATTR", "mail")
+	LDAPGroupAttr          = getEnv("LDAP_GROUP_ATTR", "memberOf")
+	// через LDAP входят только члены этой группы
+	LDAPRequiredGroup = getEnv("LDAP_REQUIRED_GROUP", "")
+	// пары роль:DN группы через точку с запятой
+	LDAPGroupRoles = getEnv("LDAP_GROUP_ROLES", "")
+)
+
+// алгоритм хеширования новых паролей: argon2id или bcrypt
+var PasswordHasher = getEnv("PASSWORD_HASHER", "argon2id")
+
+// параметры хеширования паролей
+var (
+	BcryptCost        = getIntEnv("BCRYPT_COST", 10)
+	Argon2Memory      = uint32(getIntEnv("ARGON2_MEMORY_KB", 64*1024))
+	Argon2Iterations  = uint32(getIntEnv("ARGON2_ITERATIONS", 3))
+	Argon2Parallelism = uint8(getIntEnv("ARGON2_PARALLELISM", 2))
+)
+
+// требования к паролю при регистрации и смене пароля
+var (
+	PasswordMinLength    = getIntEnv("PASSWORD_MIN_LENGTH", 6)
+	PasswordMaxLength    = getIntEnv("PASSWORD_MAX_LENGTH", 128)
+	PasswordBreachedList = getEnv("PASSWORD_BREACHED_LIST", "")
+)
+
+// ограничения частоты событий сокета: в минуту и всплеск для одного соединения
+var (
+	RateLimitMessages        = getIntEnv("RATE_LIMIT_MESSAGES", 20)
+	RateLimitMessagesBurst   = getIntEnv("RATE_LIMIT_MESSAGES_BURST", 5)
+	RateLimitTyping          = getIntEnv("RATE_LIMIT_TYPING", 60)
+	RateLimitTypingBurst     = getIntEnv("RATE_LIMIT_TYPING_BURST", 10)
+	RateLimitReactions       = getIntEnv("RATE_LIMIT_REACTIONS", 60)
+	RateLimitReactionsBurst  = getIntEnv("RATE_LIMIT_REACTIONS_BURST", 10)
+	RateLimitUserFactor      = getIntEnv("RATE_LIMIT_USER_FACTOR", 2)
+	RateLimitMaxViolations   = getIntEnv("RATE_LIMIT_MAX_VIOLATIONS", 10)
+	RateLimitViolationWindow = getDurationEnv("RATE_LIMIT_VIOLATION_WINDOW", time.Minute)
+)
+
+// хранилище загруженных файлов: local или s3
+var StorageBackend = getEnv("STORAGE_BACKEND", "local")
+
+// каталог локального хранилища; как статика не раздается
+var UploadDir = getEnv("UPLOAD_DIR", "data/uploads")
+
+// файлы скачиваются по ссылкам с подписью HMAC; ссылка действует от FileURLTTL до двух
+// таких сроков и в пределах одного срока кешируется. Без FileURLSecret ключ
+// генерируется и хранится в базе
+var (
+	FileURLSecret = getEnv("FILE_URL_SECRET", "")
+	FileURLTTL    = getDurationEnv("FILE_URL_TTL", time.Hour)
+)
+
+// S3-совместимое хранилище (AWS S3, MinIO, Ceph RGW)
+var (
+	S3Endpoint        = getEnv("S3_ENDPOINT", "")
+	S3Region          = getEnv("S3_REGION", "us-east-1")
+	S3Bucket          = getEnv("S3_BUCKET", "")
+	S3AccessKeyID     = getEnv("S3_ACCESS_KEY_ID", "")
+	S3SecretAccessKey = getEnv("S3_SECRET_ACCESS_KEY", "")
+	// префикс ключей внутри бакета
+	S3Prefix = getEnv("S3_PREFIX", "")
+	// адресация endpoint/bucket/key вместо bucket.endpoint/key; нужна для MinIO
+	S3PathStyle = getBoolEnv("S3_PATH_STYLE", true)
+)
+
+// ограничения вложений; AttachmentTypes - MIME-типы или маски вида image/*.
+// Голосовые сообщения - аудиовложения, дополнительно ограниченные VoiceMaxDuration
+var (
+	AttachmentMaxSize     = int64(getIntEnv("ATTACHMENT_MAX_SIZE_MB", 25)) << 20
+	AttachmentTypes       = strings.Split(getEnv("ATTACHMENT_TYPES", "image/*,video/*,audio/*,application/pdf,text/plain,application/zip"), ",")
+	AttachmentsPerMessage = getIntEnv("ATTACHMENTS_PER_MESSAGE", 10)
+	VoiceMaxDuration      = getDurationEnv("VOICE_MAX_DURATION", 5*time.Minute)
+)
+
+// квоты в байтах на все загрузки пользователя (вложения и аватар) и на вложения комнаты;
+// 0 - без ограничения. Администратор может задать свою квоту пользователю или комнате
+var (
+	UserStorageQuota = int64(getIntEnv("USER_STORAGE_QUOTA_MB", 1024)) << 20
+	RoomStorageQuota = int64(getIntEnv("ROOM_STORAGE_QUOTA_MB", 0)) << 20
+)
+
+// файлы без ссылок из аватаров и вложений удаляются, если они старше BlobGCGrace;
+// сборщик запускается каждые BlobGCInterval, 0 отключает его
+var (
+	BlobGCInterval = getDurationEnv("BLOB_GC_INTERVAL", 24*time.Hour)
+	BlobGCGrace    = getDurationEnv("BLOB_GC_GRACE", 24*time.Hour)
+)
+
+// обработка изображений и видео; кадры видео извлекает ffmpeg,
+// пустой FFmpegPath отключает превью видео
+var (
+	ThumbnailSize = getIntEnv("THUMBNAIL_SIZE", 320)
+	MediaWorkers  = getIntEnv("MEDIA_WORKERS", 2)
+	FFmpegPath    = getEnv("FFMPEG_PATH", "ffmpeg")
+)
+
+// проверка загрузок: Scanner - none, eicar (находит только тестовый файл EICAR) или clamav.
+// ClamAVAddress - host:port или путь к unix-сокету clamd
+var (
+	Scanner       = getEnv("SCANNER", "none")
+	ClamAVAddress = getEnv("CLAMAV_ADDRESS", "localhost:3310")
+	ScanTimeout   = getDurationEnv("SCAN_TIMEOUT", time.Minute)
+	ScanWorkers   = getIntEnv("SCAN_WORKERS", 2)
+)
+
+// AttachmentTypeAllowed сообщает, подходит ли MIME-тип под ATTACHMENT_TYPES
+func AttachmentTypeAllowed(contentType string) bool {
+	for _, allowed := range AttachmentTypes {
+		allowed = strings.TrimSpace(allowed)
+		if allowed == contentType || allowed == "*/*" {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(allowed, "/*"); ok && strings.HasPrefix(contentType, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// ограничения аккаунтов моложе NewAccountAge; нулевое значение отключает ограничение
+var (
+	NewAccountAge         = getDurationEnv("NEW_ACCOUNT_AGE", 24*time.Hour)
+	NewAccountCooldown    = getDurationEnv("NEW_ACCOUNT_COOLDOWN", 0)
+	NewAccountBlockLinks  = getBoolEnv("NEW_ACCOUNT_BLOCK_LINKS", false)
+	NewAccountRateDivisor = getIntEnv("NEW_ACCOUNT_RATE_DIVISOR", 1)
+)
+
+// режим рейда временно ужесточает ограничения на всем сервере: аккаунты моложе
+// RaidModeAccountAge ограничены и не могут отправлять ссылки, а лимиты сообщений
+// всех, кроме модераторов, делятся на RaidModeRateDivisor
+var (
+	RaidModeDuration    = getDurationEnv("RAID_MODE_DURATION", time.Hour)
+	RaidModeAccountAge  = getDurationEnv("RAID_MODE_ACCOUNT_AGE", 7*24*time.Hour)
+	RaidModeCooldown    = getDurationEnv("RAID_MODE_COOLDOWN", 10*time.Minute)
+	RaidModeRateDivisor = getIntEnv("RAID_MODE_RATE_DIVISOR", 4)
+)
+
+// EmailVerificationRequired сообщает, ограничивать ли аккаунты без подтвержденного email;
+// регистрация по домену имеет смысл только с подтвержденным адресом
+func EmailVerificationRequired() bool {
+	return EmailMode == EmailModeRequired || RegistrationMode == RegistrationDomain
+}
+
+func hostname(rawURL string) string {
+	if parsed, err := url.Parse(rawURL); err == nil && parsed.Hostname() != "" {
+		return parsed.Hostname()
+	}
+	return "localhost"
+}
+
+func getEnv(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getListEnv(key string) []string {
+	var values []string
+	for _, value := range strings.Split(os.Getenv(key), ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func getBoolEnv(key string, fallback bool) bool {
+	if value, err := strconv.ParseBool(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func getIntEnv(key string, fallback int) int {
+	if value, err := strconv.Atoi(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	if value, err := time.ParseDuration(os.Getenv(key)); err == nil {
+		return value
+	}
+	return fallback
+}
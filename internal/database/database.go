@@ -12,6 +12,9 @@ import (
 
 var DB *gorm.DB
 
+// DefaultRoomID - идентификатор комнаты models.DefaultRoomName
+var DefaultRoomID uint
+
 func InitDB() {
 	var err error
 
@@ -25,10 +28,31 @@ func InitDB() {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	err = DB.AutoMigrate(&models.User{}, &models.Message{})
+	err = DB.AutoMigrate(&models.User{}, &models.Message{}, &models.EmailVerification{}, &models.Invite{}, &models.Identity{}, &models.Credential{}, &models.WebAuthnSession{}, &models.APIToken{}, &models.Room{}, &models.RoomMember{}, &models.ModerationAction{}, &models.Report{}, &models.AutomodRule{}, &models.AuditEntry{}, &models.Attachment{}, &models.Secret{})
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
+	// сообщения, созданные до появления комнат, относятся к комнате по умолчанию
+	room := models.Room{Name: models.DefaultRoomName}
+	if err := DB.Where("name = ?", room.Name).FirstOrCreate(&room).Error; err != nil {
+		log.Fatal("Failed to create default room:", err)
+	}
+	DefaultRoomID = room.ID
+
+	if err := DB.Model(&models.Message{}).Where("room_id = 0").UpdateColumn("room_id", DefaultRoomID).Error; err != nil {
+		log.Fatal("Failed to migrate messages to default room:", err)
+	}
+
+	// журнал аудита защищен от изменений и на уровне базы, а не только хуками GORM
+	for _, statement := range []string{
+		`CREATE TRIGGER IF NOT EXISTS audit_entries_no_update BEFORE UPDATE ON audit_entries BEGIN SELECT RAISE(ABORT, 'audit entries are append-only'); END`,
+		`CREATE TRIGGER IF NOT EXISTS audit_entries_no_delete BEFORE DELETE ON audit_entries BEGIN SELECT RAISE(ABORT, 'audit entries are append-only'); END`,
+	} {
+		if err := DB.Exec(statement).Error; err != nil {
+			log.Fatal("Failed to protect audit log:", err)
+		}
+	}
+
 	log.Println("Database connected and migrated successfully")
 }
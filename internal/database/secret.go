@@ -0,0 +1,35 @@
+package database
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"realtime_chat_platform/internal/models"
+
+	"gorm.io/gorm/clause"
+)
+
+// Secret возвращает ключ с именем name из таблицы secrets, при первом обращении
+// создавая случайный ключ из 32 байт
+func Secret(name string) ([]byte, error) {
+	var stored models.Secret
+	if err := DB.Limit(1).Find(&stored, "name = ?", name).Error; err != nil {
+		return nil, fmt.Errorf("load secret %s: %w", name, err)
+	}
+	if stored.Name != "" {
+		return stored.Value, nil
+	}
+
+	generated := models.Secret{Name: name, Value: make([]byte, 32)}
+	if _, err := rand.Read(generated.Value); err != nil {
+		return nil, err
+	}
+	// при одновременном создании остается ключ, сохраненный первым
+	if err := DB.Clauses(clause.OnConflict{DoNothing: true}).Create(&generated).Error; err != nil {
+		return nil, fmt.Errorf("store secret %s: %w", name, err)
+	}
+	if err := DB.First(&stored, "name = ?", name).Error; err != nil {
+		return nil, fmt.Errorf("load secret %s: %w", name, err)
+	}
+	return stored.Value, nil
+}
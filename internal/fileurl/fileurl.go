@@ -0,0 +1,128 @@
+// Package fileurl подписывает ссылки на сохраненные файлы. Ссылка привязана к пользователю,
+// для которого выдана, и действует ограниченное время; права этого пользователя
+// проверяются заново при каждом скачивании
+package fileurl
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+)
+
+// Prefix - общий префикс адресов, которые требуют подписи
+const Prefix = "/files/"
+
+// имя ключа подписи в таблице secrets
+const secretName = "file_url"
+
+var (
+	ErrInvalidSignature = errors.New("invalid file link signature")
+	ErrExpired          = errors.New("file link has expired")
+)
+
+// ключ HMAC; задается в Init
+var secret []byte
+
+// Init выбирает ключ подписи: FILE_URL_SECRET или случайный ключ из базы. Ключ создается
+// при первом запуске и не совпадает с ключом JWT, поэтому ссылки нельзя подделать,
+// зная только исходный код
+func Init() error {
+	if config.FileURLSecret != "" {
+		secret = []byte(config.FileURLSecret)
+		return nil
+	}
+
+	stored, err := database.Secret(secretName)
+	if err != nil {
+		return err
+	}
+	secret = stored
+	return nil
+}
+
+// Sign добавляет к адресу файла пользователя, срок действия и подпись. Адреса вне Prefix
+// (внешние аватары, сгенерированные SVG) возвращаются без изменений
+func Sign(path string, userID uint) string {
+	if !strings.HasPrefix(path, Prefix) {
+		return path
+	}
+
+	// срок округляется до окна FileURLTTL: в пределах окна ссылка одна и та же и кешируется браузером
+	window := int64(max(config.FileURLTTL/time.Second, 1))
+	expires := (time.Now().Unix()/window + 2) * window
+
+	query := url.Values{
+		"u":   {strconv.FormatUint(uint64(userID), 10)},
+		"exp": {strconv.FormatInt(expires, 10)},
+		"sig": {signature(path, userID, expires)},
+	}
+	return path + "?" + query.Encode()
+}
+
+// Verify проверяет подпись и срок ссылки и возвращает пользователя, для которого она выдана
+func Verify(path string, query url.Values) (uint, time.Time, error) {
+	userID, err := strconv.ParseUint(query.Get("u"), 10, 32)
+	if err != nil {
+		return 0, time.Time{}, ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(query.Get("exp"), 10, 64)
+	if err != nil {
+		return 0, time.Time{}, ErrInvalidSignature
+	}
+
+	expected := signature(path, uint(userID), expires)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("sig"))) {
+		return 0, time.Time{}, ErrInvalidSignature
+	}
+	expiresAt := time.Unix(expires, 0)
+	if time.Now().After(expiresAt) {
+		return 0, time.Time{}, ErrExpired
+	}
+	return uint(userID), expiresAt, nil
+}
+
+// SignAll подписывает значения словаря адресов, например вариантов аватара
+func SignAll(urls map[string]string, userID uint) map[string]string {
+	if urls == nil {
+		return nil
+	}
+	signed := make(map[string]string, len(urls))
+	for key, path := range urls {
+		signed[key] = Sign(path, userID)
+	}
+	return signed
+}
+
+// Attachment возвращает копию вложения со ссылками, подписанными для пользователя
+func Attachment(attachment models.Attachment, userID uint) models.Attachment {
+	attachment.URL = Sign(attachment.URL, userID)
+	attachment.ThumbnailURL = Sign(attachment.ThumbnailURL, userID)
+	return attachment
+}
+
+// Attachments подписывает ссылки всех вложений сообщения
+func Attachments(attachments []models.Attachment, userID uint) []models.Attachment {
+	if attachments == nil {
+		return nil
+	}
+	signed := make([]models.Attachment, len(attachments))
+	for i, attachment := range attachments {
+		signed[i] = Attachment(attachment, userID)
+	}
+	return signed
+}
+
+func signature(path string, userID uint, expires int64) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(path + "\n" + strconv.FormatUint(uint64(userID), 10) + "\n" + strconv.FormatInt(expires, 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
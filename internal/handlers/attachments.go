@@ -0,0 +1,382 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/audio"
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/fileurl"
+	"realtime_chat_platform/internal/media"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/quarantine"
+	"realtime_chat_platform/internal/quota"
+	"realtime_chat_platform/internal/rbac"
+	"realtime_chat_platform/internal/scanner"
+	"realtime_chat_platform/internal/storage"
+
+	"github.com/gin-gonic/gin"
+)
+
+// загружает файл для последующей отправки в сообщении
+func UploadAttachmentHandler(c *gin.Context) {
+	// запас на заголовки multipart сверх допустимого размера файла
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, config.AttachmentMaxSize+1<<20)
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		var maxBytesError *http.MaxBytesError
+		if errors.As(err, &maxBytesError) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": attachmentTooLarge()})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "No file uploaded"})
+		return
+	}
+
+	if file.Size > config.AttachmentMaxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": attachmentTooLarge()})
+		return
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return
+	}
+	defer src.Close()
+
+	// тип определяется по содержимому, заголовку клиента не доверяем
+	var (
+		contentType string
+		voice       *audio.Info
+	)
+	switch kind := c.PostForm("kind"); kind {
+	case "":
+		head := make([]byte, 512)
+		n, _ := io.ReadFull(src, head)
+		contentType, _, _ = mime.ParseMediaType(http.DetectContentType(head[:n]))
+	case models.KindVoice:
+		var ok bool
+		if voice, ok = probeVoice(c, src); !ok {
+			return
+		}
+		contentType = voice.ContentType
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown attachment kind: " + kind})
+		return
+	}
+	if !config.AttachmentTypeAllowed(contentType) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "File type is not allowed: " + contentType})
+		return
+	}
+	if _, err := src.Seek(0, io.SeekStart); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read file"})
+		return
+	}
+
+	userID := c.GetUint("user_id")
+	if !reserveUserStorage(c, userID, file.Size) {
+		return
+	}
+
+	// при включенном сканере файл до проверки лежит в карантине
+	prefix := models.AttachmentKeyPrefix
+	if scanner.Enabled() {
+		prefix = models.QuarantineKeyPrefix
+	}
+	path, err := storeAttachment(prefix, userID, src, file.Size, contentType)
+	if err != nil {
+		quota.ReleaseUser(userID, file.Size)
+		log.Printf("Error storing attachment: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return
+	}
+
+	attachment := models.Attachment{
+		UserID:      userID,
+		Filename:    attachmentFilename(file.Filename),
+		ContentType: contentType,
+		Size:        file.Size,
+		Path:        path,
+	}
+	if voice != nil {
+		attachment.Kind = models.KindVoice
+		attachment.DurationMs = voice.Duration.Milliseconds()
+		attachment.Waveform = voice.Waveform
+	}
+	if scanner.Enabled() {
+		attachment.ScanStatus = models.ScanPending
+	}
+	if media.Supported(contentType) {
+		attachment.MediaStatus = models.MediaPending
+	}
+	if err := database.DB.Create(&attachment).Error; err != nil {
+		storage.Store.Delete(path)
+		quota.ReleaseUser(userID, file.Size)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save attachment"})
+		return
+	}
+	if attachment.ScanStatus == models.ScanPending {
+		quarantine.Enqueue(attachment.ID)
+	} else if attachment.MediaStatus == models.MediaPending {
+		media.Enqueue(attachment.ID)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":    "File uploaded successfully",
+		"attachment": fileurl.Attachment(attachment, userID),
+	})
+}
+
+// проверяет голосовую запись: контейнер Ogg или WebM с Opus и длительность не больше VoiceMaxDuration
+func probeVoice(c *gin.Context, src io.Reader) (*audio.Info, bool) {
+	data, err := io.ReadAll(src)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
+		return nil, false
+	}
+
+	info, err := audio.Probe(data)
+	var invalid *audio.InvalidError
+	if errors.Is(err, audio.ErrUnsupported) {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": "Voice messages must be Opus audio in an Ogg or WebM container"})
+		return nil, false
+	} else if errors.As(err, &invalid) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid voice recording: " + invalid.Reason})
+		return nil, false
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid voice recording"})
+		return nil, false
+	}
+	if info.Duration > config.VoiceMaxDuration {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Voice message too long. Maximum duration is %s", config.VoiceMaxDuration)})
+		return nil, false
+	}
+	return info, true
+}
+
+// удаляет свое еще не отправленное вложение и освобождает место в квоте
+func DeleteAttachmentHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return
+	}
+
+	var attachment models.Attachment
+	if err := database.DB.Where("user_id = ?", c.GetUint("user_id")).First(&attachment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	if attachment.MessageID != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachment is already sent"})
+		return
+	}
+
+	if err := deleteAttachments([]models.Attachment{attachment}, 0); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete attachment"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Attachment deleted"})
+}
+
+// отдает файл по подписанной ссылке, если ее пользователь может читать комнату, в которую файл отправлен.
+// Права проверяются при каждом запросе, поэтому ссылка перестает работать, как только доступ отозван
+func DownloadAttachmentHandler(c *gin.Context) {
+	attachment, ok := readableAttachment(c)
+	if !ok {
+		return
+	}
+
+	blob, err := storage.Store.Open(attachment.Path)
+	if err != nil {
+		log.Printf("Error opening attachment %d: %v", attachment.ID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return
+	}
+	defer blob.Close()
+
+	disposition := "attachment"
+	if inlineContentType(attachment.ContentType) {
+		disposition = "inline"
+	}
+	c.Header("Content-Type", attachment.ContentType)
+	c.Header("Content-Disposition", mime.FormatMediaType(disposition, map[string]string{"filename": attachment.Filename}))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", linkCacheControl(c))
+	http.ServeContent(c.Writer, c.Request, "", attachment.CreatedAt, blob)
+}
+
+// отдает превью изображения или видео с теми же правами доступа, что и сам файл
+func DownloadThumbnailHandler(c *gin.Context) {
+	attachment, ok := readableAttachment(c)
+	if !ok {
+		return
+	}
+	if attachment.ThumbnailPath == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thumbnail not found"})
+		return
+	}
+
+	blob, err := storage.Store.Open(attachment.ThumbnailPath)
+	if err != nil {
+		log.Printf("Error opening thumbnail of attachment %d: %v", attachment.ID, err)
+		c.JSON(http.StatusNotFound, gin.H{"error": "Thumbnail not found"})
+		return
+	}
+	defer blob.Close()
+
+	c.Header("Content-Type", mime.TypeByExtension(filepath.Ext(attachment.ThumbnailPath)))
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Cache-Control", linkCacheControl(c))
+	http.ServeContent(c.Writer, c.Request, "", blob.Info().ModTime, blob)
+}
+
+// загружает вложение из пути запроса и проверяет доступ; при отказе ответ уже отправлен
+func readableAttachment(c *gin.Context) (*models.Attachment, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attachment ID"})
+		return nil, false
+	}
+
+	var attachment models.Attachment
+	if err := database.DB.First(&attachment, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return nil, false
+	}
+
+	// ссылки, выданные без пользователя, к вложениям не подходят
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return nil, false
+	}
+
+	if !canReadAttachment(&user, &attachment) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Attachment not found"})
+		return nil, false
+	}
+	// файл из карантина не отдается даже автору
+	if attachment.Quarantined() {
+		c.JSON(http.StatusConflict, gin.H{"error": "Attachment has not passed the malware scan yet"})
+		return nil, false
+	}
+	return &attachment, true
+}
+
+// неотправленный файл видит только автор; отправленный - все, кто может читать комнату сообщения
+func canReadAttachment(user *models.User, attachment *models.Attachment) bool {
+	if attachment.MessageID == nil {
+		return attachment.UserID == user.ID
+	}
+
+	var message models.Message
+	if err := database.DB.First(&message, *attachment.MessageID).Error; err != nil {
+		return false
+	}
+	if message.Shadow && message.Username != user.Username {
+		return false
+	}
+	return rbac.UserCan(user, message.RoomID, rbac.MessagesRead)
+}
+
+// удаляет вложения вместе с файлами и освобождает место их авторов и комнаты roomID (0 - без комнаты)
+func deleteAttachments(attachments []models.Attachment, roomID uint) error {
+	if len(attachments) == 0 {
+		return nil
+	}
+	ids := make([]uint, 0, len(attachments))
+	for _, attachment := range attachments {
+		ids = append(ids, attachment.ID)
+	}
+	if err := database.DB.Delete(&models.Attachment{}, ids).Error; err != nil {
+		return err
+	}
+
+	var roomBytes int64
+	for _, attachment := range attachments {
+		// файлы без ссылок удалит и фоновая очистка, поэтому ошибка здесь только логируется
+		deleteBlobs([]string{attachment.Path})
+		if attachment.ThumbnailPath != "" {
+			deleteBlobs([]string{attachment.ThumbnailPath})
+		}
+		if err := quota.ReleaseUser(attachment.UserID, attachment.Size); err != nil {
+			log.Printf("Error releasing storage of user %d: %v", attachment.UserID, err)
+		}
+		roomBytes += attachment.Size
+	}
+	if roomID != 0 {
+		if err := quota.ReleaseRoom(roomID, roomBytes); err != nil {
+			log.Printf("Error releasing storage of room %d: %v", roomID, err)
+		}
+	}
+	return nil
+}
+
+// резервирует место в квоте пользователя; при превышении отвечает 413 с занятым местом и квотой
+func reserveUserStorage(c *gin.Context, userID uint, bytes int64) bool {
+	err := quota.ReserveUser(userID, bytes)
+	var exceeded *quota.ExceededError
+	if errors.As(err, &exceeded) {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{
+			"error":       "Storage quota exceeded: " + quota.FormatBytes(exceeded.Used) + " of " + quota.FormatBytes(exceeded.Quota) + " used, this upload needs " + quota.FormatBytes(exceeded.Requested),
+			"used_bytes":  exceeded.Used,
+			"quota_bytes": exceeded.Quota,
+		})
+		return false
+	} else if err != nil {
+		log.Printf("Error reserving storage for user %d: %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+		return false
+	}
+	return true
+}
+
+// сохраняет содержимое в хранилище под случайным ключом с префиксом и возвращает ключ
+func storeAttachment(prefix string, userID uint, src io.Reader, size int64, contentType string) (string, error) {
+	random := make([]byte, 8)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+
+	key := fmt.Sprintf("%s%s/%d_%s", prefix, time.Now().Format("2006/01"), userID, hex.EncodeToString(random))
+	if err := storage.Store.Put(key, src, size, contentType); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// оставляет от имени файла клиента только базовое имя разумной длины
+func attachmentFilename(name string) string {
+	name = strings.TrimSpace(filepath.Base(strings.ReplaceAll(name, "\\", "/")))
+	if name == "" || name == "." || name == "/" {
+		name = "file"
+	}
+	if len(name) > 255 {
+		name = strings.ToValidUTF8(name[:255], "")
+	}
+	return name
+}
+
+// типы, которые браузер может безопасно показать сам
+func inlineContentType(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/") ||
+		strings.HasPrefix(contentType, "audio/") || contentType == "application/pdf" || contentType == "text/plain"
+}
+
+func attachmentTooLarge() string {
+	return fmt.Sprintf("File too large. Maximum size is %dMB", config.AttachmentMaxSize>>20)
+}
@@ -0,0 +1,164 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// возвращает журнал аудита с фильтрами; format=csv или format=jsonl выгружает все найденные записи
+func ListAuditHandler(c *gin.Context) {
+	query, err := auditQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	switch c.DefaultQuery("format", "json") {
+	case "csv":
+		exportAuditCSV(c, query)
+	case "jsonl":
+		exportAuditJSONL(c, query)
+	case "json":
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "100"))
+		if err != nil || limit <= 0 || limit > 1000 {
+			limit = 100
+		}
+
+		var entries []models.AuditEntry
+		if err := query.Limit(limit).Find(&entries).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit log"})
+			return
+		}
+
+		// следующая страница запрашивается с before_id последней записи
+		c.JSON(http.StatusOK, gin.H{
+			"entries": entries,
+			"count":   len(entries),
+		})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be json, csv or jsonl"})
+	}
+}
+
+func auditQuery(c *gin.Context) (*gorm.DB, error) {
+	query := database.DB.Model(&models.AuditEntry{}).Order("id desc")
+
+	// action=moderation.* выбирает все действия с префиксом
+	if action := c.Query("action"); action != "" {
+		if prefix, ok := strings.CutSuffix(action, "*"); ok {
+			query = query.Where("action LIKE ?", prefix+"%")
+		} else {
+			query = query.Where("action = ?", action)
+		}
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+
+	for param, column := range map[string]string{"actor_id": "actor_id", "target_id": "target_id", "before_id": "id"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		id, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, errors.New("Invalid " + param)
+		}
+		if param == "before_id" {
+			query = query.Where(column+" < ?", id)
+		} else {
+			query = query.Where(column+" = ?", id)
+		}
+	}
+
+	for param, operator := range map[string]string{"since": ">=", "until": "<"} {
+		value := c.Query(param)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, errors.New("Invalid " + param + ", expected RFC 3339 timestamp")
+		}
+		query = query.Where("created_at "+operator+" ?", at)
+	}
+
+	return query, nil
+}
+
+func exportAuditCSV(c *gin.Context, query *gorm.DB) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="audit.csv"`)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write([]string{"id", "created_at", "action", "actor_id", "actor_username", "target_type", "target_id", "ip", "changes", "details"})
+	streamAudit(query, func(entry *models.AuditEntry) error {
+		return writer.Write([]string{
+			strconv.FormatUint(uint64(entry.ID), 10),
+			entry.CreatedAt.UTC().Format(time.RFC3339),
+			csvCell(entry.Action),
+			strconv.FormatUint(uint64(entry.ActorID), 10),
+			csvCell(entry.ActorUsername),
+			csvCell(entry.TargetType),
+			strconv.FormatUint(uint64(entry.TargetID), 10),
+			csvCell(entry.IP),
+			string(entry.Changes),
+			csvCell(entry.Details),
+		})
+	})
+	writer.Flush()
+}
+
+// экранирует значения, которые табличный редактор принял бы за формулу
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func exportAuditJSONL(c *gin.Context, query *gorm.DB) {
+	c.Header("Content-Type", "application/x-ndjson")
+	c.Header("Content-Disposition", `attachment; filename="audit.jsonl"`)
+
+	encoder := json.NewEncoder(c.Writer)
+	streamAudit(query, func(entry *models.AuditEntry) error {
+		return encoder.Encode(entry)
+	})
+}
+
+// построчно читает записи, не загружая весь журнал в память
+func streamAudit(query *gorm.DB, write func(entry *models.AuditEntry) error) {
+	rows, err := query.Rows()
+	if err != nil {
+		log.Printf("Error exporting audit log: %v", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.AuditEntry
+		if err := database.DB.ScanRows(rows, &entry); err != nil {
+			log.Printf("Error exporting audit log: %v", err)
+			return
+		}
+		if err := write(&entry); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestAuditCSVEscapesFormulas(t *testing.T) {
+	setupTestDB(t)
+	database.DB.Create(&[]models.AuditEntry{
+		{Action: models.AuditLoginFailed, ActorUsername: "=HYPERLINK(\"http://evil.test\")", Details: "+1"},
+		{Action: models.AuditLoginFailed, ActorUsername: "alice", Details: "@SUM(A1)"},
+		{Action: models.AuditLoginFailed, ActorUsername: "-bob", Details: "plain text"},
+	})
+
+	router := gin.New()
+	router.GET("/api/admin/audit", ListAuditHandler)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/admin/audit?format=csv", nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", recorder.Code, recorder.Body)
+	}
+
+	records, err := csv.NewReader(recorder.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, record := range records[1:] {
+		got[record[4]] = record[9]
+	}
+	want := map[string]string{
+		"'=HYPERLINK(\"http://evil.test\")": "'+1",
+		"alice":                             "'@SUM(A1)",
+		"'-bob":                             "plain text",
+	}
+	for username, details := range want {
+		if got[username] != details {
+			t.Errorf("row %q has details %q, want %q (rows %v)", username, got[username], details, got)
+		}
+	}
+}
@@ -1,22 +1,29 @@
 package handlers
 
 import (
+	"errors"
 	"log"
 	"net/http"
 	"time"
 
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/auth"
 	"realtime_chat_platform/internal/config"
 	"realtime_chat_platform/internal/database"
 	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/moderation"
+	"realtime_chat_platform/internal/password"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v4"
-	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
 )
 
 type RegisterRequest struct {
-	Username string `json:"username" binding:"required"`
-	Password string `json:"password" binding:"required"`
+	Username   string `json:"username" binding:"required"`
+	Password   string `json:"password" binding:"required"`
+	Email      string `json:"email" binding:"omitempty,email"`
+	InviteCode string `json:"invite_code"`
 }
 
 type LoginRequest struct {
@@ -25,9 +32,10 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	Token    string `json:"token"`
-	Username string `json:"username"`
-	Message  string `json:"message"`
+	Token         string `json:"token"`
+	Username      string `json:"username"`
+	EmailVerified bool   `json:"email_verified"`
+	Message       string `json:"message"`
 }
 
 func RegisterHandler(c *gin.Context) {
@@ -44,8 +52,37 @@ func RegisterHandler(c *gin.Context) {
 		return
 	}
 
+	// в режиме регистрации по домену адрес обязателен независимо от EMAIL_MODE
+	email := normalizeEmail(req.Email)
+	domainMode := config.RegistrationMode == config.RegistrationDomain
+	if config.EmailMode == config.EmailModeOff && !domainMode {
+		email = ""
+	}
+	if email == "" && (config.EmailMode == config.EmailModeRequired || domainMode) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is required"})
+		return
+	}
+	if domainMode && !emailDomainAllowed(email) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email domain is not allowed"})
+		return
+	}
+	if email != "" && emailTaken(email, 0) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+		return
+	}
+
+	if config.RegistrationMode == config.RegistrationInvite && req.InviteCode == "" {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invite code is required"})
+		return
+	}
+
+	if err := password.DefaultPolicy.Validate(req.Password); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// хеширование пароля
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	hashedPassword, err := password.Hash(req.Password)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
@@ -54,16 +91,65 @@ func RegisterHandler(c *gin.Context) {
 	// создание пользователя
 	user := models.User{
 		Username:   req.Username,
-		Password:   string(hashedPassword),
+		Password:   hashedPassword,
+		Status:     models.UserStatusActive,
 		LastActive: time.Now(),
 	}
 
-	if err := database.DB.Create(&user).Error; err != nil {
+	// приглашение списывается вместе с созданием пользователя
+	var invite *models.Invite
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if req.InviteCode != "" {
+			if invite, err = consumeInvite(tx, req.InviteCode); err != nil {
+				return err
+			}
+			user.InviteID = &invite.ID
+		}
+
+		// приглашение позволяет обойти очередь одобрения
+		if config.RegistrationMode == config.RegistrationApproval && invite == nil {
+			user.Status = models.UserStatusPending
+		}
+
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+
+		// приглашение в комнату делает пользователя ее участником
+		if invite != nil && invite.DefaultRoom != "" {
+			var room models.Room
+			if err := tx.Where("name = ?", invite.DefaultRoom).First(&room).Error; err == nil {
+				return tx.Create(&models.RoomMember{RoomID: room.ID, UserID: user.ID, Role: models.RoleMember}).Error
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errInviteUnusable) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invite code is invalid, expired or exhausted"})
+		return
+	}
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "User registered successfully"})
+	// адрес записывается в профиль только после подтверждения
+	if email != "" {
+		if err := startEmailVerification(&user, email); err != nil {
+			log.Printf("Error starting email verification: %v", err)
+		}
+	}
+
+	if user.Status == models.UserStatusPending {
+		c.JSON(http.StatusAccepted, gin.H{"message": "Registration received and is awaiting approval"})
+		return
+	}
+
+	response := gin.H{"message": "User registered successfully"}
+	if invite != nil && invite.DefaultRoom != "" {
+		response["default_room"] = invite.DefaultRoom
+	}
+	c.JSON(http.StatusCreated, response)
 }
 
 func LoginHandler(c *gin.Context) {
@@ -73,40 +159,73 @@ func LoginHandler(c *gin.Context) {
 		return
 	}
 
-	// поиск пользователя
-	var user models.User
-	if err := database.DB.Where("username = ?", req.Username).First(&user).Error; err != nil {
+	// проверка учетных данных во всех настроенных источниках
+	user, err := auth.Authenticate(req.Username, req.Password)
+	if err != nil {
+		audit.Record(c, audit.Event{Action: models.AuditLoginFailed, Details: "username=" + req.Username})
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// проверка пароля
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+	if user.Status == models.UserStatusPending {
+		audit.RecordAs(c, user.ID, audit.Event{Action: models.AuditLoginFailed, TargetType: "user", TargetID: user.ID, Details: "account pending approval"})
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is pending approval"})
+		return
+	}
+	if rejectBanned(c, user) {
 		return
 	}
 
 	// обновление времени последней активности при входе без обновления updated_at
-	if err := database.DB.Model(&user).UpdateColumn("last_active", time.Now()).Error; err != nil {
+	if err := database.DB.Model(user).UpdateColumn("last_active", time.Now()).Error; err != nil {
 		log.Printf("Error updating user last active time on login: %v", err)
 	}
 
+	tokenString, err := issueToken(user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	auditLogin(c, user, "password")
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token:         tokenString,
+		Username:      user.Username,
+		EmailVerified: user.EmailVerified,
+		Message:       "Login successful",
+	})
+}
+
+// отклоняет вход забаненного пользователя. Попытка пишется в журнал с его адресом:
+// с этого адреса отклоняются и анонимные подключения к чату
+func rejectBanned(c *gin.Context, user *models.User) bool {
+	ban := moderation.Active(user.ID, models.ModerationBan)
+	if ban == nil {
+		return false
+	}
+	audit.RecordAs(c, user.ID, audit.Event{Action: models.AuditLoginFailed, TargetType: "user", TargetID: user.ID, Details: "account banned"})
+	c.JSON(http.StatusForbidden, gin.H{"error": moderation.Describe(ban)})
+	return true
+}
+
+// выдает JWT сессии; используется всеми способами входа
+func issueToken(user *models.User) (string, error) {
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
 		"user_id":  user.ID,
 		"username": user.Username,
 		"exp":      time.Now().Add(time.Hour * 24).Unix(),
 	})
 
-	tokenString, err := token.SignedString([]byte(config.JWTSecret))
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
-		return
-	}
+	return token.SignedString([]byte(config.JWTSecret))
+}
 
-	c.JSON(http.StatusOK, AuthResponse{
-		Token:    tokenString,
-		Username: user.Username,
-		Message:  "Login successful",
+// записывает успешный вход в журнал аудита
+func auditLogin(c *gin.Context, user *models.User, method string) {
+	audit.RecordAs(c, user.ID, audit.Event{
+		Action:     models.AuditLogin,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Details:    "method=" + method,
 	})
 }
 
@@ -0,0 +1,216 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/automod"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type automodRuleRequest struct {
+	Name          string `json:"name" binding:"required,max=100"`
+	Type          string `json:"type" binding:"required"`
+	Pattern       string `json:"pattern"`
+	Threshold     int    `json:"threshold" binding:"min=0"`
+	WindowSeconds int    `json:"window_seconds" binding:"min=0"`
+	Action        string `json:"action" binding:"required"`
+	MuteMinutes   int    `json:"mute_minutes" binding:"min=0"`
+	Enabled       *bool  `json:"enabled"`
+	DryRun        bool   `json:"dry_run"`
+}
+
+// переносит поля запроса в правило; правило без явного enabled включено
+func (r *automodRuleRequest) apply(rule *models.AutomodRule) {
+	rule.Name = r.Name
+	rule.Type = r.Type
+	rule.Pattern = r.Pattern
+	rule.Threshold = r.Threshold
+	rule.WindowSeconds = r.WindowSeconds
+	rule.Action = r.Action
+	rule.MuteMinutes = r.MuteMinutes
+	rule.Enabled = r.Enabled == nil || *r.Enabled
+	rule.DryRun = r.DryRun
+}
+
+// возвращает все правила автомодерации со счетчиками срабатываний
+func ListAutomodRulesHandler(c *gin.Context) {
+	var rules []models.AutomodRule
+	if err := database.DB.Order("id").Find(&rules).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve automod rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rules": rules,
+		"count": len(rules),
+	})
+}
+
+// создает правило и сразу применяет его
+func CreateAutomodRuleHandler(c *gin.Context) {
+	var request automodRuleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	rule := models.AutomodRule{CreatedByID: c.GetUint("user_id")}
+	request.apply(&rule)
+	if err := automod.Validate(rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create automod rule"})
+		return
+	}
+	reloadAutomod()
+	audit.Record(c, audit.Event{Action: models.AuditAutomodRule, TargetType: "automod_rule", TargetID: rule.ID, Details: "created " + rule.Name})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Automod rule created successfully",
+		"rule":    rule,
+	})
+}
+
+// обновляет правило; счетчик срабатываний сохраняется
+func UpdateAutomodRuleHandler(c *gin.Context) {
+	var request automodRuleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	rule, ok := findAutomodRule(c)
+	if !ok {
+		return
+	}
+
+	before := automodRuleFields(rule)
+	request.apply(rule)
+	if err := automod.Validate(*rule); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.DB.Save(rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update automod rule"})
+		return
+	}
+	reloadAutomod()
+	audit.Record(c, audit.Event{
+		Action:     models.AuditAutomodRule,
+		TargetType: "automod_rule",
+		TargetID:   rule.ID,
+		Changes:    audit.Diff(before, automodRuleFields(rule)),
+		Details:    "updated " + rule.Name,
+	})
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Automod rule updated successfully",
+		"rule":    rule,
+	})
+}
+
+func DeleteAutomodRuleHandler(c *gin.Context) {
+	rule, ok := findAutomodRule(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Delete(rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete automod rule"})
+		return
+	}
+	reloadAutomod()
+	audit.Record(c, audit.Event{Action: models.AuditAutomodRule, TargetType: "automod_rule", TargetID: rule.ID, Details: "deleted " + rule.Name})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Automod rule deleted successfully"})
+}
+
+// перечитывает правила из БД, например после правки напрямую в базе
+func ReloadAutomodHandler(c *gin.Context) {
+	if err := automod.Reload(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reload automod rules"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Automod rules reloaded"})
+}
+
+// проверяет текст загруженными правилами или переданным правилом без сохранения и счетчиков
+func TestAutomodHandler(c *gin.Context) {
+	var request struct {
+		Content string              `json:"content" binding:"required"`
+		Rule    *automodRuleRequest `json:"rule"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	var ruleSet []models.AutomodRule
+	if request.Rule != nil {
+		var rule models.AutomodRule
+		request.Rule.apply(&rule)
+		rule.DryRun = false
+		if err := automod.Validate(rule); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		ruleSet = []models.AutomodRule{rule}
+	}
+
+	result, err := automod.Test(request.Content, ruleSet)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+func findAutomodRule(c *gin.Context) (*models.AutomodRule, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+		return nil, false
+	}
+
+	var rule models.AutomodRule
+	if err := database.DB.First(&rule, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Automod rule not found"})
+		return nil, false
+	}
+
+	return &rule, true
+}
+
+// редактируемые поля правила для сравнения в журнале аудита
+func automodRuleFields(rule *models.AutomodRule) map[string]interface{} {
+	return map[string]interface{}{
+		"name":           rule.Name,
+		"type":           rule.Type,
+		"pattern":        rule.Pattern,
+		"threshold":      rule.Threshold,
+		"window_seconds": rule.WindowSeconds,
+		"action":         rule.Action,
+		"mute_minutes":   rule.MuteMinutes,
+		"enabled":        rule.Enabled,
+		"dry_run":        rule.DryRun,
+	}
+}
+
+func reloadAutomod() {
+	if err := automod.Reload(); err != nil {
+		log.Printf("Error reloading automod rules: %v", err)
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/mailer"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/password"
+
+	"github.com/gin-gonic/gin"
+)
+
+// приводит адрес к каноническому виду для сравнения и хранения
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// проверяет, занят ли адрес другим пользователем
+func emailTaken(email string, exceptUserID uint) bool {
+	var count int64
+	database.DB.Model(&models.User{}).
+		Where("email = ? AND id <> ?", email, exceptUserID).
+		Count(&count)
+	return count > 0
+}
+
+// хеширует токен подтверждения для хранения в БД
+func hashVerificationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// создает токен подтверждения адреса и отправляет ссылку на него
+func startEmailVerification(user *models.User, email string) error {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(raw)
+
+	// предыдущие ссылки перестают действовать
+	if err := database.DB.Where("user_id = ?", user.ID).Delete(&models.EmailVerification{}).Error; err != nil {
+		return err
+	}
+
+	verification := models.EmailVerification{
+		UserID:    user.ID,
+		Email:     email,
+		TokenHash: hashVerificationToken(token),
+		ExpiresAt: time.Now().Add(config.EmailVerificationTTL),
+	}
+	if err := database.DB.Create(&verification).Error; err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/verify-email?token=%s", config.PublicURL, token)
+	body := fmt.Sprintf("Здравствуйте, %s!\n\nПодтвердите адрес электронной почты, перейдя по ссылке:\n%s\n\nСсылка действительна до %s.",
+		user.Username, link, verification.ExpiresAt.Format("2006-01-02 15:04"))
+
+	return mailer.Send(email, "Подтверждение адреса электронной почты", body)
+}
+
+// подтверждает адрес по токену из письма
+func VerifyEmailHandler(c *gin.Context) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token is required"})
+		return
+	}
+
+	var verification models.EmailVerification
+	if err := database.DB.Where("token_hash = ?", hashVerificationToken(token)).First(&verification).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invalid verification token"})
+		return
+	}
+
+	if time.Now().After(verification.ExpiresAt) {
+		database.DB.Delete(&verification)
+		c.JSON(http.StatusGone, gin.H{"error": "Verification token expired"})
+		return
+	}
+
+	if emailTaken(verification.Email, verification.UserID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, verification.UserID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	before := user.Email
+	updates := map[string]interface{}{
+		"email":          verification.Email,
+		"email_verified": true,
+	}
+	if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+		return
+	}
+	audit.RecordAs(c, user.ID, audit.Event{
+		Action:     models.AuditEmailChange,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    audit.Changes{"email": {Before: before, After: verification.Email}},
+		Details:    "verified",
+	})
+
+	if err := database.DB.Where("user_id = ?", verification.UserID).Delete(&models.EmailVerification{}).Error; err != nil {
+		log.Printf("Error cleaning up email verifications: %v", err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+}
+
+// запускает смену адреса: новый адрес применяется только после подтверждения
+func ChangeEmailHandler(c *gin.Context) {
+	uid := c.GetUint("user_id")
+	if uid == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	if config.EmailMode == config.EmailModeOff {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Email addresses are disabled"})
+		return
+	}
+
+	var request struct {
+		Email    string `json:"email" binding:"required,email"`
+		Password string `json:"password" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if ok, _, err := password.Verify(user.Password, request.Password); err != nil || !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Password is incorrect"})
+		return
+	}
+
+	email := normalizeEmail(request.Email)
+	if email == user.Email && user.EmailVerified {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already verified"})
+		return
+	}
+	if emailTaken(email, user.ID) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
+		return
+	}
+
+	if err := startEmailVerification(&user, email); err != nil {
+		log.Printf("Error starting email verification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+	audit.Record(c, audit.Event{
+		Action:     models.AuditEmailChange,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    audit.Changes{"email": {Before: user.Email, After: email}},
+		Details:    "verification requested",
+	})
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
+
+// повторно отправляет письмо для неподтвержденного адреса
+func ResendVerificationHandler(c *gin.Context) {
+	uid := c.GetUint("user_id")
+	if uid == 0 {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, uid).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	// ожидающая смена адреса имеет приоритет над текущим адресом
+	email := user.Email
+	var pending models.EmailVerification
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at desc").First(&pending).Error; err == nil {
+		email = pending.Email
+	}
+
+	if email == "" || (email == user.Email && user.EmailVerified) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Nothing to verify"})
+		return
+	}
+
+	if err := startEmailVerification(&user, email); err != nil {
+		log.Printf("Error starting email verification: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to send verification email"})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, gin.H{"message": "Verification email sent"})
+}
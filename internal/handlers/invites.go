@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var errInviteUnusable = errors.New("invite is invalid, expired or exhausted")
+
+// генерирует код приглашения, удобный для ручного ввода
+func generateInviteCode() (string, error) {
+	raw := make([]byte, 10)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(raw), nil
+}
+
+// проверяет, разрешен ли домен адреса в режиме регистрации по домену
+func emailDomainAllowed(email string) bool {
+	_, domain, found := strings.Cut(email, "@")
+	if !found {
+		return false
+	}
+	for _, allowed := range config.RegistrationDomains {
+		if strings.EqualFold(domain, allowed) {
+			return true
+		}
+	}
+	return false
+}
+
+// списывает одно использование приглашения внутри транзакции регистрации
+func consumeInvite(tx *gorm.DB, code string) (*models.Invite, error) {
+	var invite models.Invite
+	if err := tx.Where("code = ?", strings.ToUpper(strings.TrimSpace(code))).First(&invite).Error; err != nil {
+		return nil, errInviteUnusable
+	}
+	if !invite.Usable(time.Now()) {
+		return nil, errInviteUnusable
+	}
+
+	// условие в UPDATE защищает от одновременного использования последнего слота
+	result := tx.Model(&models.Invite{}).
+		Where("id = ? AND (max_uses = 0 OR uses < max_uses)", invite.ID).
+		UpdateColumn("uses", gorm.Expr("uses + 1"))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errInviteUnusable
+	}
+
+	invite.Uses++
+	return &invite, nil
+}
+
+// возвращает список приглашений
+func ListInvitesHandler(c *gin.Context) {
+	var invites []models.Invite
+	if err := database.DB.Order("created_at desc").Find(&invites).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve invites"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"invites": invites,
+		"count":   len(invites),
+	})
+}
+
+// создает приглашение
+func CreateInviteHandler(c *gin.Context) {
+	var request struct {
+		MaxUses        int    `json:"max_uses" binding:"min=0"`
+		ExpiresInHours int    `json:"expires_in_hours" binding:"min=0"`
+		DefaultRoom    string `json:"default_room"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	code, err := generateInviteCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate invite code"})
+		return
+	}
+
+	invite := models.Invite{
+		Code:        code,
+		CreatedByID: c.GetUint("user_id"),
+		MaxUses:     request.MaxUses,
+		DefaultRoom: request.DefaultRoom,
+	}
+	if request.ExpiresInHours > 0 {
+		expiresAt := time.Now().Add(time.Duration(request.ExpiresInHours) * time.Hour)
+		invite.ExpiresAt = &expiresAt
+	}
+
+	if err := database.DB.Create(&invite).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+		return
+	}
+	audit.Record(c, audit.Event{Action: models.AuditInviteCreate, TargetType: "invite", TargetID: invite.ID})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Invite created successfully",
+		"invite":  invite,
+	})
+}
+
+// отзывает приглашение; уже зарегистрированные пользователи не затрагиваются
+func RevokeInviteHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+		return
+	}
+
+	var invite models.Invite
+	if err := database.DB.First(&invite, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+		return
+	}
+
+	if invite.RevokedAt == nil {
+		if err := database.DB.Model(&invite).Update("revoked_at", time.Now()).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite"})
+			return
+		}
+		audit.Record(c, audit.Event{Action: models.AuditInviteRevoke, TargetType: "invite", TargetID: invite.ID})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite revoked successfully"})
+}
+
+// возвращает учетные записи, ожидающие одобрения
+func ListPendingUsersHandler(c *gin.Context) {
+	var users []models.User
+	if err := database.DB.Where("status = ?", models.UserStatusPending).Order("created_at").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve users"})
+		return
+	}
+
+	pending := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		pending = append(pending, gin.H{
+			"id":         user.ID,
+			"username":   user.Username,
+			"email":      user.Email,
+			"created_at": user.CreatedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"users": pending,
+		"count": len(pending),
+	})
+}
+
+// одобряет ожидающую учетную запись
+func ApproveUserHandler(c *gin.Context) {
+	user, ok := findPendingUser(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(user).Update("status", models.UserStatusActive).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve user"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     models.AuditUserApprove,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    audit.Changes{"status": {Before: models.UserStatusPending, After: models.UserStatusActive}},
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "User approved successfully"})
+}
+
+// отклоняет ожидающую учетную запись и удаляет ее
+func RejectUserHandler(c *gin.Context) {
+	user, ok := findPendingUser(c)
+	if !ok {
+		return
+	}
+
+	// удаление без soft delete освобождает имя пользователя
+	if err := database.DB.Unscoped().Delete(user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject user"})
+		return
+	}
+
+	audit.Record(c, audit.Event{Action: models.AuditUserReject, TargetType: "user", TargetID: user.ID, Details: user.Username})
+	c.JSON(http.StatusOK, gin.H{"message": "User rejected successfully"})
+}
+
+func findPendingUser(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	var user models.User
+	if err := database.DB.Where("status = ?", models.UserStatusPending).First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pending user not found"})
+		return nil, false
+	}
+
+	return &user, true
+}
@@ -4,7 +4,9 @@ import (
 	"net/http"
 	"strconv"
 
+	"realtime_chat_platform/internal/auth"
 	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/fileurl"
 	"realtime_chat_platform/internal/models"
 	"realtime_chat_platform/internal/websocket"
 
@@ -21,7 +23,19 @@ func GetMessageHistory(c *gin.Context) {
 
 	var messages []models.Message
 
-	if err := database.DB.Order("created_at desc").Limit(limit).Find(&messages).Error; err != nil {
+	// сообщения под теневым баном видит в истории только их автор, иначе после
+	// перезагрузки они исчезли бы у него и бан перестал бы быть незаметным
+	query := database.DB.Preload("Attachments").Order("created_at desc").Limit(limit)
+	if principal, ok := c.Get("principal"); ok {
+		query = query.Where("shadow = ? OR username = ?", false, principal.(*auth.Principal).User.Username)
+	} else {
+		query = query.Where("shadow = ?", false)
+	}
+	if roomID, err := strconv.Atoi(c.Query("room_id")); err == nil {
+		query = query.Where("room_id = ?", roomID)
+	}
+
+	if err := query.Find(&messages).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve messages"})
 		return
 	}
@@ -31,14 +45,19 @@ func GetMessageHistory(c *gin.Context) {
 	}
 
 	type MessageWithUser struct {
-		ID        uint   `json:"id"`
-		Username  string `json:"username"`
-		Content   string `json:"content"`
-		CreatedAt string `json:"created_at"`
-		Nickname  string `json:"nickname"`
-		Avatar    string `json:"avatar"`
+		ID          uint                `json:"id"`
+		RoomID      uint                `json:"room_id"`
+		Username    string              `json:"username"`
+		Content     string              `json:"content"`
+		CreatedAt   string              `json:"created_at"`
+		Nickname    string              `json:"nickname"`
+		Avatar      string              `json:"avatar"`
+		Kind        string              `json:"kind,omitempty"`
+		Attachments []models.Attachment `json:"attachments,omitempty"`
 	}
 
+	// ссылки на файлы подписываются для того, кто запросил историю
+	viewerID := c.GetUint("user_id")
 	var messagesWithUser []MessageWithUser
 	for _, msg := range messages {
 		var user models.User
@@ -49,21 +68,27 @@ func GetMessageHistory(c *gin.Context) {
 			}
 
 			messagesWithUser = append(messagesWithUser, MessageWithUser{
-				ID:        msg.ID,
-				Username:  displayName,
-				Content:   msg.Content,
-				CreatedAt: msg.CreatedAt.Format("2006-01-02 15:04:05"),
-				Nickname:  user.Nickname,
-				Avatar:    user.Avatar,
+				ID:          msg.ID,
+				RoomID:      msg.RoomID,
+				Username:    displayName,
+				Content:     msg.Content,
+				CreatedAt:   msg.CreatedAt.Format("2006-01-02 15:04:05"),
+				Nickname:    user.Nickname,
+				Avatar:      fileurl.Sign(user.AvatarURL(), viewerID),
+				Kind:        msg.Kind,
+				Attachments: fileurl.Attachments(msg.Attachments, viewerID),
 			})
 		} else {
 			messagesWithUser = append(messagesWithUser, MessageWithUser{
-				ID:        msg.ID,
-				Username:  msg.Username,
-				Content:   msg.Content,
-				CreatedAt: msg.CreatedAt.Format("2006-01-02 15:04:05"),
-				Nickname:  "",
-				Avatar:    "",
+				ID:          msg.ID,
+				RoomID:      msg.RoomID,
+				Username:    msg.Username,
+				Content:     msg.Content,
+				CreatedAt:   msg.CreatedAt.Format("2006-01-02 15:04:05"),
+				Nickname:    "",
+				Avatar:      models.DefaultAvatarURL(msg.Username, ""),
+				Kind:        msg.Kind,
+				Attachments: fileurl.Attachments(msg.Attachments, viewerID),
 			})
 		}
 	}
@@ -76,7 +101,7 @@ func GetMessageHistory(c *gin.Context) {
 
 // возвращает список текущих подключенных пользователей
 func GetOnlineUsers(c *gin.Context) {
-	onlineUsers := websocket.GlobalHub.GetOnlineUsers()
+	onlineUsers := websocket.GlobalHub.GetOnlineUsers(c.GetUint("user_id"))
 
 	c.JSON(http.StatusOK, gin.H{
 		"users": onlineUsers,
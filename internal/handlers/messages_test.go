@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"realtime_chat_platform/internal/auth"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMessageHistoryShowsShadowMessagesOnlyToAuthor(t *testing.T) {
+	setupTestDB(t)
+	author := createTestUser(t, "shadowed")
+	other := createTestUser(t, "other")
+	database.DB.Create(&[]models.Message{
+		{RoomID: database.DefaultRoomID, Username: "other", Content: "visible"},
+		{RoomID: database.DefaultRoomID, Username: "shadowed", Content: "hidden", Shadow: true},
+	})
+
+	history := func(viewer *models.User) []string {
+		router := gin.New()
+		router.GET("/api/messages", func(c *gin.Context) {
+			if viewer != nil {
+				c.Set("user_id", viewer.ID)
+				c.Set("principal", &auth.Principal{User: *viewer})
+			}
+		}, GetMessageHistory)
+
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/messages", nil))
+		var response struct {
+			Messages []struct {
+				Content string `json:"content"`
+			} `json:"messages"`
+		}
+		if err := json.Unmarshal(recorder.Body.Bytes(), &response); err != nil {
+			t.Fatalf("decode history: %v: %s", err, recorder.Body)
+		}
+		var contents []string
+		for _, message := range response.Messages {
+			contents = append(contents, message.Content)
+		}
+		return contents
+	}
+
+	for _, tt := range []struct {
+		name   string
+		viewer *models.User
+		want   int
+	}{
+		{"author", author, 2},
+		{"other user", other, 1},
+		{"anonymous", nil, 1},
+	} {
+		if got := history(tt.viewer); len(got) != tt.want {
+			t.Errorf("%s sees %v, want %d messages", tt.name, got, tt.want)
+		}
+	}
+}
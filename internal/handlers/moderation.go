@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/moderation"
+	"realtime_chat_platform/internal/rbac"
+	"realtime_chat_platform/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+type moderationRequest struct {
+	Reason          string `json:"reason" binding:"max=500"`
+	DurationMinutes int    `json:"duration_minutes" binding:"min=0"` // 0 - бессрочно
+}
+
+// возвращает журнал модерации с фильтрами по пользователю и действию
+func ListModerationActionsHandler(c *gin.Context) {
+	query := database.DB.Order("created_at desc").Limit(200)
+	if userID, err := strconv.Atoi(c.Query("user_id")); err == nil {
+		query = query.Where("user_id = ?", userID)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	if c.Query("active") == "true" {
+		query = query.Where("action IN ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)",
+			[]string{models.ModerationBan, models.ModerationMute, models.ModerationShadowBan}, time.Now())
+	}
+
+	var actions []models.ModerationAction
+	if err := query.Find(&actions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve moderation actions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"actions": actions,
+		"count":   len(actions),
+	})
+}
+
+// банит пользователя и закрывает его текущие соединения
+func BanUserHandler(c *gin.Context) {
+	applyModeration(c, models.ModerationBan)
+}
+
+// запрещает пользователю писать, оставляя возможность читать
+func MuteUserHandler(c *gin.Context) {
+	applyModeration(c, models.ModerationMute)
+}
+
+// закрывает текущие соединения пользователя без дальнейших ограничений
+func KickUserHandler(c *gin.Context) {
+	applyModeration(c, models.ModerationKick)
+}
+
+// скрывает сообщения пользователя от всех, кроме него самого; пользователь об этом не узнает
+func ShadowBanUserHandler(c *gin.Context) {
+	applyModeration(c, models.ModerationShadowBan)
+}
+
+func UnbanUserHandler(c *gin.Context) {
+	revokeModeration(c, models.ModerationBan)
+}
+
+func UnmuteUserHandler(c *gin.Context) {
+	revokeModeration(c, models.ModerationMute)
+}
+
+func UnshadowBanUserHandler(c *gin.Context) {
+	revokeModeration(c, models.ModerationShadowBan)
+}
+
+// возвращает состояние режима рейда и действующие в нем ограничения
+func GetRaidModeHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, raidModePayload(moderation.CurrentRaidMode()))
+}
+
+// включает или выключает режим рейда; без duration_minutes используется RAID_MODE_DURATION
+func SetRaidModeHandler(c *gin.Context) {
+	var request struct {
+		Enabled         *bool `json:"enabled" binding:"required"`
+		DurationMinutes int   `json:"duration_minutes" binding:"min=0,max=10080"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	before := moderation.CurrentRaidMode()
+	state := moderation.RaidMode{}
+	if *request.Enabled {
+		duration := config.RaidModeDuration
+		if request.DurationMinutes > 0 {
+			duration = time.Duration(request.DurationMinutes) * time.Minute
+		}
+		state = moderation.EnableRaidMode(c.GetUint("user_id"), duration)
+	} else {
+		moderation.DisableRaidMode()
+	}
+
+	details := ""
+	if state.Until != nil {
+		details = "until=" + state.Until.Format(time.RFC3339)
+	}
+	audit.Record(c, audit.Event{
+		Action:     models.AuditRaidMode,
+		TargetType: "server",
+		Changes:    audit.Changes{"enabled": {Before: before.Enabled, After: state.Enabled}},
+		Details:    details,
+	})
+	c.JSON(http.StatusOK, raidModePayload(state))
+}
+
+func raidModePayload(state moderation.RaidMode) gin.H {
+	return gin.H{
+		"raid_mode":           state,
+		"account_age_seconds": int(config.RaidModeAccountAge.Seconds()),
+		"cooldown_seconds":    int(config.RaidModeCooldown.Seconds()),
+		"rate_divisor":        config.RaidModeRateDivisor,
+	}
+}
+
+func applyModeration(c *gin.Context, action string) {
+	var request moderationRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	target, ok := findModerationTarget(c)
+	if !ok {
+		return
+	}
+
+	duration := time.Duration(request.DurationMinutes) * time.Minute
+	if action == models.ModerationKick {
+		duration = 0
+	}
+
+	record, err := moderation.Record(target.ID, c.GetUint("user_id"), action, request.Reason, duration)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record moderation action"})
+		return
+	}
+
+	disconnected := 0
+	switch action {
+	case models.ModerationBan:
+		disconnected = websocket.GlobalHub.DisconnectUser(target.ID, moderation.Describe(record))
+	case models.ModerationKick:
+		reason := "You were kicked"
+		if request.Reason != "" {
+			reason += ": " + request.Reason
+		}
+		disconnected = websocket.GlobalHub.DisconnectUser(target.ID, reason)
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     models.AuditModeration + action,
+		TargetType: "user",
+		TargetID:   target.ID,
+		Details:    moderationDetails(record),
+	})
+	c.JSON(http.StatusCreated, gin.H{
+		"message":      "Moderation action applied",
+		"action":       record,
+		"disconnected": disconnected,
+	})
+}
+
+func revokeModeration(c *gin.Context, action string) {
+	var request moderationRequest
+	if err := c.ShouldBindJSON(&request); err != nil && !errors.Is(err, io.EOF) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	target, ok := findModerationTarget(c)
+	if !ok {
+		return
+	}
+
+	if moderation.Active(target.ID, action) == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No active " + action + " for this user"})
+		return
+	}
+
+	if _, err := moderation.Revoke(target.ID, c.GetUint("user_id"), action, request.Reason); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke moderation action"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     models.AuditModeration + "un" + action,
+		TargetType: "user",
+		TargetID:   target.ID,
+		Details:    "reason=" + request.Reason,
+	})
+	c.JSON(http.StatusOK, gin.H{"message": "Moderation action revoked"})
+}
+
+// описание действия модератора для журнала аудита
+func moderationDetails(record *models.ModerationAction) string {
+	details := "reason=" + record.Reason
+	if record.ExpiresAt != nil {
+		details += " expires_at=" + record.ExpiresAt.Format(time.RFC3339)
+	}
+	return details
+}
+
+// находит пользователя из :id; модерировать можно только пользователей с ролью ниже своей
+func findModerationTarget(c *gin.Context) (*models.User, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	var target models.User
+	if err := database.DB.First(&target, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+
+	if !outranks(c, &target) {
+		return nil, false
+	}
+
+	return &target, true
+}
+
+// проверяет, что роль модератора выше серверной роли пользователя
+func outranks(c *gin.Context, target *models.User) bool {
+	if models.RoleRank(rbac.ServerRole(target)) >= models.RoleRank(c.GetString("role")) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only moderate users below your own role"})
+		return false
+	}
+	return true
+}
@@ -0,0 +1,472 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"gorm.io/gorm"
+)
+
+const (
+	passkeyRegisterCookie = "passkey_register"
+	passkeyLoginCookie    = "passkey_login"
+
+	// сколько живет незавершенная регистрация или вход
+	passkeySessionTTL = 5 * time.Minute
+)
+
+var errPasskeySessionInvalid = errors.New("passkey session is invalid, expired or already used")
+
+var (
+	webAuthn     *webauthn.WebAuthn
+	webAuthnOnce sync.Once
+	webAuthnErr  error
+)
+
+func getWebAuthn() (*webauthn.WebAuthn, error) {
+	webAuthnOnce.Do(func() {
+		origins := config.WebAuthnOrigins
+		if len(origins) == 0 {
+			origins = []string{config.PublicURL}
+		}
+
+		webAuthn, webAuthnErr = webauthn.New(&webauthn.Config{
+			RPID:          config.WebAuthnRPID,
+			RPDisplayName: config.WebAuthnRPName,
+			RPOrigins:     origins,
+		})
+	})
+	return webAuthn, webAuthnErr
+}
+
+// passkeyUser адаптирует models.User к интерфейсу webauthn.User
+type passkeyUser struct {
+	user        models.User
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte {
+	return u.user.PasskeyHandle
+}
+
+func (u *passkeyUser) WebAuthnName() string {
+	return u.user.Username
+}
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.Nickname != "" {
+		return u.user.Nickname
+	}
+	return u.user.Username
+}
+
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+// загружает пользователя вместе с его ключами доступа
+func loadPasskeyUser(userID uint) (*passkeyUser, error) {
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	var stored []models.Credential
+	if err := database.DB.Where("user_id = ?", userID).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	result := &passkeyUser{user: user}
+	for _, credential := range stored {
+		var data webauthn.Credential
+		if err := json.Unmarshal(credential.Data, &data); err != nil {
+			log.Printf("Error decoding passkey %d: %v", credential.ID, err)
+			continue
+		}
+		result.credentials = append(result.credentials, data)
+	}
+
+	if len(user.PasskeyHandle) == 0 {
+		if err := assignPasskeyHandle(&result.user, len(stored) > 0); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// назначает пользователю идентификатор WebAuthn. Аутентификатор хранит его в ключе и
+// возвращает при входе, поэтому он случаен и не раскрывает номер учетной записи.
+// Ключи, созданные раньше, хранят номер учетной записи: он остается идентификатором
+// таких пользователей, иначе их ключи перестали бы подходить
+func assignPasskeyHandle(user *models.User, legacy bool) error {
+	handle := []byte(strconv.FormatUint(uint64(user.ID), 10))
+	if !legacy {
+		handle = make([]byte, 32)
+		if _, err := rand.Read(handle); err != nil {
+			return err
+		}
+	}
+
+	result := database.DB.Model(user).Where("passkey_handle IS NULL").UpdateColumn("passkey_handle", handle)
+	if result.Error != nil {
+		return result.Error
+	}
+	// идентификатор мог назначить параллельный запрос
+	if result.RowsAffected == 0 {
+		return database.DB.Select("passkey_handle").First(user, user.ID).Error
+	}
+	user.PasskeyHandle = handle
+	return nil
+}
+
+// сохраняет состояние церемонии на сервере; браузер получает только случайный ID в cookie
+func setPasskeySession(c *gin.Context, kind string, userID uint, session *webauthn.SessionData) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return err
+	}
+	id := hex.EncodeToString(raw)
+
+	// заодно удаляются брошенные церемонии
+	database.DB.Where("expires_at < ?", time.Now()).Delete(&models.WebAuthnSession{})
+
+	stored := models.WebAuthnSession{
+		ID:        id,
+		Kind:      kind,
+		UserID:    userID,
+		Data:      data,
+		ExpiresAt: time.Now().Add(passkeySessionTTL),
+	}
+	if err := database.DB.Create(&stored).Error; err != nil {
+		return err
+	}
+
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie(kind, id, int(passkeySessionTTL.Seconds()), "/api", "", strings.HasPrefix(config.PublicURL, "https://"), true)
+	return nil
+}
+
+// забирает состояние церемонии. Запись удаляется до проверки ответа аутентификатора,
+// так что каждый challenge можно использовать только один раз, даже при неудаче
+func takePasskeySession(c *gin.Context, kind string, userID uint) (*webauthn.SessionData, error) {
+	id, err := c.Cookie(kind)
+	c.SetCookie(kind, "", -1, "/api", "", strings.HasPrefix(config.PublicURL, "https://"), true)
+	if err != nil {
+		return nil, err
+	}
+
+	var stored models.WebAuthnSession
+	if err := database.DB.Where("id = ? AND kind = ?", id, kind).First(&stored).Error; err != nil {
+		return nil, errPasskeySessionInvalid
+	}
+	// при одновременных запросах с одним ID запись удалит только один из них
+	result := database.DB.Where("id = ?", id).Delete(&models.WebAuthnSession{})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return nil, errPasskeySessionInvalid
+	}
+	if time.Now().After(stored.ExpiresAt) || stored.UserID != userID {
+		return nil, errPasskeySessionInvalid
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal(stored.Data, &session); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// начинает регистрацию нового ключа доступа для текущего пользователя
+func BeginPasskeyRegistrationHandler(c *gin.Context) {
+	wa, err := getWebAuthn()
+	if err != nil {
+		log.Printf("Error configuring WebAuthn: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	user, err := loadPasskeyUser(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(user.credentials))
+	for _, credential := range user.credentials {
+		exclusions = append(exclusions, credential.Descriptor())
+	}
+
+	options, session, err := wa.BeginRegistration(user,
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementRequired),
+		webauthn.WithExclusions(exclusions),
+	)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	if err := setPasskeySession(c, passkeyRegisterCookie, user.user.ID, session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey registration"})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// завершает регистрацию ключа доступа; тело запроса - ответ аутентификатора
+func FinishPasskeyRegistrationHandler(c *gin.Context) {
+	wa, err := getWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	session, err := takePasskeySession(c, passkeyRegisterCookie, c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey registration expired, please try again"})
+		return
+	}
+
+	user, err := loadPasskeyUser(c.GetUint("user_id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	credential, err := wa.FinishRegistration(user, *session, c.Request)
+	if err != nil {
+		log.Printf("Passkey registration failed for user %d: %v", user.user.ID, err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey registration failed"})
+		return
+	}
+
+	data, err := json.Marshal(credential)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save passkey"})
+		return
+	}
+
+	name := strings.TrimSpace(c.Query("name"))
+	if name == "" {
+		name = "Passkey " + time.Now().Format("2006-01-02")
+	}
+
+	stored := models.Credential{
+		UserID:       user.user.ID,
+		Name:         name,
+		CredentialID: credential.ID,
+		Data:         data,
+	}
+	if err := database.DB.Create(&stored).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save passkey"})
+		return
+	}
+	audit.Record(c, audit.Event{Action: models.AuditPasskeyAdd, TargetType: "passkey", TargetID: stored.ID, Details: stored.Name})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Passkey registered successfully",
+		"passkey": stored,
+	})
+}
+
+// возвращает ключи доступа текущего пользователя
+func ListPasskeysHandler(c *gin.Context) {
+	var credentials []models.Credential
+	if err := database.DB.Where("user_id = ?", c.GetUint("user_id")).Order("created_at").Find(&credentials).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve passkeys"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"passkeys": credentials,
+		"count":    len(credentials),
+	})
+}
+
+// переименовывает ключ доступа
+func RenamePasskeyHandler(c *gin.Context) {
+	var request struct {
+		Name string `json:"name" binding:"required,max=64"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	credential, ok := findOwnPasskey(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Model(credential).Update("name", strings.TrimSpace(request.Name)).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to rename passkey"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Passkey renamed successfully",
+		"passkey": credential,
+	})
+}
+
+// удаляет ключ доступа
+func DeletePasskeyHandler(c *gin.Context) {
+	credential, ok := findOwnPasskey(c)
+	if !ok {
+		return
+	}
+
+	if err := database.DB.Delete(credential).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete passkey"})
+		return
+	}
+	audit.Record(c, audit.Event{Action: models.AuditPasskeyDelete, TargetType: "passkey", TargetID: credential.ID, Details: credential.Name})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Passkey deleted successfully"})
+}
+
+func findOwnPasskey(c *gin.Context) (*models.Credential, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid passkey ID"})
+		return nil, false
+	}
+
+	var credential models.Credential
+	if err := database.DB.Where("user_id = ?", c.GetUint("user_id")).First(&credential, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Passkey not found"})
+		return nil, false
+	}
+
+	return &credential, true
+}
+
+// начинает вход по ключу доступа без ввода имени пользователя
+func BeginPasskeyLoginHandler(c *gin.Context) {
+	wa, err := getWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	options, session, err := wa.BeginDiscoverableLogin()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	if err := setPasskeySession(c, passkeyLoginCookie, 0, session); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start passkey login"})
+		return
+	}
+
+	c.JSON(http.StatusOK, options)
+}
+
+// завершает вход по ключу доступа и выдает такой же JWT, как LoginHandler
+func FinishPasskeyLoginHandler(c *gin.Context) {
+	wa, err := getWebAuthn()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Passkeys are not configured"})
+		return
+	}
+
+	session, err := takePasskeySession(c, passkeyLoginCookie, 0)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Passkey login expired, please try again"})
+		return
+	}
+
+	// userHandle из ответа аутентификатора - это WebAuthnID пользователя
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		var user models.User
+		err := database.DB.Select("id").Where("passkey_handle = ?", userHandle).First(&user).Error
+		// ключи, созданные до появления случайных идентификаторов, хранят номер учетной записи
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			userID, parseErr := strconv.ParseUint(string(userHandle), 10, 64)
+			if parseErr != nil {
+				return nil, err
+			}
+			err = database.DB.Select("id").Where("passkey_handle IS NULL").First(&user, userID).Error
+		}
+		if err != nil {
+			return nil, err
+		}
+		return loadPasskeyUser(user.ID)
+	}
+
+	found, credential, err := wa.FinishPasskeyLogin(handler, *session, c.Request)
+	if err != nil {
+		log.Printf("Passkey login failed: %v", err)
+		audit.Record(c, audit.Event{Action: models.AuditLoginFailed, Details: "passkey: " + err.Error()})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	user := found.(*passkeyUser).user
+
+	// счетчик подписей не вырос: ключ, вероятно, клонирован. Предупреждение сохраняется
+	// вместе с ключом, и он больше не принимается, пока владелец не зарегистрирует новый
+	if credential.Authenticator.CloneWarning {
+		if data, err := json.Marshal(credential); err == nil {
+			database.DB.Model(&models.Credential{}).Where("credential_id = ?", credential.ID).UpdateColumn("data", data)
+		}
+		log.Printf("Passkey login rejected for user %d: signature counter did not increase", user.ID)
+		audit.RecordAs(c, user.ID, audit.Event{Action: models.AuditLoginFailed, TargetType: "user", TargetID: user.ID, Details: "passkey: possible cloned authenticator"})
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+
+	if user.Status == models.UserStatusPending {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is pending approval"})
+		return
+	}
+	if rejectBanned(c, &user) {
+		return
+	}
+
+	// сохранение счетчика подписей для обнаружения клонированных ключей
+	if data, err := json.Marshal(credential); err == nil {
+		now := time.Now()
+		database.DB.Model(&models.Credential{}).
+			Where("credential_id = ?", credential.ID).
+			Updates(map[string]interface{}{"data": data, "last_used_at": now})
+	}
+
+	if err := database.DB.Model(&user).UpdateColumn("last_active", time.Now()).Error; err != nil {
+		log.Printf("Error updating user last active time on passkey login: %v", err)
+	}
+
+	tokenString, err := issueToken(&user)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+	auditLogin(c, &user, "passkey")
+
+	c.JSON(http.StatusOK, AuthResponse{
+		Token:         tokenString,
+		Username:      user.Username,
+		EmailVerified: user.EmailVerified,
+		Message:       "Login successful",
+	})
+}
@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+var b64 = base64.RawURLEncoding
+
+// программный аутентификатор: один ключ ES256 и счетчик подписей
+type softAuthenticator struct {
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	counter      uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{key: key, credentialID: id}
+}
+
+// данные аутентификатора: хеш RP ID, флаги (UP, UV и AT при регистрации) и счетчик
+func (a *softAuthenticator) authenticatorData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(config.WebAuthnRPID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, a.counter)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, ceremony, challenge string) []byte {
+	t.Helper()
+	data, err := json.Marshal(map[string]string{"type": ceremony, "challenge": challenge, "origin": config.PublicURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// отвечает на параметры регистрации аттестацией формата none
+func (a *softAuthenticator) register(t *testing.T, options []byte) []byte {
+	t.Helper()
+	var creation struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+			User      struct {
+				ID string `json:"id"`
+			} `json:"user"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal(options, &creation); err != nil {
+		t.Fatal(err)
+	}
+	handle, err := b64.DecodeString(creation.PublicKey.User.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.userHandle = handle
+
+	publicKey, err := webauthncbor.Marshal(map[int]interface{}{
+		1: 2, 3: -7, -1: 1,
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	authData := a.authenticatorData(0x45)
+	authData = append(authData, make([]byte, 16)...) // AAGUID
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(append(authData, a.credentialID...), publicKey...)
+
+	attestation, err := webauthncbor.Marshal(map[string]interface{}{"fmt": "none", "attStmt": map[string]interface{}{}, "authData": authData})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64.EncodeToString(a.clientData(t, "webauthn.create", creation.PublicKey.Challenge)),
+		"attestationObject": b64.EncodeToString(attestation),
+	})
+}
+
+// подписывает challenge входа, увеличивая счетчик на step
+func (a *softAuthenticator) assert(t *testing.T, options []byte, step int) []byte {
+	t.Helper()
+	var assertion struct {
+		PublicKey struct {
+			Challenge string `json:"challenge"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal(options, &assertion); err != nil {
+		t.Fatal(err)
+	}
+
+	a.counter = uint32(int(a.counter) + step)
+	authData := a.authenticatorData(0x05)
+	clientData := a.clientData(t, "webauthn.get", assertion.PublicKey.Challenge)
+	clientDataHash := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(bytes.Clone(authData), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return a.credential(t, map[string]string{
+		"clientDataJSON":    b64.EncodeToString(clientData),
+		"authenticatorData": b64.EncodeToString(authData),
+		"signature":         b64.EncodeToString(signature),
+		"userHandle":        b64.EncodeToString(a.userHandle),
+	})
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]string) []byte {
+	t.Helper()
+	id := b64.EncodeToString(a.credentialID)
+	data, err := json.Marshal(map[string]interface{}{"id": id, "rawId": id, "type": "public-key", "response": response})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func setupPasskeys(t *testing.T) (*gin.Engine, *models.User) {
+	t.Helper()
+	setupTestDB(t)
+	user := createTestUser(t, "alice")
+
+	router := gin.New()
+	asUser := func(c *gin.Context) { c.Set("user_id", user.ID) }
+	router.POST("/api/account/passkeys/register/begin", asUser, BeginPasskeyRegistrationHandler)
+	router.POST("/api/account/passkeys/register/finish", asUser, FinishPasskeyRegistrationHandler)
+	router.POST("/api/auth/passkey/login/begin", BeginPasskeyLoginHandler)
+	router.POST("/api/auth/passkey/login/finish", FinishPasskeyLoginHandler)
+	return router, user
+}
+
+// начинает церемонию и возвращает ее параметры и cookie состояния
+func beginCeremony(t *testing.T, router *gin.Engine, path string) ([]byte, *http.Cookie) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, path, nil))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("%s status = %d: %s", path, recorder.Code, recorder.Body)
+	}
+	cookies := recorder.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("%s set %d cookies, want 1", path, len(cookies))
+	}
+	return recorder.Body.Bytes(), cookies[0]
+}
+
+func finishCeremony(router *gin.Engine, path string, cookie *http.Cookie, body []byte) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.AddCookie(cookie)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func registerPasskey(t *testing.T, router *gin.Engine, authenticator *softAuthenticator) {
+	t.Helper()
+	options, cookie := beginCeremony(t, router, "/api/account/passkeys/register/begin")
+	recorder := finishCeremony(router, "/api/account/passkeys/register/finish", cookie, authenticator.register(t, options))
+	if recorder.Code != http.StatusCreated {
+		t.Fatalf("registration status = %d: %s", recorder.Code, recorder.Body)
+	}
+}
+
+func loginWithPasskey(t *testing.T, router *gin.Engine, authenticator *softAuthenticator, step int) *httptest.ResponseRecorder {
+	t.Helper()
+	options, cookie := beginCeremony(t, router, "/api/auth/passkey/login/begin")
+	return finishCeremony(router, "/api/auth/passkey/login/finish", cookie, authenticator.assert(t, options, step))
+}
+
+func TestPasskeyRegisterAndLogin(t *testing.T) {
+	router, user := setupPasskeys(t)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, router, authenticator)
+
+	// идентификатор пользователя в ключе случаен и не совпадает с номером учетной записи
+	if len(authenticator.userHandle) != 32 || bytes.Equal(authenticator.userHandle, []byte("1")) {
+		t.Fatalf("user handle = %q, want 32 random bytes", authenticator.userHandle)
+	}
+	var stored models.User
+	database.DB.First(&stored, user.ID)
+	if !bytes.Equal(stored.PasskeyHandle, authenticator.userHandle) {
+		t.Fatal("user handle was not stored")
+	}
+
+	recorder := loginWithPasskey(t, router, authenticator, 1)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("login status = %d: %s", recorder.Code, recorder.Body)
+	}
+	var response AuthResponse
+	json.Unmarshal(recorder.Body.Bytes(), &response)
+	if response.Token == "" || response.Username != "alice" {
+		t.Fatalf("login response = %+v", response)
+	}
+
+	var credential models.Credential
+	database.DB.First(&credential)
+	if credential.LastUsedAt == nil {
+		t.Fatal("last_used_at was not updated")
+	}
+}
+
+func TestPasskeyRegistrationCannotBeReplayed(t *testing.T) {
+	router, _ := setupPasskeys(t)
+	authenticator := newSoftAuthenticator(t)
+
+	options, cookie := beginCeremony(t, router, "/api/account/passkeys/register/begin")
+	response := authenticator.register(t, options)
+	if recorder := finishCeremony(router, "/api/account/passkeys/register/finish", cookie, response); recorder.Code != http.StatusCreated {
+		t.Fatalf("registration status = %d: %s", recorder.Code, recorder.Body)
+	}
+	if recorder := finishCeremony(router, "/api/account/passkeys/register/finish", cookie, response); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("replayed registration status = %d, want 400", recorder.Code)
+	}
+}
+
+func TestPasskeyLoginCannotBeReplayed(t *testing.T) {
+	router, _ := setupPasskeys(t)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, router, authenticator)
+
+	options, cookie := beginCeremony(t, router, "/api/auth/passkey/login/begin")
+	assertion := authenticator.assert(t, options, 1)
+	if recorder := finishCeremony(router, "/api/auth/passkey/login/finish", cookie, assertion); recorder.Code != http.StatusOK {
+		t.Fatalf("login status = %d: %s", recorder.Code, recorder.Body)
+	}
+
+	// перехваченные ответ и cookie: challenge уже использован
+	if recorder := finishCeremony(router, "/api/auth/passkey/login/finish", cookie, assertion); recorder.Code != http.StatusBadRequest {
+		t.Fatalf("replay with the same session status = %d, want 400", recorder.Code)
+	}
+
+	// тот же ответ с новой церемонией не подходит к ее challenge
+	_, fresh := beginCeremony(t, router, "/api/auth/passkey/login/begin")
+	if recorder := finishCeremony(router, "/api/auth/passkey/login/finish", fresh, assertion); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("replay with a new session status = %d, want 401", recorder.Code)
+	}
+
+	var sessions int64
+	database.DB.Model(&models.WebAuthnSession{}).Count(&sessions)
+	if sessions != 0 {
+		t.Fatalf("%d ceremony sessions left after use, want 0", sessions)
+	}
+}
+
+func TestPasskeyLoginRejectsSignCountRegression(t *testing.T) {
+	router, _ := setupPasskeys(t)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, router, authenticator)
+
+	if recorder := loginWithPasskey(t, router, authenticator, 5); recorder.Code != http.StatusOK {
+		t.Fatalf("login status = %d: %s", recorder.Code, recorder.Body)
+	}
+
+	// копия ключа подписывает со старым значением счетчика
+	if recorder := loginWithPasskey(t, router, authenticator, -2); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("login with a lower counter status = %d, want 401", recorder.Code)
+	}
+
+	// помеченный ключ больше не принимается, даже если счетчик снова растет
+	if recorder := loginWithPasskey(t, router, authenticator, 10); recorder.Code != http.StatusUnauthorized {
+		t.Fatalf("login after clone warning status = %d, want 401", recorder.Code)
+	}
+}
+
+func TestPasskeyLoginWithLegacyUserHandle(t *testing.T) {
+	router, user := setupPasskeys(t)
+	authenticator := newSoftAuthenticator(t)
+	registerPasskey(t, router, authenticator)
+
+	// ключ создан, когда идентификатором был номер учетной записи
+	legacy := []byte("1")
+	database.DB.Model(user).UpdateColumn("passkey_handle", nil)
+	authenticator.userHandle = legacy
+
+	if recorder := loginWithPasskey(t, router, authenticator, 1); recorder.Code != http.StatusOK {
+		t.Fatalf("login status = %d: %s", recorder.Code, recorder.Body)
+	}
+	var stored models.User
+	database.DB.First(&stored, user.ID)
+	if !bytes.Equal(stored.PasskeyHandle, legacy) {
+		t.Fatalf("handle = %q, want the legacy %q", stored.PasskeyHandle, legacy)
+	}
+}
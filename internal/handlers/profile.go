@@ -1,18 +1,20 @@
 package handlers
 
 import (
-	"fmt"
 	"net/http"
+	"realtime_chat_platform/internal/audit"
 	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/fileurl"
 	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/password"
+	"realtime_chat_platform/internal/quota"
 
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // возвращает профиль текущего пользователя
 func GetProfileHandler(c *gin.Context) {
-	uid := c.GetInt("user_id")
+	uid := c.GetUint("user_id")
 	if uid == 0 {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
@@ -24,22 +26,31 @@ func GetProfileHandler(c *gin.Context) {
 		return
 	}
 
-	fmt.Printf("Loading profile for user %d: avatar=%s\n", uid, user.Avatar)
+	// адрес, ожидающий подтверждения
+	pendingEmail := ""
+	var pending models.EmailVerification
+	if err := database.DB.Where("user_id = ?", user.ID).Order("created_at desc").First(&pending).Error; err == nil {
+		pendingEmail = pending.Email
+	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":          user.ID,
-		"username":    user.Username,
-		"nickname":    user.Nickname,
-		"avatar":      user.Avatar,
-		"bio":         user.Bio,
-		"last_active": user.LastActive,
-		"created_at":  user.CreatedAt,
+		"id":              user.ID,
+		"username":        user.Username,
+		"nickname":        user.Nickname,
+		"avatar":          fileurl.Sign(user.AvatarURL(), user.ID),
+		"avatar_variants": fileurl.SignAll(user.AvatarVariants(), user.ID),
+		"bio":             user.Bio,
+		"email":           user.Email,
+		"email_verified":  user.EmailVerified,
+		"pending_email":   pendingEmail,
+		"last_active":     user.LastActive,
+		"created_at":      user.CreatedAt,
 	})
 }
 
 // обновляет информацию о профиле пользователя
 func UpdateProfileHandler(c *gin.Context) {
-	uid := c.GetInt("user_id")
+	uid := c.GetUint("user_id")
 	if uid == 0 {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
@@ -75,27 +86,41 @@ func UpdateProfileHandler(c *gin.Context) {
 	}
 
 	if len(updates) > 0 {
+		before := map[string]interface{}{
+			"nickname": user.Nickname,
+			"avatar":   user.Avatar,
+			"bio":      user.Bio,
+		}
 		if err := database.DB.Model(&user).Updates(updates).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 			return
 		}
+		if changes := audit.Diff(before, updates); len(changes) > 0 {
+			audit.Record(c, audit.Event{Action: models.AuditProfileUpdate, TargetType: "user", TargetID: user.ID, Changes: changes})
+		}
+		// загруженный раньше аватар заменен внешним адресом и больше не занимает квоту
+		if changed, ok := updates["avatar"]; ok && changed != before["avatar"] && user.AvatarSize > 0 {
+			quota.ReleaseUser(user.ID, user.AvatarSize)
+			database.DB.Model(&user).UpdateColumn("avatar_size", 0)
+		}
 	}
 
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Profile updated successfully",
 		"profile": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-			"nickname": user.Nickname,
-			"avatar":   user.Avatar,
-			"bio":      user.Bio,
+			"id":              user.ID,
+			"username":        user.Username,
+			"nickname":        user.Nickname,
+			"avatar":          fileurl.Sign(user.AvatarURL(), user.ID),
+			"avatar_variants": fileurl.SignAll(user.AvatarVariants(), user.ID),
+			"bio":             user.Bio,
 		},
 	})
 }
 
 // позволяет пользователям изменять свой пароль
 func ChangePasswordHandler(c *gin.Context) {
-	uid := c.GetInt("user_id")
+	uid := c.GetUint("user_id")
 	if uid == 0 {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
 		return
@@ -103,7 +128,7 @@ func ChangePasswordHandler(c *gin.Context) {
 
 	var request struct {
 		CurrentPassword string `json:"current_password" binding:"required"`
-		NewPassword     string `json:"new_password" binding:"required,min=6"`
+		NewPassword     string `json:"new_password" binding:"required"`
 	}
 
 	if err := c.ShouldBindJSON(&request); err != nil {
@@ -117,21 +142,27 @@ func ChangePasswordHandler(c *gin.Context) {
 		return
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(request.CurrentPassword)); err != nil {
+	if ok, _, err := password.Verify(user.Password, request.CurrentPassword); err != nil || !ok {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Current password is incorrect"})
 		return
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(request.NewPassword), bcrypt.DefaultCost)
+	if err := password.DefaultPolicy.Validate(request.NewPassword); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	hashedPassword, err := password.Hash(request.NewPassword)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to hash password"})
 		return
 	}
 
-	if err := database.DB.Model(&user).Update("password", string(hashedPassword)).Error; err != nil {
+	if err := database.DB.Model(&user).Update("password", hashedPassword).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update password"})
 		return
 	}
+	audit.Record(c, audit.Event{Action: models.AuditPasswordChange, TargetType: "user", TargetID: user.ID})
 
 	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
@@ -151,12 +182,13 @@ func GetUserProfileHandler(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"id":          user.ID,
-		"username":    user.Username,
-		"nickname":    user.Nickname,
-		"avatar":      user.Avatar,
-		"bio":         user.Bio,
-		"last_active": user.LastActive,
-		"created_at":  user.CreatedAt,
+		"id":              user.ID,
+		"username":        user.Username,
+		"nickname":        user.Nickname,
+		"avatar":          fileurl.Sign(user.AvatarURL(), c.GetUint("user_id")),
+		"avatar_variants": fileurl.SignAll(user.AvatarVariants(), c.GetUint("user_id")),
+		"bio":             user.Bio,
+		"last_active":     user.LastActive,
+		"created_at":      user.CreatedAt,
 	})
 }
@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/moderation"
+	"realtime_chat_platform/internal/rbac"
+	"realtime_chat_platform/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// отправляет жалобу на сообщение в очередь модерации
+func ReportMessageHandler(c *gin.Context) {
+	var request struct {
+		Reason string `json:"reason" binding:"required,max=500"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Reason is required"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid message ID"})
+		return
+	}
+
+	var message models.Message
+	if err := database.DB.First(&message, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Message not found"})
+		return
+	}
+
+	reporterID := c.GetUint("user_id")
+	var existing int64
+	database.DB.Model(&models.Report{}).
+		Where("message_id = ? AND reporter_id = ? AND status = ?", message.ID, reporterID, models.ReportOpen).
+		Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "You have already reported this message"})
+		return
+	}
+
+	report, err := moderation.FileReport(message.ID, reporterID, strings.TrimSpace(request.Reason))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create report"})
+		return
+	}
+
+	database.DB.First(&report.Reporter, reporterID)
+	websocket.GlobalHub.NotifyModerators(websocket.NoticeEvent{
+		Type:      "report_created",
+		MessageID: message.ID,
+		Reason:    report.Reason,
+		Report:    reportPayload(report, &message, 0),
+	})
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":   "Report submitted",
+		"report_id": report.ID,
+	})
+}
+
+// возвращает очередь жалоб; по умолчанию только открытые
+func ListReportsHandler(c *gin.Context) {
+	status := c.DefaultQuery("status", models.ReportOpen)
+	contextSize := contextSizeQuery(c)
+
+	query := database.DB.Preload("Reporter").Order("created_at")
+	if status != "all" {
+		query = query.Where("status = ?", status)
+	}
+
+	var reports []models.Report
+	if err := query.Limit(100).Find(&reports).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve reports"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(reports))
+	for i := range reports {
+		var message models.Message
+		database.DB.Unscoped().First(&message, reports[i].MessageID)
+		result = append(result, reportPayload(&reports[i], &message, contextSize))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"reports": result,
+		"count":   len(result),
+	})
+}
+
+// возвращает одну жалобу с контекстом сообщения
+func GetReportHandler(c *gin.Context) {
+	report, message, ok := findReport(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, reportPayload(report, message, contextSizeQuery(c)))
+}
+
+// разбирает жалобу: удаляет сообщение, предупреждает или мьютит автора, либо отклоняет жалобу
+func ResolveReportHandler(c *gin.Context) {
+	var request struct {
+		Action          string `json:"action" binding:"required,oneof=delete warn mute dismiss"`
+		Reason          string `json:"reason" binding:"max=500"`
+		DurationMinutes int    `json:"duration_minutes" binding:"min=0"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Action must be one of delete, warn, mute, dismiss"})
+		return
+	}
+
+	report, message, ok := findReport(c)
+	if !ok {
+		return
+	}
+
+	if report.Status != models.ReportOpen {
+		c.JSON(http.StatusConflict, gin.H{"error": "Report is already resolved"})
+		return
+	}
+
+	moderatorID := c.GetUint("user_id")
+	reason := request.Reason
+	if reason == "" {
+		reason = report.Reason
+	}
+
+	switch request.Action {
+	case models.ResolutionDelete:
+		if !rbac.Can(c.GetString("role"), rbac.MessagesDeleteAny) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied: " + string(rbac.MessagesDeleteAny)})
+			return
+		}
+		if err := database.DB.Delete(message).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete message"})
+			return
+		}
+		// вложения удаленного сообщения больше никому не доступны и не должны занимать квоты
+		var attachments []models.Attachment
+		database.DB.Where("message_id = ?", message.ID).Find(&attachments)
+		if err := deleteAttachments(attachments, message.RoomID); err != nil {
+			log.Printf("Error deleting attachments of message %d: %v", message.ID, err)
+		}
+		websocket.GlobalHub.Broadcast(websocket.NoticeEvent{Type: "message_deleted", MessageID: message.ID})
+		audit.Record(c, audit.Event{
+			Action:     models.AuditMessageDelete,
+			TargetType: "message",
+			TargetID:   message.ID,
+			Changes:    audit.Changes{"content": {Before: message.Content, After: nil}},
+			Details:    "author=" + message.Username + " report=" + strconv.Itoa(int(report.ID)),
+		})
+
+	case models.ResolutionWarn, models.ResolutionMute:
+		var author models.User
+		if err := database.DB.Where("username = ?", message.Username).First(&author).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Message author not found"})
+			return
+		}
+		if !outranks(c, &author) {
+			return
+		}
+
+		if request.Action == models.ResolutionWarn {
+			if _, err := moderation.Record(author.ID, moderatorID, models.ModerationWarn, reason, 0); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to record warning"})
+				return
+			}
+			websocket.GlobalHub.SendToUser(author.ID, websocket.NoticeEvent{Type: "warning", MessageID: message.ID, Reason: reason})
+		} else {
+			duration := time.Duration(request.DurationMinutes) * time.Minute
+			if _, err := moderation.Record(author.ID, moderatorID, models.ModerationMute, reason, duration); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to mute user"})
+				return
+			}
+		}
+	}
+
+	status := models.ReportActioned
+	if request.Action == models.ResolutionDismiss {
+		status = models.ReportDismissed
+	}
+
+	// все открытые жалобы на то же сообщение закрываются одним решением
+	result := database.DB.Model(&models.Report{}).
+		Where("message_id = ? AND status = ?", message.ID, models.ReportOpen).
+		Updates(map[string]interface{}{
+			"status":         status,
+			"resolution":     request.Action,
+			"resolved_by_id": moderatorID,
+			"resolved_at":    time.Now(),
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to resolve report"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     models.AuditReportResolve,
+		TargetType: "report",
+		TargetID:   report.ID,
+		Changes:    audit.Changes{"status": {Before: models.ReportOpen, After: status}},
+		Details:    "action=" + request.Action + " reason=" + reason,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"message":          "Report resolved",
+		"status":           status,
+		"resolved_reports": result.RowsAffected,
+	})
+}
+
+func findReport(c *gin.Context) (*models.Report, *models.Message, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid report ID"})
+		return nil, nil, false
+	}
+
+	var report models.Report
+	if err := database.DB.Preload("Reporter").First(&report, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report not found"})
+		return nil, nil, false
+	}
+
+	// удаленное сообщение остается доступным для разбора
+	var message models.Message
+	if err := database.DB.Unscoped().First(&message, report.MessageID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Reported message not found"})
+		return nil, nil, false
+	}
+
+	return &report, &message, true
+}
+
+func contextSizeQuery(c *gin.Context) int {
+	size, err := strconv.Atoi(c.DefaultQuery("context", "3"))
+	if err != nil || size < 0 || size > 20 {
+		return 3
+	}
+	return size
+}
+
+// собирает жалобу вместе с сообщением и соседними сообщениями той же комнаты
+func reportPayload(report *models.Report, message *models.Message, contextSize int) gin.H {
+	payload := gin.H{
+		"id":                report.ID,
+		"status":            report.Status,
+		"reason":            report.Reason,
+		"resolution":        report.Resolution,
+		"resolved_by_id":    report.ResolvedByID,
+		"resolved_at":       report.ResolvedAt,
+		"created_at":        report.CreatedAt,
+		"reporter_id":       report.ReporterID,
+		"reporter_username": report.Reporter.Username,
+		"message":           contextMessage(message),
+	}
+
+	if contextSize > 0 {
+		var before, after []models.Message
+		database.DB.Unscoped().
+			Where("room_id = ? AND id < ?", message.RoomID, message.ID).
+			Order("id desc").Limit(contextSize).Find(&before)
+		database.DB.Unscoped().
+			Where("room_id = ? AND id > ?", message.RoomID, message.ID).
+			Order("id").Limit(contextSize).Find(&after)
+
+		contextBefore := make([]gin.H, 0, len(before))
+		for i := len(before) - 1; i >= 0; i-- {
+			contextBefore = append(contextBefore, contextMessage(&before[i]))
+		}
+		contextAfter := make([]gin.H, 0, len(after))
+		for i := range after {
+			contextAfter = append(contextAfter, contextMessage(&after[i]))
+		}
+
+		payload["context_before"] = contextBefore
+		payload["context_after"] = contextAfter
+	}
+
+	return payload
+}
+
+func contextMessage(message *models.Message) gin.H {
+	return gin.H{
+		"id":         message.ID,
+		"room_id":    message.RoomID,
+		"username":   message.Username,
+		"content":    message.Content,
+		"created_at": message.CreatedAt.Format("2006-01-02 15:04:05"),
+		"deleted":    message.DeletedAt.Valid,
+	}
+}
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+// возвращает роли и матрицу прав
+func ListRolesHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"roles":       models.Roles,
+		"permissions": rbac.Matrix(),
+	})
+}
+
+// назначает пользователю серверную роль
+func SetUserRoleHandler(c *gin.Context) {
+	var request struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var target models.User
+	if err := database.DB.First(&target, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !rbac.CanAssign(c.GetString("role"), rbac.ServerRole(&target), request.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only assign roles below your own to users below your own role"})
+		return
+	}
+
+	previous := rbac.ServerRole(&target)
+	if err := database.DB.Model(&target).Update("role", request.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     models.AuditRoleChange,
+		TargetType: "user",
+		TargetID:   target.ID,
+		Changes:    audit.Changes{"role": {Before: previous, After: request.Role}},
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Role updated successfully",
+		"user_id": target.ID,
+		"role":    request.Role,
+	})
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/moderation"
+	"realtime_chat_platform/internal/rbac"
+	"realtime_chat_platform/internal/websocket"
+
+	"github.com/gin-gonic/gin"
+)
+
+// возвращает список комнат
+func ListRoomsHandler(c *gin.Context) {
+	var rooms []models.Room
+	if err := database.DB.Order("name").Find(&rooms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve rooms"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"rooms": rooms,
+		"count": len(rooms),
+	})
+}
+
+// создает комнату; создатель становится ее владельцем
+func CreateRoomHandler(c *gin.Context) {
+	var request struct {
+		Name        string `json:"name" binding:"required,max=64"`
+		Description string `json:"description" binding:"max=256"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	name := strings.TrimSpace(request.Name)
+	var existing models.Room
+	if err := database.DB.Where("name = ?", name).First(&existing).Error; err == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Room already exists"})
+		return
+	}
+
+	room := models.Room{
+		Name:        name,
+		Description: request.Description,
+		CreatedByID: c.GetUint("user_id"),
+	}
+	if err := database.DB.Create(&room).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create room"})
+		return
+	}
+
+	owner := models.RoomMember{RoomID: room.ID, UserID: room.CreatedByID, Role: models.RoleOwner}
+	if err := database.DB.Create(&owner).Error; err != nil {
+		log.Printf("Error adding room owner: %v", err)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Room created successfully",
+		"room":    room,
+	})
+}
+
+// возвращает участников комнаты с ролями
+func ListRoomMembersHandler(c *gin.Context) {
+	room, ok := findRoom(c)
+	if !ok {
+		return
+	}
+
+	var members []models.RoomMember
+	if err := database.DB.Preload("User").Where("room_id = ?", room.ID).Find(&members).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve members"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(members))
+	for _, member := range members {
+		result = append(result, gin.H{
+			"user_id":  member.UserID,
+			"username": member.User.Username,
+			"role":     member.Role,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room":    room,
+		"members": result,
+		"count":   len(result),
+	})
+}
+
+// назначает пользователю роль в комнате
+func SetRoomMemberRoleHandler(c *gin.Context) {
+	var request struct {
+		Role string `json:"role" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	room, ok := findRoom(c)
+	if !ok {
+		return
+	}
+
+	userID, err := strconv.Atoi(c.Param("user_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var target models.User
+	if err := database.DB.First(&target, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !rbac.CanAssign(c.GetString("role"), rbac.EffectiveRole(&target, room.ID), request.Role) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "You can only assign roles below your own to users below your own role"})
+		return
+	}
+
+	previous := rbac.EffectiveRole(&target, room.ID)
+	member := models.RoomMember{RoomID: room.ID, UserID: target.ID}
+	if err := database.DB.Where(&member).Assign(models.RoomMember{Role: request.Role}).FirstOrCreate(&member).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+		return
+	}
+
+	audit.Record(c, audit.Event{
+		Action:     models.AuditRoomRoleChange,
+		TargetType: "user",
+		TargetID:   target.ID,
+		Changes:    audit.Changes{"role": {Before: previous, After: request.Role}},
+		Details:    "room=" + room.Name,
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Role updated successfully",
+		"room_id": room.ID,
+		"user_id": target.ID,
+		"role":    request.Role,
+	})
+}
+
+// меняет медленный режим и ограничение на отправку сообщений
+func UpdateRoomSettingsHandler(c *gin.Context) {
+	var request struct {
+		Description     *string `json:"description" binding:"omitempty,max=256"`
+		SlowModeSeconds *int    `json:"slow_mode_seconds" binding:"omitempty,min=0,max=21600"`
+		PostRole        *string `json:"post_role"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	room, ok := findRoom(c)
+	if !ok {
+		return
+	}
+
+	if request.PostRole != nil && *request.PostRole != "" && !models.ValidRole(*request.PostRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role: " + *request.PostRole})
+		return
+	}
+
+	before := map[string]interface{}{
+		"description":       room.Description,
+		"slow_mode_seconds": room.SlowModeSeconds,
+		"post_role":         room.PostRole,
+	}
+	if request.Description != nil {
+		room.Description = *request.Description
+	}
+	if request.SlowModeSeconds != nil {
+		room.SlowModeSeconds = *request.SlowModeSeconds
+	}
+	if request.PostRole != nil {
+		room.PostRole = *request.PostRole
+	}
+
+	if err := database.DB.Save(room).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update room"})
+		return
+	}
+
+	websocket.GlobalHub.Broadcast(websocket.RoomEvent{Type: "room_updated", Room: room})
+
+	audit.Record(c, audit.Event{
+		Action:     models.AuditRoomUpdate,
+		TargetType: "room",
+		TargetID:   room.ID,
+		Changes: audit.Diff(before, map[string]interface{}{
+			"description":       room.Description,
+			"slow_mode_seconds": room.SlowModeSeconds,
+			"post_role":         room.PostRole,
+		}),
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Room updated successfully",
+		"room":    room,
+	})
+}
+
+// возвращает ограничения комнаты и аккаунта для текущего пользователя, чтобы клиент мог показать обратный отсчет
+func GetRoomLimitsHandler(c *gin.Context) {
+	room, ok := findRoom(c)
+	if !ok {
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+		return
+	}
+
+	role := rbac.EffectiveRole(&user, room.ID)
+	canPost := rbac.Can(role, rbac.MessagesSend) && room.PostingAllowed(role)
+	slowModeExempt := rbac.Can(role, rbac.UsersModerate)
+
+	var wait time.Duration
+	var restriction moderation.Restriction
+	if canPost && !slowModeExempt {
+		wait = websocket.SlowModeWait(room, user.Username)
+		restriction = moderation.Restrictions(user.CreatedAt)
+		wait = max(wait, restriction.CooldownWait(time.Now()))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"room_id":           room.ID,
+		"role":              role,
+		"read_only":         room.ReadOnly(),
+		"post_role":         room.PostRole,
+		"can_post":          canPost,
+		"slow_mode_seconds": room.SlowModeSeconds,
+		"slow_mode_exempt":  slowModeExempt,
+		"retry_after_ms":    wait.Milliseconds(),
+		"new_account":       restriction.NewAccount,
+		"raid_mode":         restriction.RaidMode,
+		"links_allowed":     !restriction.BlockLinks,
+	})
+}
+
+func findRoom(c *gin.Context) (*models.Room, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return nil, false
+	}
+
+	var room models.Room
+	if err := database.DB.First(&room, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return nil, false
+	}
+
+	return &room, true
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"path/filepath"
+	"testing"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// открывает отдельную базу во временном каталоге теста
+func setupTestDB(t *testing.T) {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	database.InitDB()
+}
+
+// создает активного пользователя без пароля
+func createTestUser(t *testing.T, username string) *models.User {
+	t.Helper()
+	user := &models.User{Username: username, Password: "!", Status: models.UserStatusActive}
+	if err := database.DB.Create(user).Error; err != nil {
+		t.Fatalf("create user %s: %v", username, err)
+	}
+	return user
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/moderation"
+	"realtime_chat_platform/internal/oidc"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+const oidcStateCookie = "oidc_state"
+
+// имя ключа подписи cookie входа в таблице secrets; отдельный от ключа JWT сессий
+const oidcStateSecret = "oidc_state"
+
+var (
+	errSSOAccountNotFound = errors.New("no local account is linked to this SSO login")
+	errSSOAccountPending  = errors.New("account is pending approval")
+	errSSOInviteRequired  = errors.New("registration requires an invite")
+	errSSODomainDenied    = errors.New("a verified email from an allowed domain is required")
+
+	invalidUsernameChars = regexp.MustCompile(`[^a-zA-Z0-9._-]+`)
+
+	oidcProvider *oidc.Provider
+	oidcMutex    sync.Mutex
+)
+
+// возвращает провайдера, выполняя discovery при первом обращении
+func getOIDCProvider(ctx context.Context) (*oidc.Provider, error) {
+	oidcMutex.Lock()
+	defer oidcMutex.Unlock()
+
+	if oidcProvider != nil {
+		return oidcProvider, nil
+	}
+
+	provider, err := oidc.Discover(ctx, config.OIDCIssuer, config.OIDCClientID, config.OIDCClientSecret, config.OIDCRedirectURL, config.OIDCScopes)
+	if err != nil {
+		return nil, err
+	}
+
+	oidcProvider = provider
+	return oidcProvider, nil
+}
+
+// сообщает клиенту, какие способы входа включены
+func AuthProvidersHandler(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"password": true,
+		"oidc": gin.H{
+			"enabled": config.OIDCIssuer != "",
+			"name":    config.OIDCProviderName,
+		},
+	})
+}
+
+// перенаправляет пользователя на страницу входа OIDC провайдера
+func OIDCLoginHandler(c *gin.Context) {
+	if config.OIDCIssuer == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SSO is not configured"})
+		return
+	}
+
+	provider, err := getOIDCProvider(c.Request.Context())
+	if err != nil {
+		log.Printf("Error discovering OIDC provider: %v", err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "SSO provider is unavailable"})
+		return
+	}
+
+	state, errState := oidc.RandomString()
+	nonce, errNonce := oidc.RandomString()
+	verifier, errVerifier := oidc.RandomString()
+	if errState != nil || errNonce != nil || errVerifier != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+
+	// state, nonce и PKCE verifier хранятся в подписанной cookie до возврата от провайдера
+	cookie := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"state":    state,
+		"nonce":    nonce,
+		"verifier": verifier,
+		"exp":      time.Now().Add(10 * time.Minute).Unix(),
+	})
+	key, err := database.Secret(oidcStateSecret)
+	if err != nil {
+		log.Printf("Error loading SSO state key: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+	cookieValue, err := cookie.SignedString(key)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start SSO login"})
+		return
+	}
+
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(oidcStateCookie, cookieValue, 600, "/api/auth/oidc", "", strings.HasPrefix(config.PublicURL, "https://"), true)
+	c.Redirect(http.StatusFound, provider.AuthCodeURL(state, nonce, verifier))
+}
+
+// принимает ответ провайдера, сопоставляет учетную запись и выдает JWT
+func OIDCCallbackHandler(c *gin.Context) {
+	if config.OIDCIssuer == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "SSO is not configured"})
+		return
+	}
+
+	cookieValue, err := c.Cookie(oidcStateCookie)
+	c.SetCookie(oidcStateCookie, "", -1, "/api/auth/oidc", "", strings.HasPrefix(config.PublicURL, "https://"), true)
+	if err != nil {
+		ssoRedirectError(c, "SSO session expired, please try again")
+		return
+	}
+
+	stored, err := jwt.Parse(cookieValue, func(token *jwt.Token) (interface{}, error) {
+		return database.Secret(oidcStateSecret)
+	}, jwt.WithValidMethods([]string{"HS256"}))
+	if err != nil || !stored.Valid {
+		ssoRedirectError(c, "SSO session expired, please try again")
+		return
+	}
+	session, _ := stored.Claims.(jwt.MapClaims)
+	state, _ := session["state"].(string)
+	nonce, _ := session["nonce"].(string)
+	verifier, _ := session["verifier"].(string)
+
+	if errParam := c.Query("error"); errParam != "" {
+		ssoRedirectError(c, "SSO login was cancelled: "+errParam)
+		return
+	}
+	if state == "" || c.Query("state") != state {
+		ssoRedirectError(c, "Invalid SSO state")
+		return
+	}
+
+	provider, err := getOIDCProvider(c.Request.Context())
+	if err != nil {
+		log.Printf("Error discovering OIDC provider: %v", err)
+		ssoRedirectError(c, "SSO provider is unavailable")
+		return
+	}
+
+	rawIDToken, err := provider.Exchange(c.Request.Context(), c.Query("code"), verifier)
+	if err != nil {
+		log.Printf("Error exchanging OIDC code: %v", err)
+		ssoRedirectError(c, "SSO login failed")
+		return
+	}
+
+	claims, err := provider.VerifyIDToken(c.Request.Context(), rawIDToken, nonce)
+	if err != nil {
+		log.Printf("Error verifying OIDC ID token: %v", err)
+		ssoRedirectError(c, "SSO login failed")
+		return
+	}
+
+	user, err := resolveSSOUser(provider.Metadata.Issuer, claims)
+	if err != nil {
+		log.Printf("SSO login rejected for subject %s: %v", claims.Subject, err)
+		audit.Record(c, audit.Event{Action: models.AuditLoginFailed, Details: "oidc subject=" + claims.Subject + ": " + err.Error()})
+		ssoRedirectError(c, "SSO login rejected: "+err.Error())
+		return
+	}
+	if ban := moderation.Active(user.ID, models.ModerationBan); ban != nil {
+		audit.RecordAs(c, user.ID, audit.Event{Action: models.AuditLoginFailed, TargetType: "user", TargetID: user.ID, Details: "account banned"})
+		ssoRedirectError(c, moderation.Describe(ban))
+		return
+	}
+
+	if err := database.DB.Model(user).UpdateColumn("last_active", time.Now()).Error; err != nil {
+		log.Printf("Error updating user last active time on SSO login: %v", err)
+	}
+
+	tokenString, err := issueToken(user)
+	if err != nil {
+		ssoRedirectError(c, "Failed to generate token")
+		return
+	}
+	auditLogin(c, user, "oidc")
+
+	// токен передается во фрагменте, который не попадает в логи сервера
+	fragment := url.Values{"sso_token": {tokenString}, "username": {user.Username}}
+	c.Redirect(http.StatusFound, "/#"+fragment.Encode())
+}
+
+func ssoRedirectError(c *gin.Context, message string) {
+	c.Redirect(http.StatusFound, "/#"+url.Values{"sso_error": {message}}.Encode())
+}
+
+// находит пользователя по связке издатель+subject, при необходимости
+// связывает по подтвержденному email или создает новую учетную запись
+func resolveSSOUser(issuer string, claims *oidc.Claims) (*models.User, error) {
+	var user models.User
+
+	var identity models.Identity
+	err := database.DB.Where("provider = ? AND subject = ?", issuer, claims.Subject).First(&identity).Error
+	if err == nil {
+		if err := database.DB.First(&user, identity.UserID).Error; err != nil {
+			return nil, errSSOAccountNotFound
+		}
+		return checkSSOUser(&user, claims)
+	}
+
+	email := normalizeEmail(claims.Email)
+
+	if config.OIDCLinkByEmail && email != "" && claims.EmailVerified {
+		if err := database.DB.Where("email = ? AND email_verified = ?", email, true).First(&user).Error; err == nil {
+			if err := linkIdentity(database.DB, &user, issuer, claims.Subject); err != nil {
+				return nil, err
+			}
+			return checkSSOUser(&user, claims)
+		}
+	}
+
+	if !config.OIDCAutoProvision {
+		return nil, errSSOAccountNotFound
+	}
+
+	// создание учетной записи подчиняется тем же режимам регистрации, что и RegisterHandler:
+	// приглашение в потоке SSO не передать, а домен проверяется только по подтвержденному адресу
+	switch config.RegistrationMode {
+	case config.RegistrationInvite:
+		return nil, errSSOInviteRequired
+	case config.RegistrationDomain:
+		if email == "" || !claims.EmailVerified || !emailDomainAllowed(email) {
+			return nil, errSSODomainDenied
+		}
+	}
+
+	user = models.User{
+		Username: uniqueUsername(ssoUsername(claims)),
+		Nickname: claims.Name,
+		// без локального пароля вход возможен только через SSO
+		Password:   "!",
+		Status:     models.UserStatusActive,
+		LastActive: time.Now(),
+	}
+	if email != "" && claims.EmailVerified && !emailTaken(email, 0) {
+		user.Email = email
+		user.EmailVerified = true
+	}
+	if config.RegistrationMode == config.RegistrationApproval {
+		user.Status = models.UserStatusPending
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&user).Error; err != nil {
+			return err
+		}
+		return linkIdentity(tx, &user, issuer, claims.Subject)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Provisioned user %s from SSO subject %s", user.Username, claims.Subject)
+	return checkSSOUser(&user, claims)
+}
+
+func linkIdentity(tx *gorm.DB, user *models.User, issuer, subject string) error {
+	return tx.Create(&models.Identity{
+		UserID:   user.ID,
+		Provider: issuer,
+		Subject:  subject,
+	}).Error
+}
+
+// проверяет статус и синхронизирует отображаемое имя при пустом никнейме
+func checkSSOUser(user *models.User, claims *oidc.Claims) (*models.User, error) {
+	if user.Status == models.UserStatusPending {
+		return nil, errSSOAccountPending
+	}
+	if user.Nickname == "" && claims.Name != "" {
+		database.DB.Model(user).UpdateColumn("nickname", claims.Name)
+	}
+	return user, nil
+}
+
+// выбирает имя пользователя из утверждений токена
+func ssoUsername(claims *oidc.Claims) string {
+	candidates := []string{
+		claims.String(config.OIDCUsernameClaim),
+		claims.PreferredUsername,
+	}
+	if local, _, found := strings.Cut(claims.Email, "@"); found {
+		candidates = append(candidates, local)
+	}
+
+	for _, candidate := range candidates {
+		if cleaned := strings.Trim(invalidUsernameChars.ReplaceAllString(candidate, "_"), "_"); cleaned != "" {
+			return cleaned
+		}
+	}
+	return "user"
+}
+
+// добавляет числовой суффикс, если имя уже занято
+func uniqueUsername(base string) string {
+	username := base
+	for i := 2; ; i++ {
+		var count int64
+		database.DB.Unscoped().Model(&models.User{}).Where("username = ?", username).Count(&count)
+		if count == 0 {
+			return username
+		}
+		username = fmt.Sprintf("%s%d", base, i)
+	}
+}
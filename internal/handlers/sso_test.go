@@ -0,0 +1,251 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/oidc/oidctest"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// поднимает тестового провайдера и настраивает на него SSO
+func setupSSO(t *testing.T, registrationMode string) (*oidctest.Issuer, *gin.Engine) {
+	t.Helper()
+	setupTestDB(t)
+
+	issuer := oidctest.New("chat")
+	t.Cleanup(issuer.Close)
+
+	previous := struct {
+		issuer, clientID, redirectURL, mode string
+		autoProvision                       bool
+		domains                             []string
+	}{config.OIDCIssuer, config.OIDCClientID, config.OIDCRedirectURL, config.RegistrationMode, config.OIDCAutoProvision, config.RegistrationDomains}
+	t.Cleanup(func() {
+		config.OIDCIssuer, config.OIDCClientID, config.OIDCRedirectURL = previous.issuer, previous.clientID, previous.redirectURL
+		config.RegistrationMode, config.OIDCAutoProvision, config.RegistrationDomains = previous.mode, previous.autoProvision, previous.domains
+		oidcProvider = nil
+	})
+
+	config.OIDCIssuer = issuer.URL
+	config.OIDCClientID = "chat"
+	config.OIDCRedirectURL = "http://chat.test/api/auth/oidc/callback"
+	config.OIDCAutoProvision = true
+	config.RegistrationMode = registrationMode
+	config.RegistrationDomains = []string{"corp.test"}
+	oidcProvider = nil
+
+	router := gin.New()
+	router.GET("/api/auth/oidc/login", OIDCLoginHandler)
+	router.GET("/api/auth/oidc/callback", OIDCCallbackHandler)
+	return issuer, router
+}
+
+// начинает вход и возвращает cookie с state и адрес страницы провайдера
+func startSSOLogin(t *testing.T, router *gin.Engine) (*http.Cookie, string) {
+	t.Helper()
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/api/auth/oidc/login", nil))
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("login status = %d: %s", recorder.Code, recorder.Body)
+	}
+
+	for _, cookie := range recorder.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			return cookie, recorder.Header().Get("Location")
+		}
+	}
+	t.Fatal("login did not set the state cookie")
+	return nil, ""
+}
+
+// завершает вход и возвращает параметры из фрагмента адреса перенаправления
+func finishSSOLogin(t *testing.T, router *gin.Engine, cookie *http.Cookie, code, state string) url.Values {
+	t.Helper()
+	request := httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback?"+url.Values{"code": {code}, "state": {state}}.Encode(), nil)
+	request.AddCookie(cookie)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusFound {
+		t.Fatalf("callback status = %d: %s", recorder.Code, recorder.Body)
+	}
+
+	_, fragment, _ := strings.Cut(recorder.Header().Get("Location"), "#")
+	values, err := url.ParseQuery(fragment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return values
+}
+
+func ssoLogin(t *testing.T, issuer *oidctest.Issuer, router *gin.Engine, claims jwt.MapClaims) url.Values {
+	t.Helper()
+	cookie, authURL := startSSOLogin(t, router)
+	code, state, err := issuer.Authorize(authURL, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return finishSSOLogin(t, router, cookie, code, state)
+}
+
+func TestOIDCLoginProvisionsUser(t *testing.T) {
+	issuer, router := setupSSO(t, config.RegistrationOpen)
+
+	claims := jwt.MapClaims{"sub": "subject-1", "preferred_username": "alice", "email": "alice@corp.test", "email_verified": true, "name": "Alice"}
+	result := ssoLogin(t, issuer, router, claims)
+	if result.Get("sso_token") == "" || result.Get("username") != "alice" {
+		t.Fatalf("unexpected result %v", result)
+	}
+
+	var user models.User
+	if err := database.DB.Where("username = ?", "alice").First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "alice@corp.test" || !user.EmailVerified || user.Nickname != "Alice" {
+		t.Fatalf("provisioned user = %+v", user)
+	}
+
+	// повторный вход находит ту же учетную запись по связке издатель+subject
+	result = ssoLogin(t, issuer, router, claims)
+	if result.Get("username") != "alice" {
+		t.Fatalf("second login result %v", result)
+	}
+	var count int64
+	database.DB.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("users = %d, want 1", count)
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	issuer, router := setupSSO(t, config.RegistrationOpen)
+
+	cookie, authURL := startSSOLogin(t, router)
+	code, _, err := issuer.Authorize(authURL, jwt.MapClaims{"sub": "subject-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := finishSSOLogin(t, router, cookie, code, "forged-state")
+	if result.Get("sso_error") != "Invalid SSO state" || result.Get("sso_token") != "" {
+		t.Fatalf("unexpected result %v", result)
+	}
+}
+
+// cookie входа подписана своим ключом из базы: ключом JWT из исходного кода ее не подделать
+func TestOIDCCallbackRejectsCookieSignedWithJWTSecret(t *testing.T) {
+	issuer, router := setupSSO(t, config.RegistrationOpen)
+
+	_, authURL := startSSOLogin(t, router)
+	code, state, err := issuer.Authorize(authURL, jwt.MapClaims{"sub": "subject-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(authURL)
+	forged, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"state":    state,
+		"nonce":    parsed.Query().Get("nonce"),
+		"verifier": "forged-verifier",
+		"exp":      time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte(config.JWTSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := finishSSOLogin(t, router, &http.Cookie{Name: oidcStateCookie, Value: forged}, code, state)
+	if result.Get("sso_error") != "SSO session expired, please try again" || result.Get("sso_token") != "" {
+		t.Fatalf("unexpected result %v", result)
+	}
+}
+
+func TestOIDCCallbackRejectsNonceMismatch(t *testing.T) {
+	issuer, router := setupSSO(t, config.RegistrationOpen)
+
+	cookie, authURL := startSSOLogin(t, router)
+	// провайдер выдает токен для другого nonce, например перехваченный из чужого входа
+	parsed, _ := url.Parse(authURL)
+	query := parsed.Query()
+	query.Set("nonce", "other-nonce")
+	parsed.RawQuery = query.Encode()
+
+	code, state, err := issuer.Authorize(parsed.String(), jwt.MapClaims{"sub": "subject-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := finishSSOLogin(t, router, cookie, code, state)
+	if result.Get("sso_error") != "SSO login failed" || result.Get("sso_token") != "" {
+		t.Fatalf("unexpected result %v", result)
+	}
+}
+
+func TestOIDCProvisioningFollowsRegistrationMode(t *testing.T) {
+	tests := []struct {
+		name      string
+		mode      string
+		claims    jwt.MapClaims
+		wantError string
+		wantUser  bool
+	}{
+		{
+			name:      "invite mode rejects unknown subjects",
+			mode:      config.RegistrationInvite,
+			claims:    jwt.MapClaims{"sub": "s", "preferred_username": "bob", "email": "bob@corp.test", "email_verified": true},
+			wantError: errSSOInviteRequired.Error(),
+		},
+		{
+			name:      "domain mode rejects other domains",
+			mode:      config.RegistrationDomain,
+			claims:    jwt.MapClaims{"sub": "s", "preferred_username": "bob", "email": "bob@evil.test", "email_verified": true},
+			wantError: errSSODomainDenied.Error(),
+		},
+		{
+			name:      "domain mode rejects unverified email",
+			mode:      config.RegistrationDomain,
+			claims:    jwt.MapClaims{"sub": "s", "preferred_username": "bob", "email": "bob@corp.test", "email_verified": false},
+			wantError: errSSODomainDenied.Error(),
+		},
+		{
+			name:     "domain mode accepts allowed domain",
+			mode:     config.RegistrationDomain,
+			claims:   jwt.MapClaims{"sub": "s", "preferred_username": "bob", "email": "bob@corp.test", "email_verified": true},
+			wantUser: true,
+		},
+		{
+			name:      "approval mode creates a pending account",
+			mode:      config.RegistrationApproval,
+			claims:    jwt.MapClaims{"sub": "s", "preferred_username": "bob"},
+			wantError: errSSOAccountPending.Error(),
+			wantUser:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			issuer, router := setupSSO(t, tt.mode)
+
+			result := ssoLogin(t, issuer, router, tt.claims)
+			if tt.wantError != "" {
+				if !strings.Contains(result.Get("sso_error"), tt.wantError) || result.Get("sso_token") != "" {
+					t.Fatalf("result %v, want error %q", result, tt.wantError)
+				}
+			} else if result.Get("sso_token") == "" {
+				t.Fatalf("result %v, want token", result)
+			}
+
+			var count int64
+			database.DB.Model(&models.User{}).Where("username = ?", "bob").Count(&count)
+			if (count == 1) != tt.wantUser {
+				t.Fatalf("user created = %t, want %t", count == 1, tt.wantUser)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/quota"
+
+	"github.com/gin-gonic/gin"
+)
+
+// возвращает место, занятое файлами пользователя, и его квоту
+func GetStorageUsageHandler(c *gin.Context) {
+	var user models.User
+	if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	var attachments struct {
+		Count   int64
+		Pending int64
+	}
+	database.DB.Model(&models.Attachment{}).
+		Select("COUNT(*) AS count, COUNT(*) - COUNT(message_id) AS pending").
+		Where("user_id = ?", user.ID).Scan(&attachments)
+
+	usage := quota.Usage{Used: user.StorageUsed, Quota: quota.UserQuota(&user)}
+	c.JSON(http.StatusOK, gin.H{
+		"used_bytes":          usage.Used,
+		"quota_bytes":         usage.Quota,
+		"remaining_bytes":     usage.Remaining(),
+		"avatar_bytes":        user.AvatarSize,
+		"attachment_bytes":    max(user.StorageUsed-user.AvatarSize, 0),
+		"attachments":         attachments.Count,
+		"pending_attachments": attachments.Pending,
+	})
+}
+
+// запрос на изменение квоты: null возвращает квоту по умолчанию, 0 снимает ограничение
+type quotaRequest struct {
+	QuotaBytes *int64 `json:"quota_bytes"`
+}
+
+// переопределяет квоту пользователя
+func SetUserQuotaHandler(c *gin.Context) {
+	var request quotaRequest
+	if err := c.ShouldBindJSON(&request); err != nil || (request.QuotaBytes != nil && *request.QuotaBytes < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quota_bytes must be null, 0 (unlimited) or a positive number of bytes"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	previous := quota.UserQuota(&user)
+	if err := database.DB.Model(&user).UpdateColumn("storage_quota", request.QuotaBytes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update quota"})
+		return
+	}
+	user.StorageQuota = request.QuotaBytes
+
+	audit.Record(c, audit.Event{
+		Action:     models.AuditQuotaChange,
+		TargetType: "user",
+		TargetID:   user.ID,
+		Changes:    audit.Changes{"quota_bytes": {Before: previous, After: quota.UserQuota(&user)}},
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Quota updated successfully",
+		"user_id":     user.ID,
+		"used_bytes":  user.StorageUsed,
+		"quota_bytes": quota.UserQuota(&user),
+		"override":    user.StorageQuota != nil,
+	})
+}
+
+// переопределяет квоту комнаты
+func SetRoomQuotaHandler(c *gin.Context) {
+	var request quotaRequest
+	if err := c.ShouldBindJSON(&request); err != nil || (request.QuotaBytes != nil && *request.QuotaBytes < 0) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "quota_bytes must be null, 0 (unlimited) or a positive number of bytes"})
+		return
+	}
+
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+		return
+	}
+
+	var room models.Room
+	if err := database.DB.First(&room, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Room not found"})
+		return
+	}
+
+	previous := quota.RoomQuota(&room)
+	if err := database.DB.Model(&room).UpdateColumn("storage_quota", request.QuotaBytes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update quota"})
+		return
+	}
+	room.StorageQuota = request.QuotaBytes
+
+	audit.Record(c, audit.Event{
+		Action:     models.AuditQuotaChange,
+		TargetType: "room",
+		TargetID:   room.ID,
+		Changes:    audit.Changes{"quota_bytes": {Before: previous, After: quota.RoomQuota(&room)}},
+	})
+	c.JSON(http.StatusOK, gin.H{
+		"message":     "Quota updated successfully",
+		"room_id":     room.ID,
+		"used_bytes":  room.StorageUsed,
+		"quota_bytes": quota.RoomQuota(&room),
+		"override":    room.StorageQuota != nil,
+	})
+}
+
+// возвращает пользователей и комнаты, занимающие больше всего места
+func ListStorageConsumersHandler(c *gin.Context) {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	var users []models.User
+	if err := database.DB.Where("storage_used > 0").Order("storage_used desc").Limit(limit).Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load usage"})
+		return
+	}
+	var rooms []models.Room
+	if err := database.DB.Where("storage_used > 0").Order("storage_used desc").Limit(limit).Find(&rooms).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load usage"})
+		return
+	}
+
+	userUsage := make([]gin.H, 0, len(users))
+	for _, user := range users {
+		userUsage = append(userUsage, gin.H{
+			"id":          user.ID,
+			"username":    user.Username,
+			"used_bytes":  user.StorageUsed,
+			"quota_bytes": quota.UserQuota(&user),
+			"override":    user.StorageQuota != nil,
+		})
+	}
+	roomUsage := make([]gin.H, 0, len(rooms))
+	for _, room := range rooms {
+		roomUsage = append(roomUsage, gin.H{
+			"id":          room.ID,
+			"name":        room.Name,
+			"used_bytes":  room.StorageUsed,
+			"quota_bytes": quota.RoomQuota(&room),
+			"override":    room.StorageQuota != nil,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"users": userUsage, "rooms": roomUsage})
+}
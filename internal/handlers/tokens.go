@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/auth"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// возвращает персональные токены текущего пользователя без их значений
+func ListAPITokensHandler(c *gin.Context) {
+	var tokens []models.APIToken
+	if err := database.DB.Where("user_id = ?", c.GetUint("user_id")).Order("created_at desc").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve tokens"})
+		return
+	}
+
+	result := make([]gin.H, 0, len(tokens))
+	for _, token := range tokens {
+		result = append(result, apiTokenPayload(&token))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"tokens": result,
+		"count":  len(result),
+	})
+}
+
+// создает персональный токен; значение возвращается только в этом ответе
+func CreateAPITokenHandler(c *gin.Context) {
+	var request struct {
+		Name          string   `json:"name" binding:"required,max=64"`
+		Scopes        []string `json:"scopes" binding:"required,min=1"`
+		ExpiresInDays int      `json:"expires_in_days" binding:"min=0"`
+	}
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
+		return
+	}
+
+	for _, scope := range request.Scopes {
+		if !validScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":  "Unknown scope: " + scope,
+				"scopes": models.Scopes,
+			})
+			return
+		}
+	}
+
+	value, err := auth.GenerateAPIToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	token := models.APIToken{
+		UserID:    c.GetUint("user_id"),
+		Name:      strings.TrimSpace(request.Name),
+		Prefix:    value[:len(auth.APITokenPrefix)+6],
+		TokenHash: auth.HashAPIToken(value),
+		Scopes:    strings.Join(request.Scopes, " "),
+	}
+	if request.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, request.ExpiresInDays)
+		token.ExpiresAt = &expiresAt
+	}
+
+	if err := database.DB.Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create token"})
+		return
+	}
+	audit.Record(c, audit.Event{Action: models.AuditAPITokenCreate, TargetType: "api_token", TargetID: token.ID, Details: token.Name + " scopes=" + token.Scopes})
+
+	payload := apiTokenPayload(&token)
+	payload["token"] = value
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Token created successfully. Copy it now, it will not be shown again",
+		"token":   payload,
+	})
+}
+
+// отзывает персональный токен
+func DeleteAPITokenHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+		return
+	}
+
+	result := database.DB.Where("user_id = ?", c.GetUint("user_id")).Delete(&models.APIToken{}, id)
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete token"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+	audit.Record(c, audit.Event{Action: models.AuditAPITokenRevoke, TargetType: "api_token", TargetID: uint(id)})
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token deleted successfully"})
+}
+
+func apiTokenPayload(token *models.APIToken) gin.H {
+	return gin.H{
+		"id":           token.ID,
+		"name":         token.Name,
+		"prefix":       token.Prefix,
+		"scopes":       token.ScopeList(),
+		"expires_at":   token.ExpiresAt,
+		"last_used_at": token.LastUsedAt,
+		"last_used_ip": token.LastUsedIP,
+		"created_at":   token.CreatedAt,
+	}
+}
+
+func validScope(scope string) bool {
+	for _, known := range models.Scopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
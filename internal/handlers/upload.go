@@ -1,21 +1,39 @@
 package handlers
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"mime"
 	"mime/multipart"
 	"net/http"
-	"os"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"realtime_chat_platform/internal/audit"
 	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/fileurl"
+	"realtime_chat_platform/internal/imaging"
 	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/quota"
+	"realtime_chat_platform/internal/scanner"
+	"realtime_chat_platform/internal/storage"
 
 	"github.com/gin-gonic/gin"
 )
 
-// загружает аватар пользователя
+// максимальный размер исходного файла аватара
+const maxAvatarSize = 5 << 20
+
+// загружает аватар пользователя: файл декодируется, обрезается до квадрата и
+// сохраняется в размерах models.AvatarSizes без метаданных EXIF
 func UploadAvatarHandler(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -23,6 +41,8 @@ func UploadAvatarHandler(c *gin.Context) {
 		return
 	}
 
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxAvatarSize+1<<20)
+
 	// получение загруженного файла
 	file, err := c.FormFile("avatar")
 	if err != nil {
@@ -30,48 +50,89 @@ func UploadAvatarHandler(c *gin.Context) {
 		return
 	}
 
-	// проверка типа файла
-	if !isValidImageType(file) {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file type. Only JPG, PNG, and GIF are allowed"})
+	// проверка размера файла
+	if file.Size > maxAvatarSize {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large. Maximum size is 5MB"})
 		return
 	}
 
-	// проверка размера файла
-	if file.Size > 5*1024*1024 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "File too large. Maximum size is 5MB"})
+	data, err := readUploadedFile(file)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to read file"})
 		return
 	}
 
-	// генерация уникального имени файла
-	ext := filepath.Ext(file.Filename)
-	filename := fmt.Sprintf("avatar_%d_%d%s", userID, time.Now().Unix(), ext)
+	// исходный файл проверяется до декодирования и существует только в памяти,
+	// поэтому аватар не виден никому, пока проверка не завершена
+	if !scanAvatar(c, data, file.Filename) {
+		return
+	}
 
-	// создание директории для загрузки
-	uploadDir := "web/static/uploads/avatars"
-	if err := os.MkdirAll(uploadDir, 0755); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create upload directory"})
+	// тип определяется декодированием, а не по заголовку или расширению
+	img, _, orientation, err := imaging.Decode(data)
+	if errors.Is(err, imaging.ErrTooLarge) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Image dimensions are too large"})
+		return
+	} else if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid image file. Only JPG, PNG, GIF and WebP are allowed"})
 		return
 	}
 
-	// сохранение файла
-	filepath := filepath.Join(uploadDir, filename)
-	if err := c.SaveUploadedFile(file, filepath); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+	// варианты кодируются заранее, чтобы проверить квоту до сохранения
+	variants := make([]bytes.Buffer, len(models.AvatarSizes))
+	var avatarSize int64
+	for i, size := range models.AvatarSizes {
+		if err := imaging.EncodePNG(&variants[i], imaging.SquareThumbnail(img, size, orientation)); err != nil {
+			log.Printf("Error encoding avatar variant %d: %v", size, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+			return
+		}
+		avatarSize += int64(variants[i].Len())
+	}
+
+	var previous models.User
+	database.DB.Select("avatar", "avatar_size").First(&previous, userID)
+
+	// старый аватар перестает занимать место, поэтому резервируется только разница
+	delta := avatarSize - previous.AvatarSize
+	if !reserveUserStorage(c, c.GetUint("user_id"), delta) {
 		return
 	}
 
-	// обновление URL аватара в БД
-	avatarURL := fmt.Sprintf("/static/uploads/avatars/%s", filename)
-	fmt.Printf("Updating avatar URL for user %d: %s\n", userID, avatarURL)
+	// сохранение вариантов в хранилище
+	base := fmt.Sprintf("avatar_%d_%d", userID, time.Now().Unix())
+	var stored []string
+	for i, size := range models.AvatarSizes {
+		key := fmt.Sprintf("%s%s_%d.png", models.AvatarKeyPrefix, base, size)
+		if err := storage.Store.Put(key, &variants[i], int64(variants[i].Len()), "image/png"); err != nil {
+			log.Printf("Error storing avatar variant %d: %v", size, err)
+			deleteBlobs(stored)
+			quota.ReleaseUser(c.GetUint("user_id"), delta)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save file"})
+			return
+		}
+		stored = append(stored, key)
+	}
 
-	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).UpdateColumn("avatar", avatarURL).Error; err != nil {
-		os.Remove(filepath)
-		fmt.Printf("Failed to update avatar in database: %v\n", err)
+	// обновление URL аватара в БД: основной адрес - самый большой вариант
+	avatarURL := fmt.Sprintf("%s%s_%d.png", models.AvatarURLPrefix, base, models.AvatarSizes[len(models.AvatarSizes)-1])
+
+	updates := map[string]interface{}{"avatar": avatarURL, "avatar_size": avatarSize}
+	if err := database.DB.Model(&models.User{}).Where("id = ?", userID).UpdateColumns(updates).Error; err != nil {
+		deleteBlobs(stored)
+		quota.ReleaseUser(c.GetUint("user_id"), delta)
+		log.Printf("Failed to update avatar in database: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update profile"})
 		return
 	}
 
-	fmt.Printf("Successfully updated avatar in database\n")
+	audit.Record(c, audit.Event{
+		Action:     models.AuditAvatarUpload,
+		TargetType: "user",
+		TargetID:   c.GetUint("user_id"),
+		Changes:    audit.Changes{"avatar": {Before: previous.Avatar, After: avatarURL}},
+		Details:    fmt.Sprintf("%s (%d bytes)", file.Filename, file.Size),
+	})
 
 	// получение обновленного профиля пользователя
 	var user models.User
@@ -82,45 +143,144 @@ func UploadAvatarHandler(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{
 		"message":    "Avatar uploaded successfully",
-		"avatar_url": avatarURL,
+		"avatar_url": fileurl.Sign(avatarURL, user.ID),
 		"profile": gin.H{
-			"id":          user.ID,
-			"username":    user.Username,
-			"nickname":    user.Nickname,
-			"avatar":      user.Avatar,
-			"bio":         user.Bio,
-			"last_active": user.LastActive,
-			"created_at":  user.CreatedAt,
+			"id":              user.ID,
+			"username":        user.Username,
+			"nickname":        user.Nickname,
+			"avatar":          fileurl.Sign(user.AvatarURL(), user.ID),
+			"avatar_variants": fileurl.SignAll(user.AvatarVariants(), user.ID),
+			"bio":             user.Bio,
+			"last_active":     user.LastActive,
+			"created_at":      user.CreatedAt,
 		},
 	})
 }
 
-// проверяет, является ли загруженный файл изображением
-func isValidImageType(file *multipart.FileHeader) bool {
-	contentType := file.Header.Get("Content-Type")
-	validTypes := []string{
-		"image/jpeg",
-		"image/jpg",
-		"image/png",
-		"image/gif",
-		"image/webp",
+// проверяет исходный файл аватара сканером; при заражении пишет событие в журнал аудита.
+// Если сканер недоступен, загрузка отклоняется: непроверенный файл не сохраняется
+func scanAvatar(c *gin.Context, data []byte, filename string) bool {
+	if !scanner.Enabled() {
+		return true
 	}
 
-	for _, validType := range validTypes {
-		if strings.Contains(contentType, validType) {
-			return true
-		}
+	result, err := scanner.Default.Scan(c.Request.Context(), bytes.NewReader(data))
+	if err != nil {
+		log.Printf("Error scanning avatar of user %d: %v", c.GetUint("user_id"), err)
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "File scanning is unavailable, try again later"})
+		return false
+	}
+	if result.Infected {
+		audit.Record(c, audit.Event{
+			Action:     models.AuditUploadInfected,
+			TargetType: "user",
+			TargetID:   c.GetUint("user_id"),
+			Details:    fmt.Sprintf("avatar %s (%d bytes): %s", filename, len(data), result.Signature),
+		})
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "File rejected: malware detected (" + result.Signature + ")"})
+		return false
 	}
+	return true
+}
 
-	// проверка расширения файла как резервного
-	ext := strings.ToLower(filepath.Ext(file.Filename))
-	validExtensions := []string{".jpg", ".jpeg", ".png", ".gif", ".webp"}
+// отдает аватар из хранилища по подписанной ссылке
+func ServeAvatarHandler(c *gin.Context) {
+	name := c.Param("name")
+	if name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+		return
+	}
 
-	for _, validExt := range validExtensions {
-		if ext == validExt {
-			return true
+	blob, err := storage.Store.Open(models.AvatarKeyPrefix + name)
+	if err != nil {
+		if !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Error opening avatar %s: %v", name, err)
 		}
+		c.JSON(http.StatusNotFound, gin.H{"error": "Avatar not found"})
+		return
+	}
+	defer blob.Close()
+
+	// не-изображения не отдаются с исполняемым браузером типом
+	contentType := mime.TypeByExtension(filepath.Ext(name))
+	if !strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "image/svg") {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("X-Content-Type-Options", "nosniff")
+	// имена файлов уникальны, поэтому содержимое по ссылке не меняется до ее истечения
+	c.Header("Cache-Control", linkCacheControl(c)+", immutable")
+	http.ServeContent(c.Writer, c.Request, name, blob.Info().ModTime, blob)
+}
+
+// ответы по подписанной ссылке кешируются не дольше срока ее действия
+func linkCacheControl(c *gin.Context) string {
+	expires, _ := c.Get("link_expires")
+	maxAge := 0
+	if expires, ok := expires.(time.Time); ok {
+		maxAge = max(int(time.Until(expires).Seconds()), 0)
+	}
+	return fmt.Sprintf("private, max-age=%d", maxAge)
+}
+
+// StaticDir отдает статические файлы без списков каталогов и без web/static/uploads:
+// загруженные раньше файлы доступны только через подписанные ссылки после переноса chatctl
+func StaticDir(root string) http.FileSystem {
+	return staticDir{gin.Dir(root, false)}
+}
+
+type staticDir struct {
+	http.FileSystem
+}
+
+func (d staticDir) Open(name string) (http.File, error) {
+	if cleaned := path.Clean("/" + name); cleaned == "/uploads" || strings.HasPrefix(cleaned, "/uploads/") {
+		return nil, fs.ErrNotExist
 	}
+	return d.FileSystem.Open(name)
+}
+
+// рисует аватар с инициалами для пользователя без загруженного аватара. Для неизвестных
+// логинов (например, удаленных авторов из истории) аватар рисуется по самому логину
+func DefaultAvatarHandler(c *gin.Context) {
+	username := c.Param("username")
 
-	return false
+	var user models.User
+	nickname := ""
+	if err := database.DB.Select("nickname").Where("username = ?", username).First(&user).Error; err == nil {
+		nickname = user.Nickname
+	}
+
+	svg := imaging.InitialsSVG(username, nickname)
+	sum := sha256.Sum256(svg)
+	etag := `"` + hex.EncodeToString(sum[:8]) + `"`
+
+	// адрес содержит версию никнейма, поэтому ответ можно кешировать, а ETag покрывает остальное
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "public, max-age=86400")
+	c.Header("X-Content-Type-Options", "nosniff")
+	c.Header("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "image/svg+xml", svg)
+}
+
+// читает загруженный файл целиком; размер уже ограничен вызывающим
+func readUploadedFile(file *multipart.FileHeader) ([]byte, error) {
+	src, err := file.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer src.Close()
+	return io.ReadAll(src)
+}
+
+func deleteBlobs(keys []string) {
+	for _, key := range keys {
+		if err := storage.Store.Delete(key); err != nil {
+			log.Printf("Error deleting %s: %v", key, err)
+		}
+	}
 }
@@ -0,0 +1,200 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/draw"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// ограничение на размер декодируемого изображения, защищает от "бомб" с огромными размерами
+const maxPixels = 40_000_000
+
+var (
+	ErrNotImage = errors.New("not a supported image")
+	ErrTooLarge = errors.New("image dimensions are too large")
+)
+
+// Decode читает изображение JPEG, PNG, GIF или WebP по содержимому, а не по имени или заголовку.
+// Поворот из EXIF JPEG возвращается отдельно: метаданные в перекодированный файл не попадают
+func Decode(data []byte) (image.Image, string, int, error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, ErrNotImage
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return nil, "", 0, ErrNotImage
+	}
+	if config.Width*config.Height > maxPixels {
+		return nil, "", 0, ErrTooLarge
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, "", 0, ErrNotImage
+	}
+
+	orientation := 1
+	if format == "jpeg" {
+		orientation = jpegOrientation(data)
+	}
+	return img, format, orientation, nil
+}
+
+// SquareThumbnail вырезает центральный квадрат, уменьшает его до size и применяет поворот из EXIF
+func SquareThumbnail(img image.Image, size, orientation int) image.Image {
+	bounds := img.Bounds()
+	side := min(bounds.Dx(), bounds.Dy())
+	crop := image.Rect(0, 0, side, side).Add(bounds.Min).Add(image.Pt((bounds.Dx()-side)/2, (bounds.Dy()-side)/2))
+
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, crop, draw.Src, nil)
+	// центральный квадрат при повороте переходит сам в себя, поэтому поворачивается уже уменьшенная копия
+	return orient(dst, orientation)
+}
+
+// Fit уменьшает изображение так, чтобы оно помещалось в maxSide x maxSide с сохранением
+// пропорций, и применяет поворот из EXIF. Маленькие изображения не увеличиваются
+func Fit(img image.Image, maxSide, orientation int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w > maxSide || h > maxSide {
+		if w >= h {
+			w, h = maxSide, max(h*maxSide/w, 1)
+		} else {
+			w, h = max(w*maxSide/h, 1), maxSide
+		}
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return orient(dst, orientation)
+}
+
+// OrientedSize возвращает размеры изображения после поворота из EXIF
+func OrientedSize(img image.Image, orientation int) (int, int) {
+	if orientation >= 5 && orientation <= 8 {
+		return img.Bounds().Dy(), img.Bounds().Dx()
+	}
+	return img.Bounds().Dx(), img.Bounds().Dy()
+}
+
+// EncodeThumbnail кодирует превью: непрозрачные изображения в JPEG, остальные в PNG.
+// Возвращает MIME-тип результата
+func EncodeThumbnail(w io.Writer, img image.Image) (string, error) {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return "image/jpeg", jpeg.Encode(w, img, &jpeg.Options{Quality: 80})
+	}
+	return "image/png", EncodePNG(w, img)
+}
+
+// EncodePNG кодирует изображение в PNG без метаданных
+func EncodePNG(w io.Writer, img image.Image) error {
+	encoder := png.Encoder{CompressionLevel: png.BestCompression}
+	return encoder.Encode(w, img)
+}
+
+// orient поворачивает и отражает изображение по значению EXIF Orientation (1-8)
+func orient(src *image.NRGBA, orientation int) image.Image {
+	if orientation < 2 || orientation > 8 {
+		return src
+	}
+
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			dst.SetNRGBA(x, y, src.NRGBAAt(sx, sy))
+		}
+	}
+	return dst
+}
+
+// jpegOrientation находит тег Orientation в сегменте APP1 (EXIF); 1 означает отсутствие поворота
+func jpegOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		// начало данных изображения: дальше метаданных нет
+		if marker == 0xDA || length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 6 && string(segment[:6]) == "Exif\x00\x00" {
+			return exifOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+func exifOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for n := 0; n < entries; n++ {
+		entry := offset + 2 + n*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			if value := int(order.Uint16(tiff[entry+8:])); value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+	return 1
+}
@@ -0,0 +1,72 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// InitialsSVG рисует аватар по умолчанию: инициалы отображаемого имени на фоне,
+// цвет которого однозначно определяется логином. Результат детерминирован
+func InitialsSVG(username, displayName string) []byte {
+	hash := fnv.New32a()
+	hash.Write([]byte(username))
+	hue := float64(hash.Sum32() % 360)
+
+	var svg bytes.Buffer
+	svg.WriteString(`<svg xmlns="http://www.w3.org/2000/svg" width="256" height="256" viewBox="0 0 256 256">`)
+	fmt.Fprintf(&svg, `<rect width="256" height="256" fill="%s"/>`, hslHex(hue, 0.55, 0.45))
+	svg.WriteString(`<text x="128" y="128" dy=".35em" text-anchor="middle" fill="#ffffff" font-family="Helvetica, Arial, sans-serif" font-size="104" font-weight="600">`)
+	xml.EscapeText(&svg, []byte(Initials(displayName, username)))
+	svg.WriteString(`</text></svg>`)
+	return svg.Bytes()
+}
+
+// Initials возвращает до двух заглавных букв: первые буквы первых двух слов имени
+// или первую букву единственного слова. Пустое имя заменяется логином
+func Initials(displayName, username string) string {
+	name := strings.TrimSpace(displayName)
+	if name == "" {
+		name = username
+	}
+	words := strings.FieldsFunc(name, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	if len(words) == 0 {
+		return "?"
+	}
+
+	var initials []rune
+	for _, word := range words[:min(len(words), 2)] {
+		initials = append(initials, unicode.ToUpper([]rune(word)[0]))
+	}
+	return string(initials)
+}
+
+// переводит цвет из HSL в #rrggbb
+func hslHex(hue, saturation, lightness float64) string {
+	chroma := (1 - math.Abs(2*lightness-1)) * saturation
+	x := chroma * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	m := lightness - chroma/2
+
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g, b = chroma, x, 0
+	case hue < 120:
+		r, g, b = x, chroma, 0
+	case hue < 180:
+		r, g, b = 0, chroma, x
+	case hue < 240:
+		r, g, b = 0, x, chroma
+	case hue < 300:
+		r, g, b = x, 0, chroma
+	default:
+		r, g, b = chroma, 0, x
+	}
+	return fmt.Sprintf("#%02x%02x%02x", uint8(math.Round((r+m)*255)), uint8(math.Round((g+m)*255)), uint8(math.Round((b+m)*255)))
+}
@@ -0,0 +1,36 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"net/smtp"
+	"strings"
+
+	"realtime_chat_platform/internal/config"
+)
+
+// отправляет письмо через SMTP; если SMTP не настроен, письмо пишется в лог
+func Send(to, subject, body string) error {
+	if config.SMTPHost == "" {
+		log.Printf("Mail to %s: %s\n%s", to, subject, body)
+		return nil
+	}
+
+	var auth smtp.Auth
+	if config.SMTPUsername != "" {
+		auth = smtp.PlainAuth("", config.SMTPUsername, config.SMTPPassword, config.SMTPHost)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + config.SMTPFrom,
+		"To: " + to,
+		"Subject: " + subject,
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	addr := fmt.Sprintf("%s:%d", config.SMTPHost, config.SMTPPort)
+	return smtp.SendMail(addr, auth, config.SMTPFrom, []string{to}, []byte(msg))
+}
@@ -0,0 +1,245 @@
+// Package media обрабатывает изображения и видео из вложений в фоне: определяет размеры,
+// считает blurhash и сохраняет превью в хранилище
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/fileurl"
+	"realtime_chat_platform/internal/imaging"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/storage"
+	"realtime_chat_platform/internal/websocket"
+)
+
+// ErrUnsupported возвращается для вложений, которые не являются изображением или видео
+var ErrUnsupported = errors.New("attachment is not an image or video")
+
+// число компонентов blurhash по горизонтали и вертикали
+const (
+	blurhashX = 4
+	blurhashY = 3
+)
+
+// сколько ждать кадр от ffmpeg
+const ffmpegTimeout = 30 * time.Second
+
+var queue = make(chan uint, 1024)
+
+// Supported сообщает, строится ли для файла такого типа превью
+func Supported(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/") || strings.HasPrefix(contentType, "video/")
+}
+
+// Start запускает обработчики и ставит в очередь вложения, не обработанные до перезапуска
+func Start(workers int) {
+	for i := 0; i < max(workers, 1); i++ {
+		go worker()
+	}
+
+	go func() {
+		var ids []uint
+		// вложения из карантина попадут в очередь после проверки
+		err := database.DB.Model(&models.Attachment{}).
+			Where("media_status = ? AND scan_status NOT IN ?", models.MediaPending, []string{models.ScanPending, models.ScanFailed}).
+			Pluck("id", &ids).Error
+		if err != nil {
+			log.Printf("Error loading pending attachments: %v", err)
+			return
+		}
+		for _, id := range ids {
+			queue <- id
+		}
+	}()
+}
+
+// Enqueue ставит вложение в очередь; при переполнении оно останется в статусе pending
+// и будет обработано после перезапуска или командой chatctl regen-thumbnails
+func Enqueue(id uint) {
+	select {
+	case queue <- id:
+	default:
+		log.Printf("Media queue is full, attachment %d left pending", id)
+	}
+}
+
+func worker() {
+	for id := range queue {
+		var attachment models.Attachment
+		if err := database.DB.First(&attachment, id).Error; err != nil || attachment.Quarantined() {
+			continue
+		}
+		if err := Process(&attachment); err != nil {
+			log.Printf("Error processing attachment %d: %v", id, err)
+		}
+		notify(&attachment)
+	}
+}
+
+// Process определяет размеры, считает blurhash и сохраняет превью вложения.
+// При ошибке вложение помечается как failed
+func Process(attachment *models.Attachment) error {
+	if !Supported(attachment.ContentType) {
+		return ErrUnsupported
+	}
+
+	err := process(attachment)
+	if err != nil {
+		attachment.MediaStatus = models.MediaFailed
+		database.DB.Model(attachment).UpdateColumn("media_status", models.MediaFailed)
+	}
+	return err
+}
+
+func process(attachment *models.Attachment) error {
+	var (
+		img         image.Image
+		orientation = 1
+		err         error
+	)
+	if strings.HasPrefix(attachment.ContentType, "image/") {
+		img, orientation, err = decodeImage(attachment.Path)
+	} else {
+		img, err = videoFrame(attachment.Path)
+	}
+	if err != nil {
+		return err
+	}
+
+	thumbnail := imaging.Fit(img, config.ThumbnailSize, orientation)
+	var encoded bytes.Buffer
+	contentType, err := imaging.EncodeThumbnail(&encoded, thumbnail)
+	if err != nil {
+		return err
+	}
+
+	key := thumbnailKey(attachment.Path, contentType)
+	if err := storage.Store.Put(key, &encoded, int64(encoded.Len()), contentType); err != nil {
+		return fmt.Errorf("store thumbnail: %w", err)
+	}
+	if attachment.ThumbnailPath != "" && attachment.ThumbnailPath != key {
+		storage.Store.Delete(attachment.ThumbnailPath)
+	}
+
+	width, height := imaging.OrientedSize(img, orientation)
+	updates := map[string]interface{}{
+		"media_status":   models.MediaReady,
+		"width":          width,
+		"height":         height,
+		"blurhash":       imaging.Blurhash(thumbnail, blurhashX, blurhashY),
+		"thumbnail_path": key,
+	}
+	if err := database.DB.Model(attachment).Updates(updates).Error; err != nil {
+		return err
+	}
+	attachment.MediaStatus = models.MediaReady
+	attachment.Width, attachment.Height = width, height
+	attachment.Blurhash = updates["blurhash"].(string)
+	attachment.ThumbnailPath = key
+	attachment.AfterFind(database.DB)
+	return nil
+}
+
+func decodeImage(key string) (image.Image, int, error) {
+	blob, err := storage.Store.Open(key)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer blob.Close()
+
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		return nil, 0, err
+	}
+	img, _, orientation, err := imaging.Decode(data)
+	return img, orientation, err
+}
+
+// извлекает первый кадр видео через ffmpeg. Файл копируется во временный, потому что
+// контейнерам вроде MP4 нужен произвольный доступ, а объект может лежать в S3
+func videoFrame(key string) (image.Image, error) {
+	if config.FFmpegPath == "" {
+		return nil, errors.New("video thumbnails are disabled: FFMPEG_PATH is empty")
+	}
+
+	blob, err := storage.Store.Open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	tmp, err := os.CreateTemp("", "chat-video-*")
+	if err != nil {
+		return nil, err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, blob)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ffmpegTimeout)
+	defer cancel()
+
+	var frame, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, config.FFmpegPath, "-v", "error", "-i", tmp.Name(),
+		"-frames:v", "1", "-f", "image2pipe", "-c:v", "png", "-")
+	cmd.Stdout = &frame
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	// ffmpeg уже применяет поворот из метаданных видео
+	img, _, _, err := imaging.Decode(frame.Bytes())
+	return img, err
+}
+
+// ключ превью повторяет ключ файла: attachments/2024/01/1_ab.. -> thumbnails/2024/01/1_ab...jpg
+func thumbnailKey(path, contentType string) string {
+	extension := ".png"
+	if contentType == "image/jpeg" {
+		extension = ".jpg"
+	}
+	return "thumbnails/" + strings.TrimPrefix(path, models.AttachmentKeyPrefix) + extension
+}
+
+// сообщает клиентам о метаданных вложения, если сообщение с ним уже отправлено
+func notify(attachment *models.Attachment) {
+	// сообщение могли отправить, пока вложение обрабатывалось
+	var current models.Attachment
+	if err := database.DB.Select("message_id").First(&current, attachment.ID).Error; err != nil || current.MessageID == nil {
+		return
+	}
+	attachment.MessageID = current.MessageID
+
+	var message models.Message
+	if err := database.DB.First(&message, *attachment.MessageID).Error; err != nil {
+		return
+	}
+
+	event := websocket.Personal(func(userID uint) interface{} {
+		signed := fileurl.Attachment(*attachment, userID)
+		return websocket.AttachmentEvent{Type: "attachment_updated", MessageID: message.ID, Attachment: &signed}
+	})
+	if message.Shadow {
+		websocket.GlobalHub.SendToUser(attachment.UserID, event)
+		return
+	}
+	websocket.GlobalHub.SendToRoom(message.RoomID, event)
+}
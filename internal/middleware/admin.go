@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"net/http"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+// права, ради которых открывают раздел администрирования
+var adminPermissions = []rbac.Permission{
+	rbac.UsersApprove, rbac.RolesAssign, rbac.InvitesManage, rbac.AutomodManage, rbac.AuditRead, rbac.StorageManage,
+}
+
+// пропускает в раздел администрирования тех, чья серверная роль дает хотя бы одно из
+// adminPermissions; конкретное право каждого маршрута проверяет RequirePermission.
+// Используется после AuthMiddleware
+func RequireAdmin() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var user models.User
+		if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		role := rbac.ServerRole(&user)
+		for _, permission := range adminPermissions {
+			if rbac.Can(role, permission) {
+				c.Next()
+				return
+			}
+		}
+
+		c.JSON(http.StatusForbidden, gin.H{"error": "Admin access required"})
+		c.Abort()
+	}
+}
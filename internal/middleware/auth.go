@@ -1,17 +1,20 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
+	"realtime_chat_platform/internal/auth"
 	"realtime_chat_platform/internal/config"
 	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/fileurl"
 	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/moderation"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v4"
 )
 
-// проверяет JWT токен и устанавливает user_id в контекст
+// проверяет JWT токен или персональный токен и устанавливает user_id в контекст
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
@@ -29,38 +32,130 @@ func AuthMiddleware() gin.HandlerFunc {
 
 		tokenString := strings.TrimPrefix(authHeader, "Bearer ")
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.JWTSecret), nil
-		})
-
-		if err != nil || !token.Valid {
+		principal, err := auth.ResolveBearer(tokenString, c.ClientIP())
+		var banned *auth.BanError
+		switch {
+		case errors.As(err, &banned):
+			c.JSON(http.StatusForbidden, gin.H{"error": banned.Error()})
+			c.Abort()
+			return
+		case errors.Is(err, auth.ErrUserPending):
+			c.JSON(http.StatusForbidden, gin.H{"error": "Account is pending approval"})
+			c.Abort()
+			return
+		case errors.Is(err, auth.ErrTokenExpired):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Token expired"})
+			c.Abort()
+			return
+		case err != nil:
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+		c.Set("user_id", principal.User.ID)
+		c.Set("principal", principal)
+		c.Next()
+	}
+}
+
+// устанавливает user_id, если передан действующий токен, и пропускает анонимные запросы:
+// публичные списки подписывают ссылки на файлы для того, кто их запросил
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if ok {
+			if principal, err := auth.ResolveBearer(tokenString, c.ClientIP()); err == nil {
+				c.Set("user_id", principal.User.ID)
+				c.Set("principal", principal)
+			}
+		}
+		c.Next()
+	}
+}
+
+// проверяет подпись ссылки на файл вместо заголовка Authorization: браузер загружает
+// картинки и видео без него. Пользователь ссылки, если он есть, попадает в user_id
+func RequireSignedURL() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID, expires, err := fileurl.Verify(c.Request.URL.Path, c.Request.URL.Query())
+		if errors.Is(err, fileurl.ErrExpired) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Link expired"})
+			c.Abort()
+			return
+		} else if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Invalid link signature"})
 			c.Abort()
 			return
 		}
 
-		userID, ok := claims["user_id"].(float64)
-		if !ok {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid user ID in token"})
+		if userID != 0 {
+			var user models.User
+			if err := database.DB.Select("id", "status").First(&user, userID).Error; err != nil || user.Status == models.UserStatusPending {
+				c.JSON(http.StatusForbidden, gin.H{"error": "Invalid link signature"})
+				c.Abort()
+				return
+			}
+			if ban := moderation.Active(userID, models.ModerationBan); ban != nil {
+				c.JSON(http.StatusForbidden, gin.H{"error": moderation.Describe(ban)})
+				c.Abort()
+				return
+			}
+			c.Set("user_id", userID)
+		}
+		c.Set("link_expires", expires)
+		c.Next()
+	}
+}
+
+// требует у персонального токена указанную область доступа; JWT сессии проходит всегда
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := c.MustGet("principal").(*auth.Principal)
+		if !ok || !principal.HasScope(scope) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Token lacks required scope: " + scope})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// пропускает только интерактивный вход: управление учетной записью
+// недоступно персональным токенам
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal, ok := c.MustGet("principal").(*auth.Principal)
+		if !ok || !principal.IsSession() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This action is not available to API tokens"})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
+
+// ограничивает доступ для аккаунтов с неподтвержденным email, если сервер этого требует
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.EmailVerificationRequired() {
+			c.Next()
+			return
+		}
 
 		var user models.User
-		if err := database.DB.First(&user, uint(userID)).Error; err != nil {
+		if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 			c.Abort()
 			return
 		}
 
-		c.Set("user_id", uint(userID))
+		if !user.EmailVerified {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Email verification required"})
+			c.Abort()
+			return
+		}
+
 		c.Next()
 	}
 }
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/rbac"
+
+	"github.com/gin-gonic/gin"
+)
+
+// проверяет право на уровне сервера; используется после AuthMiddleware
+func RequirePermission(permission rbac.Permission) gin.HandlerFunc {
+	return requirePermission(permission, func(c *gin.Context) (uint, bool) {
+		return 0, true
+	})
+}
+
+// проверяет право в комнате из параметра маршрута :id; используется после AuthMiddleware
+func RequireRoomPermission(permission rbac.Permission) gin.HandlerFunc {
+	return requirePermission(permission, func(c *gin.Context) (uint, bool) {
+		roomID, err := strconv.ParseUint(c.Param("id"), 10, 64)
+		if err != nil {
+			return 0, false
+		}
+		return uint(roomID), true
+	})
+}
+
+func requirePermission(permission rbac.Permission, roomFromContext func(c *gin.Context) (uint, bool)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		roomID, ok := roomFromContext(c)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid room ID"})
+			c.Abort()
+			return
+		}
+
+		var user models.User
+		if err := database.DB.First(&user, c.GetUint("user_id")).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
+			c.Abort()
+			return
+		}
+
+		role := rbac.EffectiveRole(&user, roomID)
+		if !rbac.Can(role, permission) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Permission denied: " + string(permission)})
+			c.Abort()
+			return
+		}
+
+		c.Set("role", role)
+		c.Next()
+	}
+}
@@ -0,0 +1,74 @@
+package models
+
+import (
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// состояния обработки изображений и видео: размеры, превью и blurhash считаются в фоне
+const (
+	MediaPending = "pending"
+	MediaReady   = "ready"
+	MediaFailed  = "failed"
+)
+
+// состояния проверки сканером: пока файл не признан чистым, он лежит под QuarantineKeyPrefix
+// и недоступен никому, включая автора. Зараженное вложение удаляется, поэтому своего состояния у него нет
+const (
+	ScanPending = "pending"
+	ScanClean   = "clean"
+	ScanFailed  = "failed"
+)
+
+// KindVoice - вложение с записью голосового сообщения и сообщение с такой записью
+const KindVoice = "voice"
+
+// префиксы ключей вложений в хранилище: проверенные файлы и файлы в карантине
+const (
+	AttachmentKeyPrefix = "attachments/"
+	QuarantineKeyPrefix = "quarantine/"
+)
+
+// Attachment - загруженный файл. До отправки сообщения MessageID пуст и файл
+// доступен только загрузившему его пользователю. Размеры, blurhash и превью есть только
+// у изображений и видео после фоновой обработки, длительность и форма волны - у голосовых записей
+type Attachment struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UserID        uint      `json:"user_id" gorm:"index;not null"`
+	MessageID     *uint     `json:"message_id" gorm:"index"`
+	Filename      string    `json:"filename" gorm:"not null"`
+	ContentType   string    `json:"content_type" gorm:"not null"`
+	Size          int64     `json:"size"`
+	Path          string    `json:"-" gorm:"not null"` // ключ файла в хранилище
+	URL           string    `json:"url" gorm:"-"`
+	ScanStatus    string    `json:"scan_status,omitempty" gorm:"index;default:''"` // пусто, если сканер отключен
+	MediaStatus   string    `json:"media_status,omitempty" gorm:"index;default:''"`
+	Kind          string    `json:"kind,omitempty" gorm:"default:''"`
+	DurationMs    int64     `json:"duration_ms,omitempty"`
+	Waveform      []int     `json:"waveform,omitempty" gorm:"serializer:json"`
+	Width         int       `json:"width,omitempty"`
+	Height        int       `json:"height,omitempty"`
+	Blurhash      string    `json:"blurhash,omitempty"`
+	ThumbnailPath string    `json:"-"` // ключ превью в хранилище
+	ThumbnailURL  string    `json:"thumbnail_url,omitempty" gorm:"-"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// Quarantined сообщает, что файл еще не проверен сканером или проверка не удалась
+func (a *Attachment) Quarantined() bool {
+	return a.ScanStatus == ScanPending || a.ScanStatus == ScanFailed
+}
+
+func (a *Attachment) AfterFind(tx *gorm.DB) error {
+	a.URL = fmt.Sprintf("/files/attachments/%d", a.ID)
+	if a.ThumbnailPath != "" {
+		a.ThumbnailURL = a.URL + "/thumbnail"
+	}
+	return nil
+}
+
+func (a *Attachment) AfterCreate(tx *gorm.DB) error {
+	return a.AfterFind(tx)
+}
@@ -0,0 +1,64 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// события журнала аудита
+const (
+	AuditLogin          = "auth.login"
+	AuditLoginFailed    = "auth.login_failed"
+	AuditPasswordChange = "account.password_change"
+	AuditEmailChange    = "account.email_change"
+	AuditProfileUpdate  = "profile.update"
+	AuditAvatarUpload   = "profile.avatar_upload"
+	AuditRoleChange     = "role.change"
+	AuditRoomRoleChange = "role.room_change"
+	AuditUserApprove    = "user.approve"
+	AuditUserReject     = "user.reject"
+	AuditModeration     = "moderation." // + вид действия: moderation.ban, moderation.mute...
+	AuditReportResolve  = "moderation.report_resolve"
+	AuditRaidMode       = "moderation.raid_mode"
+	AuditMessageDelete  = "message.delete"
+	AuditRoomUpdate     = "room.update"
+	AuditAutomodRule    = "automod.rule_change"
+	AuditInviteCreate   = "invite.create"
+	AuditInviteRevoke   = "invite.revoke"
+	AuditAPITokenCreate = "token.create"
+	AuditAPITokenRevoke = "token.revoke"
+	AuditPasskeyAdd     = "passkey.add"
+	AuditPasskeyDelete  = "passkey.delete"
+	AuditIdentityLink   = "identity.link"
+	AuditQuotaChange    = "storage.quota_change"
+	AuditUploadInfected = "storage.upload_infected"
+)
+
+// ErrAuditImmutable возвращается при попытке изменить или удалить запись аудита
+var ErrAuditImmutable = errors.New("audit entries are append-only")
+
+// AuditEntry - запись журнала аудита. Changes хранит JSON вида
+// {"поле": {"before": ..., "after": ...}}; ActorID 0 означает систему.
+type AuditEntry struct {
+	ID            uint            `json:"id" gorm:"primaryKey"`
+	Action        string          `json:"action" gorm:"index;not null"`
+	ActorID       uint            `json:"actor_id" gorm:"index"`
+	ActorUsername string          `json:"actor_username"`
+	TargetType    string          `json:"target_type" gorm:"index:idx_audit_target"`
+	TargetID      uint            `json:"target_id" gorm:"index:idx_audit_target"`
+	IP            string          `json:"ip"`
+	Changes       json.RawMessage `json:"changes" gorm:"type:text"`
+	Details       string          `json:"details"`
+	CreatedAt     time.Time       `json:"created_at" gorm:"index"`
+}
+
+func (AuditEntry) BeforeUpdate(tx *gorm.DB) error {
+	return ErrAuditImmutable
+}
+
+func (AuditEntry) BeforeDelete(tx *gorm.DB) error {
+	return ErrAuditImmutable
+}
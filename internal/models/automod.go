@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// типы правил автомодерации
+const (
+	AutomodWords     = "words"      // Pattern - слова через запятую
+	AutomodRegex     = "regex"      // Pattern - регулярное выражение
+	AutomodLinkDeny  = "link_deny"  // Pattern - запрещенные домены через запятую
+	AutomodLinkAllow = "link_allow" // Pattern - разрешенные домены, остальные ссылки нарушают правило
+	AutomodCaps      = "caps"       // Threshold - процент заглавных букв
+	AutomodMentions  = "mentions"   // Threshold - максимум упоминаний в сообщении
+	AutomodRepeat    = "repeat"     // Threshold - одинаковых сообщений за WindowSeconds
+	AutomodInvite    = "invite"     // Pattern - дополнительные домены приглашений
+)
+
+// действия правил автомодерации по возрастанию строгости
+const (
+	AutomodFlag   = "flag"
+	AutomodRedact = "redact"
+	AutomodBlock  = "block"
+	AutomodMute   = "mute"
+)
+
+type AutomodRule struct {
+	ID            uint       `json:"id" gorm:"primaryKey"`
+	Name          string     `json:"name" gorm:"not null"`
+	Type          string     `json:"type" gorm:"not null"`
+	Pattern       string     `json:"pattern" gorm:"default:''"`
+	Threshold     int        `json:"threshold" gorm:"default:0"`
+	WindowSeconds int        `json:"window_seconds" gorm:"default:0"`
+	Action        string     `json:"action" gorm:"not null"`
+	MuteMinutes   int        `json:"mute_minutes" gorm:"default:0"`
+	Enabled       bool       `json:"enabled"`
+	DryRun        bool       `json:"dry_run"`
+	Hits          int64      `json:"hits" gorm:"default:0"`
+	LastHitAt     *time.Time `json:"last_hit_at"`
+	CreatedByID   uint       `json:"created_by_id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
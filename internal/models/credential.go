@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Credential - ключ доступа (passkey) пользователя. Data содержит
+// сериализованные данные WebAuthn, нужные для проверки подписи.
+type Credential struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	UserID       uint       `json:"-" gorm:"index;not null"`
+	User         User       `json:"-"`
+	Name         string     `json:"name" gorm:"not null"`
+	CredentialID []byte     `json:"-" gorm:"uniqueIndex;not null"`
+	Data         []byte     `json:"-" gorm:"not null"`
+	LastUsedAt   *time.Time `json:"last_used_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// WebAuthnSession - состояние незавершенной регистрации или входа по ключу доступа.
+// Запись удаляется при первой попытке завершения, поэтому перехваченный ответ
+// аутентификатора нельзя отправить повторно. В cookie хранится только ID
+type WebAuthnSession struct {
+	ID        string    `gorm:"primaryKey"`
+	Kind      string    `gorm:"not null"`
+	UserID    uint      `gorm:"not null;default:0"` // 0 для входа, пользователь еще неизвестен
+	Data      []byte    `gorm:"not null"`
+	ExpiresAt time.Time `gorm:"index;not null"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// EmailVerification хранит хеш одноразового токена подтверждения адреса.
+// Адрес записывается в пользователя только после перехода по ссылке,
+// поэтому смена email не затрагивает текущий подтверждённый адрес.
+type EmailVerification struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index;not null"`
+	Email     string    `json:"email" gorm:"not null"`
+	TokenHash string    `json:"-" gorm:"uniqueIndex;not null"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
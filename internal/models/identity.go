@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// Identity связывает пользователя с учетной записью во внешнем провайдере
+// (OIDC издатель). Provider и Subject вместе однозначно определяют аккаунт.
+type Identity struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UserID    uint      `json:"user_id" gorm:"index;not null"`
+	Provider  string    `json:"provider" gorm:"uniqueIndex:idx_identities_provider_subject;not null"`
+	Subject   string    `json:"subject" gorm:"uniqueIndex:idx_identities_provider_subject;not null"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// статусы учетной записи
+const (
+	UserStatusActive  = "active"
+	UserStatusPending = "pending"
+)
+
+type Invite struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	Code        string     `json:"code" gorm:"uniqueIndex;not null"`
+	CreatedByID uint       `json:"created_by_id" gorm:"not null"`
+	CreatedBy   User       `json:"-" gorm:"foreignKey:CreatedByID"`
+	MaxUses     int        `json:"max_uses" gorm:"default:0"` // 0 - без ограничения
+	Uses        int        `json:"uses" gorm:"default:0"`
+	DefaultRoom string     `json:"default_room" gorm:"default:''"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// проверяет, можно ли еще зарегистрироваться по приглашению
+func (i *Invite) Usable(now time.Time) bool {
+	if i.RevokedAt != nil {
+		return false
+	}
+	if i.ExpiresAt != nil && now.After(*i.ExpiresAt) {
+		return false
+	}
+	return i.MaxUses == 0 || i.Uses < i.MaxUses
+}
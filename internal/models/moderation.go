@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// виды модерационных действий
+const (
+	ModerationBan    = "ban"
+	ModerationUnban  = "unban"
+	ModerationMute   = "mute"
+	ModerationUnmute = "unmute"
+	ModerationKick   = "kick"
+	ModerationWarn   = "warn"
+	// сообщения пользователя видит только он сам
+	ModerationShadowBan   = "shadowban"
+	ModerationUnshadowBan = "unshadowban"
+)
+
+// ModerationAction - запись журнала модерации. Бан, мут и теневой бан действуют,
+// пока не истекли и не сняты; остальные действия хранятся только для истории.
+type ModerationAction struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	UserID      uint       `json:"user_id" gorm:"index;not null"`
+	User        User       `json:"-"`
+	ModeratorID uint       `json:"moderator_id" gorm:"not null"`
+	Moderator   User       `json:"-" gorm:"foreignKey:ModeratorID"`
+	Action      string     `json:"action" gorm:"index;not null"`
+	Reason      string     `json:"reason" gorm:"default:''"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	RevokedByID *uint      `json:"revoked_by_id"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// проверяет, действует ли ограничение в указанный момент
+func (a *ModerationAction) Active(now time.Time) bool {
+	if a.RevokedAt != nil {
+		return false
+	}
+	return a.ExpiresAt == nil || now.Before(*a.ExpiresAt)
+}
@@ -0,0 +1,31 @@
+package models
+
+import "time"
+
+// статусы жалобы
+const (
+	ReportOpen      = "open"
+	ReportActioned  = "actioned"
+	ReportDismissed = "dismissed"
+)
+
+// способы разбора жалобы модератором
+const (
+	ResolutionDelete  = "delete"
+	ResolutionWarn    = "warn"
+	ResolutionMute    = "mute"
+	ResolutionDismiss = "dismiss"
+)
+
+type Report struct {
+	ID           uint       `json:"id" gorm:"primaryKey"`
+	MessageID    uint       `json:"message_id" gorm:"index;not null"`
+	ReporterID   uint       `json:"reporter_id" gorm:"index;not null"`
+	Reporter     User       `json:"-" gorm:"foreignKey:ReporterID"`
+	Reason       string     `json:"reason" gorm:"not null"`
+	Status       string     `json:"status" gorm:"index;not null;default:'open'"`
+	Resolution   string     `json:"resolution" gorm:"default:''"`
+	ResolvedByID *uint      `json:"resolved_by_id"`
+	ResolvedAt   *time.Time `json:"resolved_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
@@ -0,0 +1,31 @@
+package models
+
+// роли пользователей на сервере и в комнатах
+const (
+	RoleOwner     = "owner"
+	RoleAdmin     = "admin"
+	RoleModerator = "moderator"
+	RoleMember    = "member"
+	RoleGuest     = "guest"
+)
+
+var Roles = []string{RoleOwner, RoleAdmin, RoleModerator, RoleMember, RoleGuest}
+
+var roleRanks = map[string]int{
+	RoleGuest:     1,
+	RoleMember:    2,
+	RoleModerator: 3,
+	RoleAdmin:     4,
+	RoleOwner:     5,
+}
+
+// возвращает уровень роли для сравнения; неизвестные роли ниже любой известной
+func RoleRank(role string) int {
+	return roleRanks[role]
+}
+
+// проверяет, что роль известна
+func ValidRole(role string) bool {
+	_, ok := roleRanks[role]
+	return ok
+}
@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// DefaultRoomName - комната, в которую попадают сообщения без указания комнаты
+const DefaultRoomName = "general"
+
+// Room - комната чата. SlowModeSeconds задает минимальный интервал между сообщениями
+// одного пользователя (модераторы не ограничены), PostRole - минимальную роль для
+// отправки сообщений; пустая роль пускает любого участника с правом messages.send.
+type Room struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	Name            string    `json:"name" gorm:"uniqueIndex;not null"`
+	Description     string    `json:"description" gorm:"default:''"`
+	CreatedByID     uint      `json:"created_by_id"`
+	SlowModeSeconds int       `json:"slow_mode_seconds" gorm:"default:0"`
+	PostRole        string    `json:"post_role" gorm:"default:''"`
+	StorageUsed     int64     `json:"-" gorm:"default:0"`
+	StorageQuota    *int64    `json:"-"` // переопределение квоты; nil - ROOM_STORAGE_QUOTA_MB
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// ReadOnly сообщает, что писать в комнату могут только отдельные роли
+func (r *Room) ReadOnly() bool {
+	return r.PostRole != ""
+}
+
+// проверяет, может ли роль писать в комнату с учетом ограничения по роли
+func (r *Room) PostingAllowed(role string) bool {
+	return r.PostRole == "" || RoleRank(role) >= RoleRank(r.PostRole)
+}
+
+// RoomMember хранит роль пользователя в конкретной комнате.
+// Роль в комнате может только повысить серверную роль, но не понизить ее.
+type RoomMember struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	RoomID    uint      `json:"room_id" gorm:"uniqueIndex:idx_room_members_room_user;not null"`
+	UserID    uint      `json:"user_id" gorm:"uniqueIndex:idx_room_members_room_user;not null"`
+	User      User      `json:"-"`
+	Role      string    `json:"role" gorm:"not null;default:'member'"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
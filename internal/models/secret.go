@@ -0,0 +1,8 @@
+package models
+
+// Secret - ключ, сгенерированный сервером при первом запуске и хранящийся в базе,
+// чтобы переживать перезапуски; Name - назначение ключа
+type Secret struct {
+	Name  string `gorm:"primaryKey"`
+	Value []byte `gorm:"not null"`
+}
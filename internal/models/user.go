@@ -1,29 +1,98 @@
 package models
 
 import (
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"gorm.io/gorm"
 )
 
 type User struct {
-	ID         uint           `json:"id" gorm:"primaryKey"`
-	Username   string         `json:"username" gorm:"uniqueIndex;not null"`
-	Nickname   string         `json:"nickname" gorm:"default:''"`
-	Avatar     string         `json:"avatar" gorm:"default:''"`
-	Bio        string         `json:"bio" gorm:"default:''"`
-	Password   string         `json:"-" gorm:"not null"`
-	LastActive time.Time      `json:"last_active"`
-	CreatedAt  time.Time      `json:"created_at"`
-	UpdatedAt  time.Time      `json:"updated_at"`
-	DeletedAt  gorm.DeletedAt `json:"-" gorm:"index"`
+	ID            uint           `json:"id" gorm:"primaryKey"`
+	Username      string         `json:"username" gorm:"uniqueIndex;not null"`
+	Nickname      string         `json:"nickname" gorm:"default:''"`
+	Avatar        string         `json:"avatar" gorm:"default:''"`
+	Bio           string         `json:"bio" gorm:"default:''"`
+	Password      string         `json:"-" gorm:"not null"`
+	Email         string         `json:"email" gorm:"index:idx_users_email,unique,where:email <> '';default:''"`
+	EmailVerified bool           `json:"email_verified" gorm:"default:false"`
+	Status        string         `json:"status" gorm:"default:'active'"`
+	Role          string         `json:"role" gorm:"default:'member'"`
+	InviteID      *uint          `json:"invite_id"`
+	StorageUsed   int64          `json:"-" gorm:"default:0"` // байты вложений и аватара
+	StorageQuota  *int64         `json:"-"`                  // переопределение квоты; nil - USER_STORAGE_QUOTA_MB
+	AvatarSize    int64          `json:"-" gorm:"default:0"` // байты всех вариантов текущего аватара
+	PasskeyHandle []byte         `json:"-" gorm:"uniqueIndex"`
+	LastActive    time.Time      `json:"last_active"`
+	CreatedAt     time.Time      `json:"created_at"`
+	UpdatedAt     time.Time      `json:"updated_at"`
+	DeletedAt     gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// AvatarURLPrefix - адрес, по которому отдаются загруженные аватары; в ответах он подписывается.
+// Файл /files/avatars/<имя> хранится в хранилище под ключом AvatarKeyPrefix + <имя>
+const (
+	AvatarURLPrefix = "/files/avatars/"
+	AvatarKeyPrefix = "avatars/"
+)
+
+// AvatarSizes - стороны квадратных вариантов аватара в пикселях; в User.Avatar хранится последний
+var AvatarSizes = []int{32, 64, 256}
+
+// DefaultAvatarURL - адрес сгенерированного аватара с инициалами. Параметр v меняется
+// вместе с никнеймом, чтобы клиенты не показывали закешированные старые инициалы
+func DefaultAvatarURL(username, nickname string) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(nickname))
+	return fmt.Sprintf("/api/users/%s/avatar.svg?v=%08x", url.PathEscape(username), hash.Sum32())
+}
+
+// возвращает адрес аватара пользователя или сгенерированного аватара, если свой не загружен
+func (u *User) AvatarURL() string {
+	if u.Avatar == "" {
+		return DefaultAvatarURL(u.Username, u.Nickname)
+	}
+	return u.Avatar
+}
+
+// возвращает адреса вариантов аватара по размерам; у аватаров, загруженных до появления
+// вариантов, и у сгенерированного SVG все размеры указывают на один адрес
+func (u *User) AvatarVariants() map[string]string {
+	if u.Avatar == "" {
+		variants := make(map[string]string, len(AvatarSizes))
+		for _, size := range AvatarSizes {
+			variants[strconv.Itoa(size)] = u.AvatarURL()
+		}
+		return variants
+	}
+
+	largest := fmt.Sprintf("_%d.png", AvatarSizes[len(AvatarSizes)-1])
+	base, processed := strings.CutSuffix(u.Avatar, largest)
+	processed = processed && strings.HasPrefix(u.Avatar, AvatarURLPrefix)
+
+	variants := make(map[string]string, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		variants[strconv.Itoa(size)] = u.Avatar
+		if processed {
+			variants[strconv.Itoa(size)] = fmt.Sprintf("%s_%d.png", base, size)
+		}
+	}
+	return variants
 }
 
 type Message struct {
-	ID        uint           `json:"id" gorm:"primaryKey"`
-	Username  string         `json:"username" gorm:"not null"`
-	Content   string         `json:"content" gorm:"not null"`
-	CreatedAt time.Time      `json:"created_at"`
-	UpdatedAt time.Time      `json:"updated_at"`
-	DeletedAt gorm.DeletedAt `json:"-" gorm:"index"`
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	RoomID      uint           `json:"room_id" gorm:"index;default:0"`
+	Username    string         `json:"username" gorm:"not null"`
+	Content     string         `json:"content" gorm:"not null"`
+	Shadow      bool           `json:"-" gorm:"index;default:false"`     // отправлено под теневым баном, видно только автору
+	Kind        string         `json:"kind,omitempty" gorm:"default:''"` // voice для голосового сообщения
+	Attachments []Attachment   `json:"attachments,omitempty" gorm:"foreignKey:MessageID"`
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"-" gorm:"index"`
 }
@@ -0,0 +1,100 @@
+package moderation
+
+import (
+	"fmt"
+	"time"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+)
+
+// возвращает действующий бан, мут или теневой бан пользователя, если он есть
+func Active(userID uint, action string) *models.ModerationAction {
+	if userID == 0 {
+		return nil
+	}
+
+	var actions []models.ModerationAction
+	now := time.Now()
+	err := database.DB.
+		Where("user_id = ? AND action = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, action, now).
+		Order("created_at desc").
+		Limit(1).
+		Find(&actions).Error
+	if err != nil || len(actions) == 0 {
+		return nil
+	}
+	return &actions[0]
+}
+
+// записывает действие модератора
+func Record(userID, moderatorID uint, action, reason string, duration time.Duration) (*models.ModerationAction, error) {
+	record := models.ModerationAction{
+		UserID:      userID,
+		ModeratorID: moderatorID,
+		Action:      action,
+		Reason:      reason,
+	}
+	if duration > 0 {
+		expiresAt := time.Now().Add(duration)
+		record.ExpiresAt = &expiresAt
+	}
+
+	if err := database.DB.Create(&record).Error; err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// снимает действующие ограничения и записывает снятие отдельным действием
+func Revoke(userID, moderatorID uint, action, reason string) (int64, error) {
+	lifted := map[string]string{
+		models.ModerationBan:       models.ModerationUnban,
+		models.ModerationMute:      models.ModerationUnmute,
+		models.ModerationShadowBan: models.ModerationUnshadowBan,
+	}[action]
+	if lifted == "" {
+		return 0, fmt.Errorf("action %q cannot be revoked", action)
+	}
+
+	result := database.DB.Model(&models.ModerationAction{}).
+		Where("user_id = ? AND action = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, action, time.Now()).
+		Updates(map[string]interface{}{"revoked_at": time.Now(), "revoked_by_id": moderatorID})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	if _, err := Record(userID, moderatorID, lifted, reason, 0); err != nil {
+		return result.RowsAffected, err
+	}
+	return result.RowsAffected, nil
+}
+
+// описание ограничения для сообщений пользователю
+func Describe(action *models.ModerationAction) string {
+	message := "You are " + map[string]string{
+		models.ModerationBan:  "banned",
+		models.ModerationMute: "muted",
+	}[action.Action]
+	if action.ExpiresAt != nil {
+		message += " until " + action.ExpiresAt.Format(time.RFC3339)
+	}
+	if action.Reason != "" {
+		message += ": " + action.Reason
+	}
+	return message
+}
+
+// создает открытую жалобу; reporterID 0 означает автомодерацию
+func FileReport(messageID, reporterID uint, reason string) (*models.Report, error) {
+	report := models.Report{
+		MessageID:  messageID,
+		ReporterID: reporterID,
+		Reason:     reason,
+		Status:     models.ReportOpen,
+	}
+	if err := database.DB.Create(&report).Error; err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
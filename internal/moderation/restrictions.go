@@ -0,0 +1,96 @@
+package moderation
+
+import (
+	"sync"
+	"time"
+
+	"realtime_chat_platform/internal/config"
+)
+
+// RaidMode - состояние режима рейда; хранится в памяти и сбрасывается при перезапуске
+type RaidMode struct {
+	Enabled     bool       `json:"enabled"`
+	Until       *time.Time `json:"until"`
+	EnabledByID uint       `json:"enabled_by_id,omitempty"`
+}
+
+var (
+	raid      RaidMode
+	raidMutex sync.RWMutex
+)
+
+// включает режим рейда на указанное время
+func EnableRaidMode(moderatorID uint, duration time.Duration) RaidMode {
+	raidMutex.Lock()
+	defer raidMutex.Unlock()
+
+	until := time.Now().Add(duration)
+	raid = RaidMode{Enabled: true, Until: &until, EnabledByID: moderatorID}
+	return raid
+}
+
+func DisableRaidMode() {
+	raidMutex.Lock()
+	defer raidMutex.Unlock()
+	raid = RaidMode{}
+}
+
+// возвращает текущее состояние режима рейда; истекший режим считается выключенным
+func CurrentRaidMode() RaidMode {
+	raidMutex.RLock()
+	defer raidMutex.RUnlock()
+
+	if raid.Enabled && raid.Until != nil && time.Now().After(*raid.Until) {
+		return RaidMode{}
+	}
+	return raid
+}
+
+// Restriction - ограничения, действующие для аккаунта в данный момент
+type Restriction struct {
+	NewAccount  bool          `json:"new_account"`
+	RaidMode    bool          `json:"raid_mode"`
+	BlockLinks  bool          `json:"block_links"`
+	CanPostAt   time.Time     `json:"can_post_at"`
+	RateDivisor int           `json:"rate_divisor"`
+	Cooldown    time.Duration `json:"-"`
+}
+
+// Limited сообщает, снижены ли лимиты частоты сообщений
+func (r Restriction) Limited() bool {
+	return r.RateDivisor > 1
+}
+
+// оставшееся время до разрешения писать
+func (r Restriction) CooldownWait(now time.Time) time.Duration {
+	if wait := r.CanPostAt.Sub(now); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// вычисляет ограничения для аккаунта, созданного в createdAt; освобождение модераторов проверяет вызывающий
+func Restrictions(createdAt time.Time) Restriction {
+	restriction := Restriction{RateDivisor: 1}
+	age := time.Since(createdAt)
+
+	if config.NewAccountAge > 0 && age < config.NewAccountAge {
+		restriction.NewAccount = true
+		restriction.BlockLinks = config.NewAccountBlockLinks
+		restriction.Cooldown = config.NewAccountCooldown
+		restriction.RateDivisor = max(config.NewAccountRateDivisor, 1)
+	}
+
+	if CurrentRaidMode().Enabled {
+		restriction.RaidMode = true
+		restriction.RateDivisor = max(restriction.RateDivisor, config.RaidModeRateDivisor, 1)
+		if age < config.RaidModeAccountAge {
+			restriction.NewAccount = true
+			restriction.BlockLinks = true
+			restriction.Cooldown = max(restriction.Cooldown, config.RaidModeCooldown)
+		}
+	}
+
+	restriction.CanPostAt = createdAt.Add(restriction.Cooldown)
+	return restriction
+}
@@ -0,0 +1,342 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+var ErrUnknownKey = errors.New("oidc: signing key not found")
+
+// JWKS перечитывается не чаще раза в этот интервал: kid в токене выбирает отправитель
+// запроса, и без ограничения каждый поддельный callback вызывал бы запрос к провайдеру
+const keyRefreshInterval = time.Minute
+
+// Metadata - часть документа /.well-known/openid-configuration, нужная клиенту
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Claims - стандартные утверждения ID токена, используемые при входе
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce             string `json:"nonce"`
+	Email             string `json:"email"`
+	EmailVerified     bool   `json:"email_verified"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+
+	// все утверждения токена для сопоставления по настраиваемому имени
+	Raw map[string]interface{} `json:"-"`
+}
+
+// Provider - клиент одного OIDC провайдера с кешем ключей подписи
+type Provider struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	Metadata     Metadata
+
+	client *http.Client
+	mutex  sync.RWMutex
+	keys   map[string]interface{}
+
+	// refreshMutex не дает нескольким запросам перечитывать JWKS одновременно
+	refreshMutex sync.Mutex
+	refreshedAt  time.Time
+}
+
+// загружает метаданные провайдера через discovery
+func Discover(ctx context.Context, issuer, clientID, clientSecret, redirectURL string, scopes []string) (*Provider, error) {
+	p := &Provider{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       scopes,
+		client:       &http.Client{Timeout: 10 * time.Second},
+	}
+
+	wellKnown := strings.TrimRight(issuer, "/") + "/.well-known/openid-configuration"
+	if err := p.getJSON(ctx, wellKnown, &p.Metadata); err != nil {
+		return nil, fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	// издатель из метаданных обязан совпадать с настроенным
+	if p.Metadata.Issuer != issuer {
+		return nil, fmt.Errorf("oidc discovery: issuer mismatch: expected %q, got %q", issuer, p.Metadata.Issuer)
+	}
+
+	return p, nil
+}
+
+// возвращает случайную строку для state, nonce и PKCE verifier
+func RandomString() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// вычисляет PKCE code_challenge по методу S256
+func CodeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// формирует адрес страницы входа провайдера
+func (p *Provider) AuthCodeURL(state, nonce, verifier string) string {
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.ClientID},
+		"redirect_uri":          {p.RedirectURL},
+		"scope":                 {strings.Join(p.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(verifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.Metadata.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.Metadata.AuthorizationEndpoint + sep + params.Encode()
+}
+
+// обменивает код авторизации на ID токен
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.RedirectURL},
+		"client_id":     {p.ClientID},
+		"code_verifier": {verifier},
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.ClientID), url.QueryEscape(p.ClientSecret))
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("oidc token response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK || body.Error != "" {
+		return "", fmt.Errorf("oidc token exchange failed: %s %s", body.Error, body.ErrorDescription)
+	}
+	if body.IDToken == "" {
+		return "", errors.New("oidc token response has no id_token")
+	}
+
+	return body.IDToken, nil
+}
+
+// проверяет подпись, издателя, аудиторию, срок действия и nonce ID токена
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken, nonce string) (*Claims, error) {
+	parser := jwt.NewParser(jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}))
+
+	claims := &Claims{}
+	_, err := parser.ParseWithClaims(rawToken, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return p.key(ctx, kid)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("oidc id token: %w", err)
+	}
+
+	if claims.Issuer != p.Metadata.Issuer {
+		return nil, errors.New("oidc id token: issuer mismatch")
+	}
+	if !claims.VerifyAudience(p.ClientID, true) {
+		return nil, errors.New("oidc id token: audience mismatch")
+	}
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("oidc id token: missing exp")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("oidc id token: missing sub")
+	}
+	if nonce != "" && claims.Nonce != nonce {
+		return nil, errors.New("oidc id token: nonce mismatch")
+	}
+
+	// сохранение всех утверждений для сопоставления по настраиваемому имени
+	if token, _, err := parser.ParseUnverified(rawToken, jwt.MapClaims{}); err == nil {
+		claims.Raw, _ = token.Claims.(jwt.MapClaims)
+	}
+
+	return claims, nil
+}
+
+// возвращает строковое утверждение по имени
+func (c *Claims) String(name string) string {
+	value, _ := c.Raw[name].(string)
+	return value
+}
+
+// возвращает ключ подписи по kid, перечитывая JWKS при ротации ключей. Неизвестный kid
+// после недавнего обновления отклоняется сразу: отрицательный результат действует до
+// следующего разрешенного обновления
+func (p *Provider) key(ctx context.Context, kid string) (interface{}, error) {
+	if key, ok := p.cachedKey(kid); ok {
+		return key, nil
+	}
+
+	p.refreshMutex.Lock()
+	defer p.refreshMutex.Unlock()
+
+	// ключ мог появиться, пока ждали обновления в другом запросе
+	if key, ok := p.cachedKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.refreshedAt) < keyRefreshInterval {
+		return nil, ErrUnknownKey
+	}
+
+	// неудачная попытка тоже считается: недоступный провайдер не опрашивается на каждый запрос
+	p.refreshedAt = time.Now()
+	if err := p.refreshKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	if key, ok := p.cachedKey(kid); ok {
+		return key, nil
+	}
+	return nil, ErrUnknownKey
+}
+
+func (p *Provider) cachedKey(kid string) (interface{}, bool) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.lookupKey(kid)
+}
+
+// без kid допустим только единственный ключ в наборе
+func (p *Provider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *Provider) refreshKeys(ctx context.Context) error {
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := p.getJSON(ctx, p.Metadata.JWKSURI, &set); err != nil {
+		return fmt.Errorf("oidc jwks: %w", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := base64.RawURLEncoding.DecodeString(k.N)
+			e, errE := base64.RawURLEncoding.DecodeString(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := base64.RawURLEncoding.DecodeString(k.X)
+			y, errY := base64.RawURLEncoding.DecodeString(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{
+				Curve: curve,
+				X:     new(big.Int).SetBytes(x),
+				Y:     new(big.Int).SetBytes(y),
+			}
+		}
+	}
+
+	p.mutex.Lock()
+	p.keys = keys
+	p.mutex.Unlock()
+	return nil
+}
+
+func (p *Provider) getJSON(ctx context.Context, target string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d from %s", resp.StatusCode, target)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
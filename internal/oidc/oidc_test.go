@@ -0,0 +1,182 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"realtime_chat_platform/internal/oidc/oidctest"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const testClientID = "chat"
+
+func discover(t *testing.T, issuer *oidctest.Issuer) *Provider {
+	t.Helper()
+	provider, err := Discover(context.Background(), issuer.URL, testClientID, "", "http://chat.test/api/auth/oidc/callback", []string{"openid"})
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	return provider
+}
+
+func TestDiscoverRejectsIssuerMismatch(t *testing.T) {
+	issuer := oidctest.New(testClientID)
+	defer issuer.Close()
+
+	if _, err := Discover(context.Background(), issuer.URL+"/", testClientID, "", "", nil); err == nil {
+		t.Fatal("expected issuer mismatch error")
+	}
+}
+
+func TestExchangeRequiresPKCEVerifier(t *testing.T) {
+	issuer := oidctest.New(testClientID)
+	defer issuer.Close()
+	provider := discover(t, issuer)
+
+	verifier, _ := RandomString()
+	authURL := provider.AuthCodeURL("state", "nonce", verifier)
+
+	code, _, err := issuer.Authorize(authURL, jwt.MapClaims{"sub": "alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Exchange(context.Background(), code, verifier+"x"); err == nil {
+		t.Fatal("exchange with a wrong verifier succeeded")
+	}
+
+	code, _, _ = issuer.Authorize(authURL, jwt.MapClaims{"sub": "alice"})
+	rawToken, err := provider.Exchange(context.Background(), code, verifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	claims, err := provider.VerifyIDToken(context.Background(), rawToken, "nonce")
+	if err != nil {
+		t.Fatalf("VerifyIDToken: %v", err)
+	}
+	if claims.Subject != "alice" {
+		t.Fatalf("subject = %q, want alice", claims.Subject)
+	}
+
+	// код одноразовый
+	if _, err := provider.Exchange(context.Background(), code, verifier); err == nil {
+		t.Fatal("authorization code was accepted twice")
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	issuer := oidctest.New(testClientID)
+	defer issuer.Close()
+	provider := discover(t, issuer)
+
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hour := time.Hour
+
+	tests := []struct {
+		name    string
+		token   string
+		nonce   string
+		wantErr string
+	}{
+		{
+			name:  "valid",
+			token: issuer.Sign(jwt.MapClaims{"sub": "alice", "nonce": "n1"}),
+			nonce: "n1",
+		},
+		{
+			name:    "nonce mismatch",
+			token:   issuer.Sign(jwt.MapClaims{"sub": "alice", "nonce": "n1"}),
+			nonce:   "n2",
+			wantErr: "nonce mismatch",
+		},
+		{
+			name:    "bad signature",
+			token:   oidctest.SignWith(otherKey, issuer.KeyID, jwt.MapClaims{"iss": issuer.URL, "aud": testClientID, "sub": "alice", "exp": time.Now().Add(hour).Unix()}),
+			wantErr: "verification error",
+		},
+		{
+			name:    "expired",
+			token:   issuer.Sign(jwt.MapClaims{"sub": "alice", "exp": time.Now().Add(-hour).Unix()}),
+			wantErr: "expired",
+		},
+		{
+			name:    "wrong audience",
+			token:   issuer.Sign(jwt.MapClaims{"sub": "alice", "aud": "other"}),
+			wantErr: "audience mismatch",
+		},
+		{
+			name:    "wrong issuer",
+			token:   issuer.Sign(jwt.MapClaims{"sub": "alice", "iss": "https://evil.test"}),
+			wantErr: "issuer mismatch",
+		},
+		{
+			name:    "missing subject",
+			token:   issuer.Sign(jwt.MapClaims{}),
+			wantErr: "missing sub",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := provider.VerifyIDToken(context.Background(), tt.token, tt.nonce)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnknownKeyRefreshIsRateLimited(t *testing.T) {
+	issuer := oidctest.New(testClientID)
+	defer issuer.Close()
+	provider := discover(t, issuer)
+
+	valid := issuer.Sign(jwt.MapClaims{"sub": "alice"})
+	if _, err := provider.VerifyIDToken(context.Background(), valid, ""); err != nil {
+		t.Fatal(err)
+	}
+	if got := issuer.JWKSRequests(); got != 1 {
+		t.Fatalf("JWKS requests after first token = %d, want 1", got)
+	}
+
+	// поддельные kid не должны вызывать новые запросы к провайдеру
+	for i := 0; i < 20; i++ {
+		forged := oidctest.SignWith(issuer.Key, "forged", jwt.MapClaims{"sub": "alice"})
+		_, err := provider.VerifyIDToken(context.Background(), forged, "")
+		if !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("error = %v, want ErrUnknownKey", err)
+		}
+	}
+	if got := issuer.JWKSRequests(); got != 1 {
+		t.Fatalf("JWKS requests after forged tokens = %d, want 1", got)
+	}
+
+	// по истечении интервала неизвестный kid снова перечитывает набор, но один раз
+	provider.refreshedAt = time.Now().Add(-keyRefreshInterval)
+	for i := 0; i < 5; i++ {
+		forged := oidctest.SignWith(issuer.Key, "rotated", jwt.MapClaims{"sub": "alice"})
+		provider.VerifyIDToken(context.Background(), forged, "")
+	}
+	if got := issuer.JWKSRequests(); got != 2 {
+		t.Fatalf("JWKS requests after interval = %d, want 2", got)
+	}
+
+	// известный ключ продолжает работать из кеша
+	if _, err := provider.VerifyIDToken(context.Background(), valid, ""); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,196 @@
+// Package oidctest - OIDC провайдер в памяти для тестов: discovery, JWKS,
+// выдача кода авторизации и обмен кода на ID токен с проверкой PKCE
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Issuer - тестовый провайдер с одним ключом подписи
+type Issuer struct {
+	URL      string
+	ClientID string
+	KeyID    string
+	Key      *rsa.PrivateKey
+
+	server       *httptest.Server
+	jwksRequests atomic.Int64
+
+	mutex sync.Mutex
+	codes map[string]grant
+}
+
+// код авторизации вместе с параметрами запроса, к которому он выдан
+type grant struct {
+	clientID    string
+	redirectURI string
+	challenge   string
+	nonce       string
+	claims      jwt.MapClaims
+}
+
+// запускает провайдер с одним RSA ключом подписи
+func New(clientID string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	issuer := &Issuer{
+		ClientID: clientID,
+		KeyID:    "test-key",
+		Key:      key,
+		codes:    make(map[string]grant),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", issuer.discovery)
+	mux.HandleFunc("/jwks", issuer.jwks)
+	mux.HandleFunc("/token", issuer.token)
+	issuer.server = httptest.NewServer(mux)
+	issuer.URL = issuer.server.URL
+	return issuer
+}
+
+func (i *Issuer) Close() {
+	i.server.Close()
+}
+
+// сколько раз клиент запрашивал JWKS
+func (i *Issuer) JWKSRequests() int {
+	return int(i.jwksRequests.Load())
+}
+
+// имитирует вход пользователя на странице провайдера: принимает адрес из AuthCodeURL
+// и возвращает код, по которому токен получит только владелец PKCE verifier
+func (i *Issuer) Authorize(authURL string, claims jwt.MapClaims) (code, state string, err error) {
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		return "", "", err
+	}
+	query := parsed.Query()
+	if query.Get("response_type") != "code" || query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		return "", "", fmt.Errorf("unexpected authorization request %s", parsed.RawQuery)
+	}
+
+	code = randomString()
+	i.mutex.Lock()
+	i.codes[code] = grant{
+		clientID:    query.Get("client_id"),
+		redirectURI: query.Get("redirect_uri"),
+		challenge:   query.Get("code_challenge"),
+		nonce:       query.Get("nonce"),
+		claims:      claims,
+	}
+	i.mutex.Unlock()
+	return code, query.Get("state"), nil
+}
+
+// подписывает ID токен ключом провайдера; iss, aud, iat и exp заполняются, если их нет
+func (i *Issuer) Sign(claims jwt.MapClaims) string {
+	return SignWith(i.Key, i.KeyID, i.withDefaults(claims))
+}
+
+// подписывает токен произвольным ключом, например чужим для проверки подписи
+func SignWith(key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+func (i *Issuer) withDefaults(claims jwt.MapClaims) jwt.MapClaims {
+	result := jwt.MapClaims{
+		"iss": i.URL,
+		"aud": i.ClientID,
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Hour).Unix(),
+	}
+	for name, value := range claims {
+		result[name] = value
+	}
+	return result
+}
+
+func (i *Issuer) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 i.URL,
+		"authorization_endpoint": i.URL + "/authorize",
+		"token_endpoint":         i.URL + "/token",
+		"jwks_uri":               i.URL + "/jwks",
+	})
+}
+
+func (i *Issuer) jwks(w http.ResponseWriter, r *http.Request) {
+	i.jwksRequests.Add(1)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kid": i.KeyID,
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(i.Key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(i.Key.E)).Bytes()),
+		}},
+	})
+}
+
+// обменивает код на ID токен; код одноразовый и требует verifier, соответствующий challenge
+func (i *Issuer) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.PostForm.Get("grant_type") != "authorization_code" {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+
+	i.mutex.Lock()
+	grant, ok := i.codes[r.PostForm.Get("code")]
+	delete(i.codes, r.PostForm.Get("code"))
+	i.mutex.Unlock()
+	if !ok || grant.clientID != r.PostForm.Get("client_id") || grant.redirectURI != r.PostForm.Get("redirect_uri") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != grant.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant", "error_description": "PKCE verification failed"})
+		return
+	}
+
+	claims := jwt.MapClaims{"nonce": grant.nonce}
+	for name, value := range grant.claims {
+		claims[name] = value
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"id_token": i.Sign(claims), "token_type": "Bearer"})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	raw := make([]byte, 16)
+	if _, err := rand.Read(raw); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
@@ -0,0 +1,62 @@
+package password
+
+import (
+	"log"
+
+	"realtime_chat_platform/internal/config"
+)
+
+// алгоритмы, которыми можно проверить сохраненный хеш;
+// новые пароли всегда хешируются алгоритмом Default
+var (
+	bcryptHasher = BcryptHasher{Cost: config.BcryptCost}
+
+	argon2idHasher = Argon2idHasher{Params: Argon2idParams{
+		Memory:      config.Argon2Memory,
+		Iterations:  config.Argon2Iterations,
+		Parallelism: config.Argon2Parallelism,
+		SaltLength:  16,
+		KeyLength:   32,
+	}}
+
+	hashers = []Hasher{argon2idHasher, bcryptHasher}
+)
+
+// Default выбирается переменной PASSWORD_HASHER
+var Default = selectDefault(config.PasswordHasher)
+
+func selectDefault(name string) Hasher {
+	switch name {
+	case "bcrypt":
+		return bcryptHasher
+	case "argon2id":
+		return argon2idHasher
+	default:
+		log.Printf("Unknown password hasher %q, using argon2id", name)
+		return argon2idHasher
+	}
+}
+
+// хеширует пароль алгоритмом по умолчанию
+func Hash(password string) (string, error) {
+	return Default.Hash(password)
+}
+
+// проверяет пароль по хешу любого поддерживаемого алгоритма;
+// needsRehash означает, что хеш стоит пересчитать алгоритмом по умолчанию
+func Verify(hash, password string) (ok bool, needsRehash bool, err error) {
+	for _, hasher := range hashers {
+		if !hasher.Recognizes(hash) {
+			continue
+		}
+
+		ok, err = hasher.Verify(hash, password)
+		if err != nil || !ok {
+			return false, false, err
+		}
+
+		return true, hasher != Default || Default.NeedsRehash(hash), nil
+	}
+
+	return false, false, ErrUnknownHashFormat
+}
@@ -0,0 +1,99 @@
+package password
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"realtime_chat_platform/internal/config"
+)
+
+var ErrBreached = errors.New("password has appeared in a data breach, choose another one")
+
+// Policy описывает требования к новым паролям
+type Policy struct {
+	MinLength int
+	MaxLength int
+	// предел в байтах UTF-8; у bcrypt это 72 байта, длиннее он пароли не принимает
+	MaxBytes int
+	// SHA-1 хеши утекших паролей в верхнем регистре
+	breached map[string]struct{}
+}
+
+// DefaultPolicy применяется при регистрации и смене пароля
+var DefaultPolicy = newPolicy()
+
+func newPolicy() *Policy {
+	policy := &Policy{
+		MinLength: config.PasswordMinLength,
+		MaxLength: config.PasswordMaxLength,
+	}
+	if _, ok := Default.(BcryptHasher); ok {
+		policy.MaxBytes = bcryptMaxBytes
+	}
+
+	if config.PasswordBreachedList != "" {
+		if err := policy.LoadBreachedList(config.PasswordBreachedList); err != nil {
+			log.Printf("Failed to load breached password list: %v", err)
+		}
+	}
+
+	return policy
+}
+
+// загружает список SHA-1 хешей утекших паролей;
+// поддерживаются строки вида HASH и HASH:COUNT (формат Have I Been Pwned)
+func (p *Policy) LoadBreachedList(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	breached := make(map[string]struct{})
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hash, _, _ := strings.Cut(line, ":")
+		breached[strings.ToUpper(hash)] = struct{}{}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	p.breached = breached
+	log.Printf("Loaded %d breached password hashes", len(breached))
+	return nil
+}
+
+// проверяет пароль на соответствие политике
+func (p *Policy) Validate(password string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return fmt.Errorf("password must be at least %d characters long", p.MinLength)
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return fmt.Errorf("password must be at most %d characters long", p.MaxLength)
+	}
+	if p.MaxBytes > 0 && len(password) > p.MaxBytes {
+		return fmt.Errorf("password must be at most %d bytes long; letters outside Latin take 2 or more bytes each", p.MaxBytes)
+	}
+
+	if len(p.breached) > 0 {
+		sum := sha1.Sum([]byte(password))
+		if _, found := p.breached[strings.ToUpper(hex.EncodeToString(sum[:]))]; found {
+			return ErrBreached
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package password
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBcryptPolicyLimitsBytes(t *testing.T) {
+	previous := Default
+	t.Cleanup(func() { Default = previous })
+	Default = bcryptHasher
+	policy := newPolicy()
+
+	tests := []struct {
+		name     string
+		password string
+		valid    bool
+	}{
+		{"72 ASCII bytes", strings.Repeat("a", 72), true},
+		{"73 ASCII bytes", strings.Repeat("a", 73), false},
+		// 40 символов кириллицы - 80 байт, хотя символов меньше PASSWORD_MAX_LENGTH
+		{"multibyte characters", strings.Repeat("я", 40), false},
+	}
+	for _, tt := range tests {
+		err := policy.Validate(tt.password)
+		if (err == nil) != tt.valid {
+			t.Errorf("%s: Validate = %v, want valid %t", tt.name, err, tt.valid)
+		}
+		// все, что пропускает политика, bcrypt должен уметь захешировать
+		if err == nil {
+			if _, err := Default.Hash(tt.password); err != nil {
+				t.Errorf("%s: Hash = %v", tt.name, err)
+			}
+		}
+	}
+
+	Default = argon2idHasher
+	if err := newPolicy().Validate(strings.Repeat("a", 100)); err != nil {
+		t.Errorf("argon2id policy rejected a 100 byte password: %v", err)
+	}
+}
@@ -0,0 +1,190 @@
+// Package quarantine держит загруженные вложения в карантине, пока сканер их не проверит.
+// Файл в карантине лежит под models.QuarantineKeyPrefix и недоступен никому, включая автора.
+// Чистый файл переносится под models.AttachmentKeyPrefix, зараженный удаляется вместе с вложением
+package quarantine
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/fileurl"
+	"realtime_chat_platform/internal/media"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/quota"
+	"realtime_chat_platform/internal/scanner"
+	"realtime_chat_platform/internal/storage"
+	"realtime_chat_platform/internal/websocket"
+)
+
+// сколько раз пытаться проверить файл, если сканер недоступен, и пауза между попытками
+const (
+	scanAttempts = 3
+	retryDelay   = 10 * time.Second
+)
+
+var queue = make(chan uint, 1024)
+
+// Start запускает проверку и ставит в очередь вложения, оставшиеся в карантине до перезапуска,
+// в том числе те, которые не удалось проверить
+func Start(workers int) {
+	for i := 0; i < max(workers, 1); i++ {
+		go worker()
+	}
+
+	go func() {
+		var ids []uint
+		err := database.DB.Model(&models.Attachment{}).
+			Where("scan_status IN ?", []string{models.ScanPending, models.ScanFailed}).Pluck("id", &ids).Error
+		if err != nil {
+			log.Printf("Error loading quarantined attachments: %v", err)
+			return
+		}
+		for _, id := range ids {
+			queue <- id
+		}
+	}()
+}
+
+// Enqueue ставит вложение на проверку; при переполнении очереди оно останется в карантине
+// до перезапуска
+func Enqueue(id uint) {
+	select {
+	case queue <- id:
+	default:
+		log.Printf("Scan queue is full, attachment %d left in quarantine", id)
+	}
+}
+
+func worker() {
+	for id := range queue {
+		var attachment models.Attachment
+		if err := database.DB.First(&attachment, id).Error; err != nil || !attachment.Quarantined() {
+			continue
+		}
+		if err := Scan(&attachment); err != nil {
+			log.Printf("Error scanning attachment %d: %v", id, err)
+		}
+	}
+}
+
+// Scan проверяет вложение из карантина и выпускает или отклоняет его. Если сканер
+// недоступен, вложение остается в карантине со статусом failed
+func Scan(attachment *models.Attachment) error {
+	// сканер отключили, пока файл ждал проверки
+	if !scanner.Enabled() {
+		return release(attachment)
+	}
+
+	var (
+		result scanner.Result
+		err    error
+	)
+	for attempt := 1; attempt <= scanAttempts; attempt++ {
+		if result, err = scanBlob(attachment.Path); err == nil {
+			break
+		}
+		if attempt < scanAttempts {
+			time.Sleep(retryDelay * time.Duration(attempt))
+		}
+	}
+	if err != nil {
+		if attachment.ScanStatus != models.ScanFailed {
+			database.DB.Model(attachment).UpdateColumn("scan_status", models.ScanFailed)
+			attachment.ScanStatus = models.ScanFailed
+			notify(attachment, "attachment_scanned", "")
+		}
+		return err
+	}
+
+	if result.Infected {
+		return reject(attachment, result.Signature)
+	}
+	return release(attachment)
+}
+
+func scanBlob(key string) (scanner.Result, error) {
+	blob, err := storage.Store.Open(key)
+	if err != nil {
+		return scanner.Result{}, err
+	}
+	defer blob.Close()
+	return scanner.Default.Scan(context.Background(), blob)
+}
+
+// переносит чистый файл из карантина и запускает обработку превью
+func release(attachment *models.Attachment) error {
+	key := models.AttachmentKeyPrefix + strings.TrimPrefix(attachment.Path, models.QuarantineKeyPrefix)
+	if err := copyBlob(attachment.Path, key, attachment.ContentType); err != nil {
+		return fmt.Errorf("release from quarantine: %w", err)
+	}
+
+	// вложение могли удалить, пока оно проверялось
+	result := database.DB.Model(&models.Attachment{}).
+		Where("id = ? AND scan_status IN ?", attachment.ID, []string{models.ScanPending, models.ScanFailed}).
+		Updates(map[string]interface{}{"scan_status": models.ScanClean, "path": key})
+	if result.Error != nil || result.RowsAffected == 0 {
+		storage.Store.Delete(key)
+		return result.Error
+	}
+	storage.Store.Delete(attachment.Path)
+
+	attachment.ScanStatus = models.ScanClean
+	attachment.Path = key
+	if attachment.MediaStatus == models.MediaPending {
+		media.Enqueue(attachment.ID)
+	}
+	notify(attachment, "attachment_scanned", "")
+	return nil
+}
+
+// удаляет зараженное вложение, освобождает место автора и пишет событие в журнал аудита
+func reject(attachment *models.Attachment, signature string) error {
+	result := database.DB.Delete(&models.Attachment{}, attachment.ID)
+	if result.Error != nil {
+		return result.Error
+	}
+	// вложение уже удалил автор, место и файл освобождены вместе с ним
+	if result.RowsAffected == 0 {
+		return nil
+	}
+	if err := storage.Store.Delete(attachment.Path); err != nil {
+		log.Printf("Error deleting infected attachment %d: %v", attachment.ID, err)
+	}
+	if err := quota.ReleaseUser(attachment.UserID, attachment.Size); err != nil {
+		log.Printf("Error releasing storage of user %d: %v", attachment.UserID, err)
+	}
+
+	audit.RecordSystem(audit.Event{
+		Action:     models.AuditUploadInfected,
+		TargetType: "user",
+		TargetID:   attachment.UserID,
+		Details:    fmt.Sprintf("attachment %s (%d bytes): %s", attachment.Filename, attachment.Size, signature),
+	})
+	log.Printf("Attachment %d of user %d rejected: %s", attachment.ID, attachment.UserID, signature)
+
+	notify(attachment, "attachment_rejected", "Malware detected: "+signature)
+	return nil
+}
+
+// копирует объект под новый ключ; переименования в хранилище нет, S3 его тоже не поддерживает
+func copyBlob(from, to, contentType string) error {
+	blob, err := storage.Store.Open(from)
+	if err != nil {
+		return err
+	}
+	defer blob.Close()
+	return storage.Store.Put(to, blob, blob.Info().Size, contentType)
+}
+
+// сообщает автору итог проверки: неотправленное вложение видит только он
+func notify(attachment *models.Attachment, eventType, reason string) {
+	websocket.GlobalHub.SendToUser(attachment.UserID, websocket.Personal(func(userID uint) interface{} {
+		signed := fileurl.Attachment(*attachment, userID)
+		return websocket.AttachmentEvent{Type: eventType, Attachment: &signed, Reason: reason}
+	}))
+}
@@ -0,0 +1,134 @@
+package quarantine
+
+import (
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/scanner"
+	"realtime_chat_platform/internal/storage"
+)
+
+const eicar = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// база и локальное хранилище во временном каталоге, сканер EICAR
+func setup(t *testing.T) *models.User {
+	t.Helper()
+	t.Setenv("DB_PATH", filepath.Join(t.TempDir(), "test.db"))
+	database.InitDB()
+
+	previousStore, previousScanner := storage.Store, scanner.Default
+	t.Cleanup(func() { storage.Store, scanner.Default = previousStore, previousScanner })
+	storage.Store = storage.NewLocal(t.TempDir())
+	scanner.Default = scanner.EICAR{}
+
+	user := &models.User{Username: "uploader", Password: "!", Status: models.UserStatusActive, StorageUsed: 1000}
+	if err := database.DB.Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// кладет файл в карантин так же, как загрузка при включенном сканере
+func quarantined(t *testing.T, user *models.User, name, content string) *models.Attachment {
+	t.Helper()
+	key := models.QuarantineKeyPrefix + name
+	if err := storage.Store.Put(key, strings.NewReader(content), int64(len(content)), "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	attachment := &models.Attachment{
+		UserID:      user.ID,
+		Filename:    name,
+		ContentType: "text/plain",
+		Size:        int64(len(content)),
+		Path:        key,
+		ScanStatus:  models.ScanPending,
+	}
+	if err := database.DB.Create(attachment).Error; err != nil {
+		t.Fatal(err)
+	}
+	return attachment
+}
+
+func TestScanReleasesCleanFile(t *testing.T) {
+	user := setup(t)
+	attachment := quarantined(t, user, "notes.txt", "meeting notes")
+
+	if err := Scan(attachment); err != nil {
+		t.Fatal(err)
+	}
+
+	var stored models.Attachment
+	if err := database.DB.First(&stored, attachment.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.ScanStatus != models.ScanClean || stored.Path != models.AttachmentKeyPrefix+"notes.txt" {
+		t.Fatalf("released attachment = %+v", stored)
+	}
+
+	blob, err := storage.Store.Open(stored.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(blob)
+	blob.Close()
+	if string(data) != "meeting notes" {
+		t.Fatalf("released content = %q", data)
+	}
+	if _, err := storage.Store.Open(models.QuarantineKeyPrefix + "notes.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("quarantined copy left behind: %v", err)
+	}
+}
+
+func TestScanRejectsInfectedFile(t *testing.T) {
+	user := setup(t)
+	attachment := quarantined(t, user, "eicar.com", eicar)
+
+	if err := Scan(attachment); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int64
+	database.DB.Model(&models.Attachment{}).Where("id = ?", attachment.ID).Count(&count)
+	if count != 0 {
+		t.Fatal("infected attachment was not deleted")
+	}
+	if _, err := storage.Store.Open(attachment.Path); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("infected file left in storage: %v", err)
+	}
+	if _, err := storage.Store.Open(models.AttachmentKeyPrefix + "eicar.com"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("infected file was released: %v", err)
+	}
+
+	var stored models.User
+	database.DB.First(&stored, user.ID)
+	if want := 1000 - int64(len(eicar)); stored.StorageUsed != want {
+		t.Fatalf("storage used = %d, want %d", stored.StorageUsed, want)
+	}
+
+	var entry models.AuditEntry
+	if err := database.DB.Where("action = ?", models.AuditUploadInfected).First(&entry).Error; err != nil {
+		t.Fatalf("no audit entry: %v", err)
+	}
+	if entry.TargetID != user.ID || !strings.Contains(entry.Details, "Eicar-Test-Signature") {
+		t.Fatalf("audit entry = %+v", entry)
+	}
+}
+
+// вложение удалили, пока оно ждало проверки: выпускать нечего
+func TestScanSkipsDeletedAttachment(t *testing.T) {
+	user := setup(t)
+	attachment := quarantined(t, user, "gone.txt", "content")
+	database.DB.Delete(&models.Attachment{}, attachment.ID)
+
+	if err := Scan(attachment); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := storage.Store.Open(models.AttachmentKeyPrefix + "gone.txt"); !errors.Is(err, storage.ErrNotFound) {
+		t.Fatalf("deleted attachment was released: %v", err)
+	}
+}
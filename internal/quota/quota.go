@@ -0,0 +1,134 @@
+// Package quota учитывает занятое пользователями и комнатами место в хранилище.
+// Счетчики хранятся в users.storage_used и rooms.storage_used и меняются атомарно
+// вместе с проверкой квоты, поэтому параллельные загрузки не превышают ее
+package quota
+
+import (
+	"fmt"
+
+	"realtime_chat_platform/internal/config"
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// ExceededError - загрузка не помещается в квоту пользователя или комнаты
+type ExceededError struct {
+	Owner     string // user или room
+	Used      int64
+	Quota     int64
+	Requested int64
+}
+
+func (e *ExceededError) Error() string {
+	return fmt.Sprintf("%s storage quota exceeded: %s of %s used, %s more requested",
+		e.Owner, FormatBytes(e.Used), FormatBytes(e.Quota), FormatBytes(e.Requested))
+}
+
+// Usage - занятое место и действующая квота; Quota 0 означает отсутствие ограничения
+type Usage struct {
+	Used  int64 `json:"used_bytes"`
+	Quota int64 `json:"quota_bytes"`
+}
+
+// Remaining возвращает свободное место или -1, если квоты нет
+func (u Usage) Remaining() int64 {
+	if u.Quota == 0 {
+		return -1
+	}
+	return max(u.Quota-u.Used, 0)
+}
+
+// UserQuota возвращает квоту пользователя с учетом переопределения администратором
+func UserQuota(user *models.User) int64 {
+	if user.StorageQuota != nil {
+		return *user.StorageQuota
+	}
+	return config.UserStorageQuota
+}
+
+// RoomQuota возвращает квоту комнаты с учетом переопределения администратором
+func RoomQuota(room *models.Room) int64 {
+	if room.StorageQuota != nil {
+		return *room.StorageQuota
+	}
+	return config.RoomStorageQuota
+}
+
+// ReserveUser добавляет bytes к занятому пользователем месту, если оно помещается в квоту.
+// Отрицательный bytes (замена аватара меньшим) проходит всегда
+func ReserveUser(userID uint, bytes int64) error {
+	var user models.User
+	if err := database.DB.Select("id", "storage_used", "storage_quota").First(&user, userID).Error; err != nil {
+		return err
+	}
+	return reserve(&models.User{}, userID, "user", user.StorageUsed, UserQuota(&user), bytes)
+}
+
+// ReserveRoom добавляет bytes к месту, занятому вложениями комнаты, если оно помещается в квоту
+func ReserveRoom(roomID uint, bytes int64) error {
+	var room models.Room
+	if err := database.DB.Select("id", "storage_used", "storage_quota").First(&room, roomID).Error; err != nil {
+		return err
+	}
+	return reserve(&models.Room{}, roomID, "room", room.StorageUsed, RoomQuota(&room), bytes)
+}
+
+func reserve(model interface{}, id uint, owner string, used, limit, bytes int64) error {
+	query := database.DB.Model(model).Where("id = ?", id)
+	if limit > 0 && bytes > 0 {
+		// проверка в самом UPDATE: параллельная загрузка не проскочит между чтением и записью
+		query = query.Where("storage_used + ? <= ?", bytes, limit)
+	}
+	result := query.UpdateColumn("storage_used", gorm.Expr("MAX(storage_used + ?, 0)", bytes))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &ExceededError{Owner: owner, Used: used, Quota: limit, Requested: bytes}
+	}
+	return nil
+}
+
+// ReleaseUser освобождает место пользователя после удаления файла или неудачной загрузки
+func ReleaseUser(userID uint, bytes int64) error {
+	return release(&models.User{}, userID, bytes)
+}
+
+// ReleaseRoom освобождает место комнаты после удаления вложений
+func ReleaseRoom(roomID uint, bytes int64) error {
+	return release(&models.Room{}, roomID, bytes)
+}
+
+func release(model interface{}, id uint, bytes int64) error {
+	return database.DB.Model(model).Where("id = ?", id).
+		UpdateColumn("storage_used", gorm.Expr("MAX(storage_used - ?, 0)", bytes)).Error
+}
+
+// Recalculate пересчитывает все счетчики по вложениям и аватарам, например после обновления
+// или если счетчики разошлись с данными
+func Recalculate() error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`UPDATE users SET storage_used = avatar_size +
+			COALESCE((SELECT SUM(size) FROM attachments WHERE attachments.user_id = users.id), 0)`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`UPDATE rooms SET storage_used = COALESCE((SELECT SUM(attachments.size) FROM attachments
+			JOIN messages ON messages.id = attachments.message_id
+			WHERE messages.room_id = rooms.id AND messages.deleted_at IS NULL), 0)`).Error
+	})
+}
+
+// FormatBytes выводит размер в удобных единицах для сообщений об ошибках
+func FormatBytes(bytes int64) string {
+	switch {
+	case bytes >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(bytes)/(1<<30))
+	case bytes >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(bytes)/(1<<20))
+	case bytes >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(bytes)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", bytes)
+}
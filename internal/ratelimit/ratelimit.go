@@ -0,0 +1,101 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// Bucket - классический token bucket: Rate токенов в секунду, не более Burst в запасе
+type Bucket struct {
+	Rate   float64
+	Burst  float64
+	tokens float64
+	last   time.Time
+	mutex  sync.Mutex
+}
+
+// создает полный bucket на perMinute событий в минуту
+func NewBucket(perMinute, burst int) *Bucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Bucket{
+		Rate:   float64(perMinute) / 60,
+		Burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// списывает токен; при нехватке возвращает время до появления следующего
+func (b *Bucket) Allow() (bool, time.Duration) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.Rate
+	if b.tokens > b.Burst {
+		b.tokens = b.Burst
+	}
+	b.last = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	if b.Rate <= 0 {
+		return false, time.Minute
+	}
+	wait := time.Duration((1 - b.tokens) / b.Rate * float64(time.Second))
+	return false, wait
+}
+
+// простаивает ли bucket достаточно долго, чтобы снова быть полным
+func (b *Bucket) idle(now time.Time) bool {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.Rate <= 0 {
+		return now.Sub(b.last) > time.Hour
+	}
+	return b.tokens+now.Sub(b.last).Seconds()*b.Rate >= b.Burst
+}
+
+// Limiter хранит bucket'ы по ключам, например общие для всех соединений пользователя
+type Limiter struct {
+	perMinute int
+	burst     int
+	buckets   map[string]*Bucket
+	mutex     sync.Mutex
+	swept     time.Time
+}
+
+func NewLimiter(perMinute, burst int) *Limiter {
+	return &Limiter{
+		perMinute: perMinute,
+		burst:     burst,
+		buckets:   make(map[string]*Bucket),
+		swept:     time.Now(),
+	}
+}
+
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mutex.Lock()
+	now := time.Now()
+	// полные bucket'ы ничем не отличаются от новых и удаляются, чтобы карта не росла
+	if now.Sub(l.swept) > time.Minute {
+		for k, bucket := range l.buckets {
+			if bucket.idle(now) {
+				delete(l.buckets, k)
+			}
+		}
+		l.swept = now
+	}
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = NewBucket(l.perMinute, l.burst)
+		l.buckets[key] = bucket
+	}
+	l.mutex.Unlock()
+
+	return bucket.Allow()
+}
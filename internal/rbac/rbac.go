@@ -0,0 +1,113 @@
+package rbac
+
+import (
+	"sort"
+
+	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/models"
+)
+
+type Permission string
+
+const (
+	MessagesRead      Permission = "messages.read"
+	MessagesSend      Permission = "messages.send"
+	MessagesDeleteAny Permission = "messages.delete_any"
+	UsersModerate     Permission = "users.moderate"
+	UsersApprove      Permission = "users.approve"
+	RoomsCreate       Permission = "rooms.create"
+	RoomsManage       Permission = "rooms.manage"
+	RolesAssign       Permission = "roles.assign"
+	InvitesManage     Permission = "invites.manage"
+	AutomodManage     Permission = "automod.manage"
+	AuditRead         Permission = "audit.read"
+	StorageManage     Permission = "storage.manage"
+)
+
+// права, которые роль добавляет к правам всех ролей ниже нее
+var grants = map[string][]Permission{
+	models.RoleGuest:     {MessagesRead},
+	models.RoleMember:    {MessagesSend},
+	models.RoleModerator: {MessagesDeleteAny, UsersModerate},
+	models.RoleAdmin:     {UsersApprove, RoomsCreate, RoomsManage, RolesAssign, InvitesManage, AutomodManage, AuditRead, StorageManage},
+	models.RoleOwner:     {},
+}
+
+// матрица прав с учетом наследования от младших ролей
+var matrix = buildMatrix()
+
+func buildMatrix() map[string]map[Permission]bool {
+	result := make(map[string]map[Permission]bool)
+	for _, role := range models.Roles {
+		result[role] = make(map[Permission]bool)
+		for _, lower := range models.Roles {
+			if models.RoleRank(lower) > models.RoleRank(role) {
+				continue
+			}
+			for _, permission := range grants[lower] {
+				result[role][permission] = true
+			}
+		}
+	}
+	return result
+}
+
+// Matrix возвращает права каждой роли для отображения клиентам
+func Matrix() map[string][]Permission {
+	result := make(map[string][]Permission)
+	for _, role := range models.Roles {
+		result[role] = []Permission{}
+		for permission := range matrix[role] {
+			result[role] = append(result[role], permission)
+		}
+		sort.Slice(result[role], func(i, j int) bool { return result[role][i] < result[role][j] })
+	}
+	return result
+}
+
+// проверяет, есть ли у роли право
+func Can(role string, permission Permission) bool {
+	return matrix[role][permission]
+}
+
+// возвращает серверную роль; первого владельца назначает chatctl create-owner
+func ServerRole(user *models.User) string {
+	if user == nil {
+		return models.RoleGuest
+	}
+	if !models.ValidRole(user.Role) {
+		return models.RoleMember
+	}
+	return user.Role
+}
+
+// возвращает роль пользователя в комнате: большую из серверной и комнатной
+func EffectiveRole(user *models.User, roomID uint) string {
+	role := ServerRole(user)
+	if user == nil || roomID == 0 {
+		return role
+	}
+
+	var member models.RoomMember
+	if err := database.DB.Where("room_id = ? AND user_id = ?", roomID, user.ID).First(&member).Error; err == nil {
+		if models.RoleRank(member.Role) > models.RoleRank(role) {
+			role = member.Role
+		}
+	}
+	return role
+}
+
+// проверяет право пользователя; roomID == 0 означает проверку на уровне сервера
+func UserCan(user *models.User, roomID uint, permission Permission) bool {
+	return Can(EffectiveRole(user, roomID), permission)
+}
+
+// проверяет, может ли роль actor сменить роль current на next:
+// назначать и снимать можно только роли ниже собственной
+func CanAssign(actor, current, next string) bool {
+	if !Can(actor, RolesAssign) || !models.ValidRole(next) {
+		return false
+	}
+	rank := models.RoleRank(actor)
+	return models.RoleRank(current) < rank && models.RoleRank(next) < rank
+}
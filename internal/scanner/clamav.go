@@ -0,0 +1,106 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+// размер куска INSTREAM; clamd принимает куски до StreamMaxLength целиком
+const clamChunkSize = 64 << 10
+
+// ClamAV проверяет файлы через clamd по протоколу INSTREAM: файл передается кусками
+// вида <длина uint32 big-endian><данные>, нулевая длина завершает поток
+type ClamAV struct {
+	Network string // tcp или unix
+	Address string
+	Timeout time.Duration
+}
+
+// NewClamAV принимает host:port или путь к unix-сокету clamd
+func NewClamAV(address string, timeout time.Duration) *ClamAV {
+	network := "tcp"
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		network, address = "unix", path
+	} else if strings.HasPrefix(address, "/") {
+		network = "unix"
+	}
+	return &ClamAV{Network: network, Address: address, Timeout: timeout}
+}
+
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, c.Network, c.Address)
+	if err != nil {
+		return Result{}, fmt.Errorf("clamd: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	// при превышении StreamMaxLength clamd отвечает ошибкой и закрывает соединение,
+	// поэтому после неудачной записи ответ все равно читается
+	writeErr := stream(conn, r)
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil {
+		if writeErr != nil {
+			return Result{}, fmt.Errorf("clamd: %w", writeErr)
+		}
+		return Result{}, fmt.Errorf("clamd: read reply: %w", err)
+	}
+	return parseClamReply(strings.TrimSuffix(reply, "\x00"))
+}
+
+func stream(conn net.Conn, r io.Reader) error {
+	// префикс z: команда и ответ завершаются нулевым байтом
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4+clamChunkSize)
+	for {
+		n, err := r.Read(buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf, uint32(n))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+	_, err := conn.Write([]byte{0, 0, 0, 0})
+	return err
+}
+
+// ответы clamd: "stream: OK", "stream: <сигнатура> FOUND", "<описание> ERROR"
+func parseClamReply(reply string) (Result, error) {
+	reply = strings.TrimSpace(reply)
+	status := strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case status == "OK":
+		return Result{}, nil
+	case strings.HasSuffix(status, " FOUND"):
+		return Result{Infected: true, Signature: strings.TrimSuffix(status, " FOUND")}, nil
+	case reply == "":
+		return Result{}, errors.New("clamd: empty reply")
+	}
+	return Result{}, fmt.Errorf("clamd: %s", reply)
+}
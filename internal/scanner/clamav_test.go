@@ -0,0 +1,248 @@
+package scanner
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clamd на локальном сокете: принимает INSTREAM, запоминает размеры кусков
+// и отвечает reply(содержимое)
+type fakeClamd struct {
+	listener net.Listener
+	// как StreamMaxLength: при превышении ответ "INSTREAM size limit exceeded" и обрыв
+	maxLength int
+	reply     func(data []byte) string
+
+	mu       sync.Mutex
+	commands []string
+	chunks   []int
+}
+
+func newFakeClamd(t *testing.T, network string) *fakeClamd {
+	t.Helper()
+	address := "127.0.0.1:0"
+	if network == "unix" {
+		address = filepath.Join(t.TempDir(), "clamd.sock")
+	}
+	listener, err := net.Listen(network, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	clamd := &fakeClamd{listener: listener, reply: func(data []byte) string {
+		if bytes.Contains(data, []byte(eicarSignature)) {
+			return "stream: Win.Test.EICAR_HDB-1 FOUND"
+		}
+		return "stream: OK"
+	}}
+	go clamd.serve()
+	return clamd
+}
+
+func (f *fakeClamd) client() *ClamAV {
+	return &ClamAV{Network: f.listener.Addr().Network(), Address: f.listener.Addr().String(), Timeout: 5 * time.Second}
+}
+
+func (f *fakeClamd) serve() {
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeClamd) handle(conn net.Conn) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	command, err := reader.ReadString(0)
+	if err != nil {
+		return
+	}
+	f.mu.Lock()
+	f.commands = append(f.commands, command)
+	f.mu.Unlock()
+	if command != "zINSTREAM\x00" {
+		conn.Write([]byte("UNKNOWN COMMAND\x00"))
+		return
+	}
+
+	var data []byte
+	for {
+		var size uint32
+		if err := binary.Read(reader, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(reader, chunk); err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.chunks = append(f.chunks, int(size))
+		f.mu.Unlock()
+
+		data = append(data, chunk...)
+		if f.maxLength > 0 && len(data) > f.maxLength {
+			conn.Write([]byte("INSTREAM size limit exceeded. ERROR\x00"))
+			return
+		}
+	}
+	conn.Write([]byte(f.reply(data) + "\x00"))
+}
+
+func TestClamAVStreamsInChunks(t *testing.T) {
+	for _, network := range []string{"tcp", "unix"} {
+		t.Run(network, func(t *testing.T) {
+			clamd := newFakeClamd(t, network)
+			data := bytes.Repeat([]byte("a"), 2*clamChunkSize+1000)
+
+			result, err := clamd.client().Scan(context.Background(), bytes.NewReader(data))
+			if err != nil || result.Infected {
+				t.Fatalf("Scan = %+v, %v", result, err)
+			}
+
+			clamd.mu.Lock()
+			defer clamd.mu.Unlock()
+			if len(clamd.commands) != 1 || clamd.commands[0] != "zINSTREAM\x00" {
+				t.Fatalf("commands = %q", clamd.commands)
+			}
+			want := []int{clamChunkSize, clamChunkSize, 1000}
+			if len(clamd.chunks) != len(want) {
+				t.Fatalf("chunks = %v, want %v", clamd.chunks, want)
+			}
+			for i := range want {
+				if clamd.chunks[i] != want[i] {
+					t.Fatalf("chunks = %v, want %v", clamd.chunks, want)
+				}
+			}
+		})
+	}
+}
+
+func TestClamAVReplies(t *testing.T) {
+	tests := []struct {
+		name      string
+		data      string
+		reply     string
+		infected  bool
+		signature string
+		wantErr   string
+	}{
+		{name: "clean", data: "hello", reply: "stream: OK"},
+		{name: "empty file", data: "", reply: "stream: OK"},
+		{name: "eicar", data: "prefix " + eicarSignature, infected: true, signature: "Win.Test.EICAR_HDB-1"},
+		{name: "found", data: "x", reply: "stream: Some.Malware FOUND", infected: true, signature: "Some.Malware"},
+		{name: "error", data: "x", reply: "stream: Can't allocate memory ERROR", wantErr: "Can't allocate memory ERROR"},
+		{name: "empty reply", data: "x", reply: "", wantErr: "empty reply"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clamd := newFakeClamd(t, "tcp")
+			if tt.reply != "" || tt.wantErr != "" {
+				clamd.reply = func([]byte) string { return tt.reply }
+			}
+
+			result, err := clamd.client().Scan(context.Background(), strings.NewReader(tt.data))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Scan = %+v, %v, want error %q", result, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Infected != tt.infected || result.Signature != tt.signature {
+				t.Fatalf("Scan = %+v, want infected %t with %q", result, tt.infected, tt.signature)
+			}
+		})
+	}
+}
+
+func TestClamAVSizeLimit(t *testing.T) {
+	clamd := newFakeClamd(t, "tcp")
+	clamd.maxLength = clamChunkSize
+
+	// clamd обрывает соединение посреди потока, ответ все равно должен быть прочитан
+	result, err := clamd.client().Scan(context.Background(), bytes.NewReader(make([]byte, 64*clamChunkSize)))
+	if err == nil || !strings.Contains(err.Error(), "size limit exceeded") {
+		t.Fatalf("Scan = %+v, %v, want size limit error", result, err)
+	}
+}
+
+func TestClamAVFailsWithoutDaemon(t *testing.T) {
+	clamd := newFakeClamd(t, "tcp")
+	client := clamd.client()
+	clamd.listener.Close()
+
+	if _, err := client.Scan(context.Background(), strings.NewReader("x")); err == nil {
+		t.Fatal("Scan succeeded without clamd")
+	}
+}
+
+func TestClamAVTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	// принимает соединение и молчит
+	go func() {
+		conn, err := listener.Accept()
+		if err == nil {
+			defer conn.Close()
+			io.Copy(io.Discard, conn)
+		}
+	}()
+
+	client := &ClamAV{Network: "tcp", Address: listener.Addr().String(), Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	if _, err := client.Scan(context.Background(), strings.NewReader("x")); err == nil {
+		t.Fatal("Scan succeeded without a reply")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Fatalf("Scan took %v despite the timeout", elapsed)
+	}
+}
+
+func TestNewClamAV(t *testing.T) {
+	tests := []struct {
+		address, network, want string
+	}{
+		{"localhost:3310", "tcp", "localhost:3310"},
+		{"/run/clamav/clamd.ctl", "unix", "/run/clamav/clamd.ctl"},
+		{"unix:clamd.sock", "unix", "clamd.sock"},
+	}
+	for _, tt := range tests {
+		c := NewClamAV(tt.address, time.Second)
+		if c.Network != tt.network || c.Address != tt.want {
+			t.Errorf("NewClamAV(%q) = %s %s, want %s %s", tt.address, c.Network, c.Address, tt.network, tt.want)
+		}
+	}
+}
+
+func TestEICARFindsSignatureAcrossReads(t *testing.T) {
+	data := append(bytes.Repeat([]byte("x"), 32<<10-10), eicarSignature...)
+	result, err := EICAR{}.Scan(context.Background(), bytes.NewReader(data))
+	if err != nil || !result.Infected {
+		t.Fatalf("Scan = %+v, %v", result, err)
+	}
+	if result, _ := (EICAR{}).Scan(context.Background(), strings.NewReader("clean")); result.Infected {
+		t.Fatal("clean data reported as infected")
+	}
+}
@@ -0,0 +1,39 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// тестовая строка EICAR: безвредный файл, который антивирусы считают зараженным
+const eicarSignature = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// EICAR находит только тестовую строку EICAR. Нужен для проверки карантина и отказов
+// без установленного антивируса
+type EICAR struct{}
+
+func (EICAR) Scan(ctx context.Context, r io.Reader) (Result, error) {
+	buf := make([]byte, 32<<10)
+	// хвост предыдущего куска: строка может оказаться на границе
+	var tail []byte
+	for {
+		if err := ctx.Err(); err != nil {
+			return Result{}, err
+		}
+		n, err := r.Read(buf)
+		if n > 0 {
+			window := append(tail, buf[:n]...)
+			if bytes.Contains(window, []byte(eicarSignature)) {
+				return Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+			}
+			tail = append(tail[:0], window[max(len(window)-len(eicarSignature)+1, 0):]...)
+		}
+		if err == io.EOF {
+			return Result{}, nil
+		}
+		if err != nil {
+			return Result{}, err
+		}
+	}
+}
@@ -0,0 +1,54 @@
+// Package scanner проверяет загруженные файлы на вредоносное содержимое до того,
+// как они станут доступны другим пользователям
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"realtime_chat_platform/internal/config"
+)
+
+// Result - итог проверки; Signature - имя найденной сигнатуры
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+// Scanner проверяет содержимое файла. Ошибка означает, что проверить файл не удалось,
+// и такой файл нельзя считать чистым
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) (Result, error)
+}
+
+// сканер, выбранный через SCANNER; nil, если проверка отключена
+var Default Scanner
+
+// создает сканер по настройкам из окружения
+func Init() error {
+	scanner, err := New(config.Scanner)
+	if err != nil {
+		return err
+	}
+	Default = scanner
+	return nil
+}
+
+// создает сканер указанного типа: none, eicar или clamav
+func New(kind string) (Scanner, error) {
+	switch kind {
+	case "none", "":
+		return nil, nil
+	case "eicar":
+		return EICAR{}, nil
+	case "clamav":
+		return NewClamAV(config.ClamAVAddress, config.ScanTimeout), nil
+	}
+	return nil, fmt.Errorf("unknown scanner %q", kind)
+}
+
+// Enabled сообщает, проверяются ли загрузки
+func Enabled() bool {
+	return Default != nil
+}
@@ -0,0 +1,373 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Config - параметры S3-совместимого хранилища (AWS S3, MinIO, Ceph RGW и т.п.)
+type S3Config struct {
+	Endpoint        string // например https://s3.eu-central-1.amazonaws.com или http://minio:9000
+	Region          string
+	Bucket          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Prefix          string // префикс ключей внутри бакета
+	PathStyle       bool   // адресация endpoint/bucket/key вместо bucket.endpoint/key
+}
+
+// S3 - клиент S3-совместимого хранилища с подписью запросов AWS Signature V4
+type S3 struct {
+	config   S3Config
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3(cfg S3Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("S3 storage requires S3_ENDPOINT and S3_BUCKET")
+	}
+	endpoint, err := url.Parse(strings.TrimRight(cfg.Endpoint, "/"))
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", cfg.Endpoint)
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Prefix != "" && !strings.HasSuffix(cfg.Prefix, "/") {
+		cfg.Prefix += "/"
+	}
+	return &S3{config: cfg, endpoint: endpoint, client: &http.Client{Timeout: 5 * time.Minute}}, nil
+}
+
+// объект S3, читаемый запросами с Range начиная с текущей позиции
+type s3Blob struct {
+	store  *S3
+	info   BlobInfo
+	offset int64
+	body   io.ReadCloser
+}
+
+func (b *s3Blob) Info() BlobInfo {
+	return b.info
+}
+
+func (b *s3Blob) Read(p []byte) (int, error) {
+	if b.offset >= b.info.Size {
+		return 0, io.EOF
+	}
+	if b.body == nil {
+		header := http.Header{"Range": {fmt.Sprintf("bytes=%d-", b.offset)}}
+		resp, err := b.store.do(http.MethodGet, b.info.Key, nil, nil, -1, header)
+		if err != nil {
+			return 0, err
+		}
+		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+			defer resp.Body.Close()
+			return 0, responseError(resp)
+		}
+		// 200 вместо 206 значит, что Range проигнорирован и тело начинается с начала объекта
+		if resp.StatusCode == http.StatusOK && b.offset > 0 {
+			resp.Body.Close()
+			return 0, fmt.Errorf("S3 ignored the range request for %s", b.info.Key)
+		}
+		b.body = resp.Body
+	}
+
+	n, err := b.body.Read(p)
+	b.offset += int64(n)
+	if err == io.EOF && b.offset < b.info.Size {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+func (b *s3Blob) Seek(offset int64, whence int) (int64, error) {
+	next := offset
+	switch whence {
+	case io.SeekCurrent:
+		next += b.offset
+	case io.SeekEnd:
+		next += b.info.Size
+	}
+	if next < 0 {
+		return 0, errors.New("negative seek position")
+	}
+	if next != b.offset && b.body != nil {
+		b.body.Close()
+		b.body = nil
+	}
+	b.offset = next
+	return next, nil
+}
+
+func (b *s3Blob) Close() error {
+	if b.body != nil {
+		return b.body.Close()
+	}
+	return nil
+}
+
+func (s *S3) Put(key string, r io.Reader, size int64, contentType string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+	if size < 0 {
+		return errors.New("S3 upload requires a known size")
+	}
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+
+	resp, err := s.do(http.MethodPut, key, nil, r, size, header)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return responseError(resp)
+	}
+	return nil
+}
+
+func (s *S3) Open(key string) (Blob, error) {
+	if err := validKey(key); err != nil {
+		return nil, err
+	}
+
+	resp, err := s.do(http.MethodHead, key, nil, nil, -1, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrNotFound
+	default:
+		return nil, responseError(resp)
+	}
+
+	modTime, _ := http.ParseTime(resp.Header.Get("Last-Modified"))
+	return &s3Blob{store: s, info: BlobInfo{Key: key, Size: resp.ContentLength, ModTime: modTime}}, nil
+}
+
+func (s *S3) Delete(key string) error {
+	if err := validKey(key); err != nil {
+		return err
+	}
+
+	resp, err := s.do(http.MethodDelete, key, nil, nil, -1, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return responseError(resp)
+	}
+	return nil
+}
+
+// ответ ListObjectsV2
+type listBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+func (s *S3) List(prefix string, fn func(BlobInfo) error) error {
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.config.Prefix + prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil, -1, nil)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := responseError(resp)
+			resp.Body.Close()
+			return err
+		}
+
+		var result listBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("decode S3 listing: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			info := BlobInfo{Key: strings.TrimPrefix(object.Key, s.config.Prefix), Size: object.Size, ModTime: object.LastModified}
+			if err := fn(info); err != nil {
+				return err
+			}
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// выполняет подписанный запрос к объекту key или, при пустом key, к бакету
+func (s *S3) do(method, key string, query url.Values, body io.Reader, size int64, header http.Header) (*http.Response, error) {
+	target := *s.endpoint
+	objectPath := "/"
+	if key != "" {
+		objectPath += s.config.Prefix + key
+	}
+	if s.config.PathStyle {
+		target.Path = "/" + s.config.Bucket + objectPath
+	} else {
+		target.Host = s.config.Bucket + "." + s.endpoint.Host
+		target.Path = objectPath
+	}
+	target.RawPath = uriEncode(target.Path, false)
+	target.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, target.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if size >= 0 {
+		req.ContentLength = size
+		if size == 0 {
+			req.Body = http.NoBody
+		}
+	}
+
+	s.sign(req, target.RawPath, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// подписывает запрос по AWS Signature Version 4; если хеш тела не задан заранее,
+// тело не хешируется (UNSIGNED-PAYLOAD), чтобы загрузки не приходилось буферизовать
+func (s *S3) sign(req *http.Request, canonicalURI string, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	payloadHash := req.Header.Get("X-Amz-Content-Sha256")
+	if payloadHash == "" {
+		payloadHash = "UNSIGNED-PAYLOAD"
+		req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	}
+
+	signed := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		lower := strings.ToLower(name)
+		if strings.HasPrefix(lower, "x-amz-") || lower == "content-type" || lower == "range" {
+			signed[lower] = strings.TrimSpace(strings.Join(values, ","))
+		}
+	}
+	names := make([]string, 0, len(signed))
+	for name := range signed {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + signed[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalURI,
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + s.config.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex(canonicalRequest)
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretAccessKey), date)
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.config.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+// кодирует строку по правилам SigV4: все, кроме A-Z a-z 0-9 - _ . ~, а в пути еще и "/"
+func uriEncode(value string, encodeSlash bool) string {
+	var encoded strings.Builder
+	for _, b := range []byte(value) {
+		switch {
+		case 'A' <= b && b <= 'Z', 'a' <= b && b <= 'z', '0' <= b && b <= '9', b == '-', b == '_', b == '.', b == '~':
+			encoded.WriteByte(b)
+		case b == '/' && !encodeSlash:
+			encoded.WriteByte(b)
+		default:
+			fmt.Fprintf(&encoded, "%%%02X", b)
+		}
+	}
+	return encoded.String()
+}
+
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		for _, value := range query[key] {
+			parts = append(parts, uriEncode(key, true)+"="+uriEncode(value, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func sha256Hex(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, value string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+	return mac.Sum(nil)
+}
+
+// превращает ответ с ошибкой в error с кодом из XML-тела S3
+func responseError(resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return fmt.Errorf("S3 request failed with status %d: %s: %s", resp.StatusCode, body.Code, body.Message)
+	}
+	return fmt.Errorf("S3 request failed with status %d", resp.StatusCode)
+}
@@ -0,0 +1,110 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"realtime_chat_platform/internal/config"
+)
+
+// ErrNotFound возвращается, если объекта с таким ключом нет
+var ErrNotFound = errors.New("blob not found")
+
+// BlobInfo - метаданные сохраненного объекта
+type BlobInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Blob - открытый объект; Seek позволяет отдавать его частями по Range
+type Blob interface {
+	io.ReadSeekCloser
+	Info() BlobInfo
+}
+
+// BlobStore - хранилище файлов. Ключи - пути через "/", например avatars/avatar_1_1700000000.png
+type BlobStore interface {
+	Put(key string, r io.Reader, size int64, contentType string) error
+	Open(key string) (Blob, error)
+	Delete(key string) error
+	// вызывает fn для каждого объекта с ключом, начинающимся с prefix
+	List(prefix string, fn func(BlobInfo) error) error
+}
+
+// хранилище, выбранное через STORAGE_BACKEND
+var Store BlobStore
+
+// создает хранилище по настройкам из окружения
+func Init() error {
+	store, err := New(config.StorageBackend)
+	if err != nil {
+		return err
+	}
+	Store = store
+	return nil
+}
+
+// создает хранилище указанного типа: local или s3
+func New(backend string) (BlobStore, error) {
+	switch backend {
+	case "local", "":
+		return NewLocal(config.UploadDir), nil
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:        config.S3Endpoint,
+			Region:          config.S3Region,
+			Bucket:          config.S3Bucket,
+			AccessKeyID:     config.S3AccessKeyID,
+			SecretAccessKey: config.S3SecretAccessKey,
+			Prefix:          config.S3Prefix,
+			PathStyle:       config.S3PathStyle,
+		})
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", backend)
+}
+
+// проверяет ключ: относительный путь без выхода за пределы хранилища
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || path.Clean(key) != key || strings.HasPrefix(key, "../") || key == ".." {
+		return fmt.Errorf("invalid blob key %q", key)
+	}
+	return nil
+}
+
+// копирует все объекты с префиксом из одного хранилища в другое; объекты того же размера пропускаются
+func Copy(from, to BlobStore, prefix string, dryRun bool, progress func(info BlobInfo, copied bool)) (copied int, bytes int64, err error) {
+	err = from.List(prefix, func(info BlobInfo) error {
+		if existing, err := to.Open(info.Key); err == nil {
+			same := existing.Info().Size == info.Size
+			existing.Close()
+			if same {
+				progress(info, false)
+				return nil
+			}
+		} else if !errors.Is(err, ErrNotFound) {
+			return err
+		}
+
+		if !dryRun {
+			blob, err := from.Open(info.Key)
+			if err != nil {
+				return err
+			}
+			err = to.Put(info.Key, blob, info.Size, "")
+			blob.Close()
+			if err != nil {
+				return fmt.Errorf("copy %s: %w", info.Key, err)
+			}
+		}
+		copied++
+		bytes += info.Size
+		progress(info, true)
+		return nil
+	})
+	return copied, bytes, err
+}
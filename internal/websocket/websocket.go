@@ -2,17 +2,28 @@ package websocket
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"realtime_chat_platform/internal/audit"
+	"realtime_chat_platform/internal/auth"
+	"realtime_chat_platform/internal/automod"
 	"realtime_chat_platform/internal/config"
 	"realtime_chat_platform/internal/database"
+	"realtime_chat_platform/internal/fileurl"
 	"realtime_chat_platform/internal/models"
+	"realtime_chat_platform/internal/moderation"
+	"realtime_chat_platform/internal/quota"
+	"realtime_chat_platform/internal/ratelimit"
+	"realtime_chat_platform/internal/rbac"
 
-	"github.com/golang-jwt/jwt/v4"
 	"github.com/gorilla/websocket"
 )
 
@@ -22,17 +33,66 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// Client - одно соединение. Send закрывает только хаб, а пишут в него и другие горутины,
+// поэтому запись и закрытие идут под sendMutex, а closed не дает писать в закрытый канал
 type Client struct {
-	ID       string
-	Username string
-	Conn     *websocket.Conn
-	Hub      *Hub
-	Send     chan []byte
+	ID         string
+	UserID     uint
+	Username   string
+	CanPost    bool
+	Conn       *websocket.Conn
+	Hub        *Hub
+	Send       chan []byte
+	sendMutex  sync.Mutex
+	closed     bool
+	limits     map[string]*ratelimit.Bucket
+	violations []time.Time
+	createdAt  time.Time
+}
+
+// виды входящих кадров с отдельными лимитами
+const (
+	eventMessage  = "message"
+	eventTyping   = "typing"
+	eventReaction = "reaction"
+)
+
+// лимиты на пользователя общие для всех его соединений
+var userLimits = map[string]*ratelimit.Limiter{
+	eventMessage:  ratelimit.NewLimiter(config.RateLimitMessages*config.RateLimitUserFactor, config.RateLimitMessagesBurst*config.RateLimitUserFactor),
+	eventTyping:   ratelimit.NewLimiter(config.RateLimitTyping*config.RateLimitUserFactor, config.RateLimitTypingBurst*config.RateLimitUserFactor),
+	eventReaction: ratelimit.NewLimiter(config.RateLimitReactions*config.RateLimitUserFactor, config.RateLimitReactionsBurst*config.RateLimitUserFactor),
+}
+
+// сниженные лимиты сообщений для новых аккаунтов и режима рейда, по одному на делитель
+var (
+	restrictedLimits      = map[int]*ratelimit.Limiter{}
+	restrictedLimitsMutex sync.Mutex
+)
+
+func restrictedLimiter(divisor int) *ratelimit.Limiter {
+	restrictedLimitsMutex.Lock()
+	defer restrictedLimitsMutex.Unlock()
+
+	limiter, ok := restrictedLimits[divisor]
+	if !ok {
+		limiter = ratelimit.NewLimiter(max(config.RateLimitMessages/divisor, 1), config.RateLimitMessagesBurst/divisor)
+		restrictedLimits[divisor] = limiter
+	}
+	return limiter
+}
+
+func newConnectionLimits() map[string]*ratelimit.Bucket {
+	return map[string]*ratelimit.Bucket{
+		eventMessage:  ratelimit.NewBucket(config.RateLimitMessages, config.RateLimitMessagesBurst),
+		eventTyping:   ratelimit.NewBucket(config.RateLimitTyping, config.RateLimitTypingBurst),
+		eventReaction: ratelimit.NewBucket(config.RateLimitReactions, config.RateLimitReactionsBurst),
+	}
 }
 
 type Hub struct {
 	clients     map[*Client]bool
-	broadcast   chan []byte
+	broadcast   chan outbound
 	register    chan *Client
 	unregister  chan *Client
 	typing      chan []byte
@@ -41,14 +101,88 @@ type Hub struct {
 	typingMutex sync.RWMutex
 }
 
+// outbound - событие для рассылки; при ненулевом userID оно доставляется только соединениям этого пользователя.
+// Если задан personal, событие собирается для каждого получателя отдельно
+type outbound struct {
+	data     []byte
+	userID   uint
+	personal Personal
+}
+
+// Personal строит событие для конкретного получателя: ссылки на файлы подписываются
+// для каждого пользователя отдельно. Можно передавать в Broadcast и Send*
+type Personal func(userID uint) interface{}
+
+// кодирует событие для получателя; результаты Personal кешируются на время одной рассылки
+func (o *outbound) encode(userID uint, cache map[uint][]byte) []byte {
+	if o.personal == nil {
+		return o.data
+	}
+	if data, ok := cache[userID]; ok {
+		return data
+	}
+	data, err := json.Marshal(o.personal(userID))
+	if err != nil {
+		log.Printf("Error encoding event: %v", err)
+	}
+	cache[userID] = data
+	return data
+}
+
 type Message struct {
+	ID        uint   `json:"id"`
+	RoomID    uint   `json:"room_id"`
 	Username  string `json:"username"`
 	Content   string `json:"content"`
 	Timestamp string `json:"timestamp"`
 	Avatar    string `json:"avatar"`
+	// voice, если сообщение - голосовая запись; задается сервером по вложениям
+	Kind string `json:"kind,omitempty"`
+	// идентификаторы заранее загруженных через POST /api/attachments файлов
+	AttachmentIDs []uint              `json:"attachment_ids,omitempty"`
+	Attachments   []models.Attachment `json:"attachments,omitempty"`
+}
+
+// копия сообщения со ссылками на аватар и вложения, подписанными для получателя
+func (m Message) forRecipient(userID uint) interface{} {
+	m.Avatar = fileurl.Sign(m.Avatar, userID)
+	m.Attachments = fileurl.Attachments(m.Attachments, userID)
+	return m
+}
+
+// ErrorEvent отправляется только клиенту, чье действие было отклонено
+type ErrorEvent struct {
+	Type         string `json:"type"`
+	Code         string `json:"code"`
+	Error        string `json:"error"`
+	RetryAfterMs int64  `json:"retry_after_ms,omitempty"`
+}
+
+// RoomEvent рассылается при изменении настроек комнаты
+type RoomEvent struct {
+	Type string       `json:"type"`
+	Room *models.Room `json:"room"`
+}
+
+// NoticeEvent - служебное уведомление: предупреждение модератора, новая жалоба, удаление сообщения
+type NoticeEvent struct {
+	Type      string      `json:"type"`
+	MessageID uint        `json:"message_id,omitempty"`
+	Reason    string      `json:"reason,omitempty"`
+	Report    interface{} `json:"report,omitempty"`
+}
+
+// AttachmentEvent рассылается, когда фоновая обработка вложения отправленного сообщения завершена,
+// а автору - когда сканер проверил или отклонил его вложение
+type AttachmentEvent struct {
+	Type       string             `json:"type"`
+	MessageID  uint               `json:"message_id"`
+	Attachment *models.Attachment `json:"attachment"`
+	Reason     string             `json:"reason,omitempty"`
 }
 
 type TypingEvent struct {
+	RoomID   uint   `json:"room_id"`
 	Username string `json:"username"`
 	IsTyping bool   `json:"is_typing"`
 	Type     string `json:"type"`
@@ -59,7 +193,7 @@ var GlobalHub = NewHub()
 func NewHub() *Hub {
 	return &Hub{
 		clients:     make(map[*Client]bool),
-		broadcast:   make(chan []byte),
+		broadcast:   make(chan outbound),
 		register:    make(chan *Client),
 		unregister:  make(chan *Client),
 		typing:      make(chan []byte),
@@ -79,48 +213,75 @@ func (h *Hub) Run() {
 			log.Printf("Client registered: %s", client.Username)
 
 		case client := <-h.unregister:
-			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.Send)
-			}
-			h.mutex.Unlock()
+			h.drop([]*Client{client})
 			log.Printf("Client unregistered: %s", client.Username)
 
 		case message := <-h.broadcast:
-			h.mutex.RLock()
-			for client := range h.clients {
-				select {
-				case client.Send <- message:
-				default:
-					close(client.Send)
-					delete(h.clients, client)
+			encoded := make(map[uint][]byte)
+			var slow []*Client
+			for _, client := range h.snapshot() {
+				if message.userID != 0 && client.UserID != message.userID {
+					continue
+				}
+				data := message.encode(client.UserID, encoded)
+				if data == nil {
+					continue
+				}
+				if !client.enqueue(data) {
+					slow = append(slow, client)
 				}
 			}
-			h.mutex.RUnlock()
+			h.drop(slow)
 
 		case typingEvent := <-h.typing:
-			h.mutex.RLock()
-			for client := range h.clients {
-				select {
-				case client.Send <- typingEvent:
-				default:
-					close(client.Send)
-					delete(h.clients, client)
+			var slow []*Client
+			for _, client := range h.snapshot() {
+				if !client.enqueue(typingEvent) {
+					slow = append(slow, client)
 				}
 			}
-			h.mutex.RUnlock()
+			h.drop(slow)
 		}
 	}
 }
 
+// копия списка клиентов: рассылка идет без блокировки, чтобы не мешать регистрации
+func (h *Hub) snapshot() []*Client {
+	h.mutex.RLock()
+	defer h.mutex.RUnlock()
+
+	clients := make([]*Client, 0, len(h.clients))
+	for client := range h.clients {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// снимает клиентов с регистрации и закрывает их очереди; клиент, не успевающий
+// читать рассылку, отключается так же
+func (h *Hub) drop(clients []*Client) {
+	if len(clients) == 0 {
+		return
+	}
+	h.mutex.Lock()
+	for _, client := range clients {
+		delete(h.clients, client)
+	}
+	h.mutex.Unlock()
+
+	for _, client := range clients {
+		client.closeSend()
+	}
+}
+
 type OnlineUser struct {
 	Username string `json:"username"`
 	Avatar   string `json:"avatar"`
 }
 
-// возвращает список онлайн пользователей с их отображаемой информацией
-func (h *Hub) GetOnlineUsers() []OnlineUser {
+// возвращает список онлайн пользователей с их отображаемой информацией; ссылки на аватары
+// подписываются для viewerID
+func (h *Hub) GetOnlineUsers(viewerID uint) []OnlineUser {
 	h.mutex.RLock()
 	defer h.mutex.RUnlock()
 
@@ -134,18 +295,91 @@ func (h *Hub) GetOnlineUsers() []OnlineUser {
 			}
 			users = append(users, OnlineUser{
 				Username: displayName,
-				Avatar:   user.Avatar,
+				Avatar:   fileurl.Sign(user.AvatarURL(), viewerID),
 			})
 		} else {
 			users = append(users, OnlineUser{
 				Username: client.Username,
-				Avatar:   "",
+				Avatar:   models.DefaultAvatarURL(client.Username, ""),
 			})
 		}
 	}
 	return users
 }
 
+// закрывает все соединения пользователя, передавая причину в кадре закрытия
+func (h *Hub) DisconnectUser(userID uint, reason string) int {
+	// кадр закрытия пишется в сеть, поэтому соединения закрываются без блокировки хаба
+	disconnected := 0
+	for _, client := range h.snapshot() {
+		if client.UserID != userID {
+			continue
+		}
+		client.close(reason)
+		disconnected++
+	}
+	return disconnected
+}
+
+// отправляет событие всем соединениям пользователя
+func (h *Hub) SendToUser(userID uint, event interface{}) int {
+	return h.sendTo(event, func(client *Client) bool {
+		return client.UserID == userID
+	})
+}
+
+// отправляет событие всем подключенным пользователям с правом модерации
+func (h *Hub) NotifyModerators(event interface{}) int {
+	return h.sendTo(event, func(client *Client) bool {
+		return client.UserID != 0 && client.can(0, rbac.UsersModerate)
+	})
+}
+
+// отправляет событие всем, кто может читать комнату
+func (h *Hub) SendToRoom(roomID uint, event interface{}) int {
+	return h.sendTo(event, func(client *Client) bool {
+		return client.can(roomID, rbac.MessagesRead)
+	})
+}
+
+// рассылает событие всем клиентам
+func (h *Hub) Broadcast(event interface{}) {
+	if message, err := newOutbound(event); err == nil {
+		h.broadcast <- message
+	}
+}
+
+func newOutbound(event interface{}) (outbound, error) {
+	if personal, ok := event.(Personal); ok {
+		return outbound{personal: personal}, nil
+	}
+	data, err := json.Marshal(event)
+	return outbound{data: data}, err
+}
+
+func (h *Hub) sendTo(event interface{}, match func(client *Client) bool) int {
+	message, err := newOutbound(event)
+	if err != nil {
+		return 0
+	}
+
+	sent := 0
+	encoded := make(map[uint][]byte)
+	for _, client := range h.snapshot() {
+		if !match(client) {
+			continue
+		}
+		data := message.encode(client.UserID, encoded)
+		if data == nil {
+			continue
+		}
+		if client.enqueue(data) {
+			sent++
+		}
+	}
+	return sent
+}
+
 func (h *Hub) GetTypingUsers() []string {
 	h.typingMutex.RLock()
 	defer h.typingMutex.RUnlock()
@@ -184,8 +418,48 @@ func (c *Client) ReadPump() {
 			break
 		}
 
+		var frame struct {
+			Type string `json:"type"`
+		}
+		json.Unmarshal(message, &frame)
+		kind := eventMessage
+		switch frame.Type {
+		case "typing_start", "typing_stop":
+			kind = eventTyping
+		case "reaction":
+			kind = eventReaction
+		}
+
+		var restriction moderation.Restriction
+		if kind == eventMessage {
+			restriction = c.restriction()
+		}
+
+		if limited, disconnect := c.throttle(kind, restriction); disconnect {
+			break
+		} else if limited {
+			continue
+		}
+
+		// реакции пока не поддерживаются, но уже расходуют свой лимит
+		if kind == eventReaction {
+			continue
+		}
+
+		// бан, выданный после подключения, обрывает соединение на следующем кадре
+		if ban := moderation.Active(c.UserID, models.ModerationBan); ban != nil {
+			c.close(moderation.Describe(ban))
+			break
+		}
+		mute := moderation.Active(c.UserID, models.ModerationMute)
+		// под теневым баном сообщения видит только автор, поэтому набор текста никому не показывается
+		shadow := moderation.Active(c.UserID, models.ModerationShadowBan) != nil
+
 		var typingEvent TypingEvent
 		if err := json.Unmarshal(message, &typingEvent); err == nil && (typingEvent.Type == "typing_start" || typingEvent.Type == "typing_stop") {
+			if mute != nil || shadow || !c.can(roomOrDefault(typingEvent.RoomID), rbac.MessagesSend) {
+				continue
+			}
 			c.Hub.SetUserTyping(typingEvent.Username, typingEvent.IsTyping)
 			c.Hub.typing <- message
 			continue
@@ -196,11 +470,116 @@ func (c *Client) ReadPump() {
 			log.Printf("Error parsing message: %v", err)
 			continue
 		}
-		if msg.Content == "" {
+		if msg.Content == "" && len(msg.AttachmentIDs) == 0 {
 			log.Printf("Empty message content, skipping save.")
 			continue
 		}
 
+		if !c.CanPost {
+			c.sendError("forbidden", "Token lacks required scope: "+models.ScopeMessagesWrite)
+			continue
+		}
+
+		if mute != nil {
+			c.sendError("muted", moderation.Describe(mute))
+			continue
+		}
+
+		if c.emailVerificationPending() {
+			c.sendError("email_unverified", "Email verification required to post messages")
+			continue
+		}
+
+		msg.RoomID = roomOrDefault(msg.RoomID)
+		var room models.Room
+		if err := database.DB.First(&room, msg.RoomID).Error; err != nil {
+			c.sendError("room_not_found", "Room not found")
+			continue
+		}
+
+		if !c.can(msg.RoomID, rbac.MessagesSend) {
+			c.sendError("forbidden", "Permission denied: "+string(rbac.MessagesSend))
+			continue
+		}
+
+		if !room.PostingAllowed(c.role(room.ID)) {
+			c.sendError("read_only", "Only "+room.PostRole+" and above can post in this room")
+			continue
+		}
+
+		if wait := restriction.CooldownWait(time.Now()); wait > 0 {
+			c.send(ErrorEvent{
+				Type:         "error",
+				Code:         "new_account_cooldown",
+				Error:        "New accounts have to wait before posting",
+				RetryAfterMs: wait.Milliseconds() + 1,
+			})
+			continue
+		}
+
+		if restriction.BlockLinks && automod.ContainsLink(msg.Content) {
+			c.sendError("links_not_allowed", "New accounts cannot post links")
+			continue
+		}
+
+		attachments, err := c.pendingAttachments(msg.AttachmentIDs)
+		if err != nil {
+			c.sendError("invalid_attachment", err.Error())
+			continue
+		}
+		msg.Kind = messageKind(attachments)
+
+		if !c.can(room.ID, rbac.UsersModerate) {
+			if wait := SlowModeWait(&room, c.Username); wait > 0 {
+				c.send(ErrorEvent{
+					Type:         "error",
+					Code:         "slow_mode",
+					Error:        "Slow mode is enabled in this room",
+					RetryAfterMs: wait.Milliseconds() + 1,
+				})
+				continue
+			}
+		}
+
+		// модераторы не проходят автомодерацию
+		var verdict automod.Result
+		if !c.can(msg.RoomID, rbac.UsersModerate) {
+			verdict = automod.Check(c.UserID, msg.Content)
+			if verdict.Action == models.AutomodMute {
+				reason := "automod: " + verdict.Rule
+				if record, err := moderation.Record(c.UserID, 0, models.ModerationMute, reason, verdict.MuteDuration()); err == nil {
+					c.sendError("muted", moderation.Describe(record))
+					audit.RecordSystem(audit.Event{
+						Action:     models.AuditModeration + models.ModerationMute,
+						TargetType: "user",
+						TargetID:   c.UserID,
+						Details:    "reason=" + reason,
+					})
+				}
+				continue
+			}
+			if verdict.Blocked() {
+				c.sendError("automod_blocked", "Message blocked by automod rule: "+verdict.Rule)
+				continue
+			}
+			msg.Content = verdict.Content
+		}
+
+		// вложения занимают место в квоте комнаты с момента отправки
+		roomBytes := attachmentsSize(attachments)
+		if roomBytes > 0 {
+			err := quota.ReserveRoom(room.ID, roomBytes)
+			var exceeded *quota.ExceededError
+			if errors.As(err, &exceeded) {
+				c.sendError("room_quota_exceeded", "Room storage quota exceeded: "+quota.FormatBytes(exceeded.Used)+" of "+quota.FormatBytes(exceeded.Quota)+" used")
+				continue
+			} else if err != nil {
+				log.Printf("Error reserving room storage: %v", err)
+				c.sendError("invalid_attachment", "Failed to attach files")
+				continue
+			}
+		}
+
 		var user models.User
 		if err := database.DB.Where("username = ?", msg.Username).First(&user).Error; err == nil {
 			displayName := user.Username
@@ -208,39 +587,298 @@ func (c *Client) ReadPump() {
 				displayName = user.Nickname
 			}
 			msg.Username = displayName
-			msg.Avatar = user.Avatar
+			msg.Avatar = user.AvatarURL()
 		}
 
 		msg.Timestamp = time.Now().Format("2006-01-02 15:04:05")
 
 		c.Hub.SetUserTyping(msg.Username, false)
 		stopTypingEvent := TypingEvent{
+			RoomID:   msg.RoomID,
 			Username: msg.Username,
 			IsTyping: false,
 			Type:     "typing_stop",
 		}
-		if stopTypingData, err := json.Marshal(stopTypingEvent); err == nil {
+		if stopTypingData, err := json.Marshal(stopTypingEvent); err == nil && !shadow {
 			c.Hub.typing <- stopTypingData
 		}
 
 		dbMessage := models.Message{
+			RoomID:   msg.RoomID,
 			Username: c.Username,
 			Content:  msg.Content,
+			Shadow:   shadow,
+			Kind:     msg.Kind,
 		}
 		if err := database.DB.Create(&dbMessage).Error; err != nil {
 			log.Printf("Error saving message to database: %v", err)
+			quota.ReleaseRoom(room.ID, roomBytes)
+		}
+		msg.ID = dbMessage.ID
+		msg.AttachmentIDs = nil
+		if len(attachments) > 0 && dbMessage.ID != 0 {
+			if err := database.DB.Model(&models.Attachment{}).Where("id IN ?", attachmentIDs(attachments)).UpdateColumn("message_id", dbMessage.ID).Error; err != nil {
+				log.Printf("Error linking attachments: %v", err)
+			}
+			for i := range attachments {
+				attachments[i].MessageID = &dbMessage.ID
+			}
+			msg.Attachments = attachments
+		}
+
+		if verdict.Flagged() && dbMessage.ID != 0 {
+			c.flagMessage(dbMessage.ID, verdict)
 		}
 
 		if err := database.DB.Model(&models.User{}).Where("username = ?", c.Username).UpdateColumn("last_active", time.Now()).Error; err != nil {
 			log.Printf("Error updating user last active time: %v", err)
 		}
 
-		if broadcastData, err := json.Marshal(msg); err == nil {
-			c.Hub.broadcast <- broadcastData
+		event := outbound{personal: msg.forRecipient}
+		if shadow {
+			event.userID = c.UserID
 		}
+		c.Hub.broadcast <- event
 	}
 }
 
+// загружает еще не отправленные файлы клиента для нового сообщения
+func (c *Client) pendingAttachments(ids []uint) ([]models.Attachment, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	if len(ids) > config.AttachmentsPerMessage {
+		return nil, fmt.Errorf("At most %d attachments per message", config.AttachmentsPerMessage)
+	}
+
+	var attachments []models.Attachment
+	err := database.DB.Where("id IN ? AND user_id = ? AND message_id IS NULL", ids, c.UserID).Find(&attachments).Error
+	if err != nil || len(attachments) != len(ids) {
+		return nil, errors.New("Attachment not found or already sent")
+	}
+	for _, attachment := range attachments {
+		if attachment.Kind == models.KindVoice && len(attachments) > 1 {
+			return nil, errors.New("A voice message cannot contain other attachments")
+		}
+		if attachment.ScanStatus == models.ScanPending {
+			return nil, fmt.Errorf("Attachment %s is still being scanned", attachment.Filename)
+		} else if attachment.Quarantined() {
+			return nil, fmt.Errorf("Attachment %s could not be scanned", attachment.Filename)
+		}
+	}
+	return attachments, nil
+}
+
+// сообщение с голосовой записью получает вид voice, чтобы клиент сразу показал плеер
+func messageKind(attachments []models.Attachment) string {
+	if len(attachments) == 1 && attachments[0].Kind == models.KindVoice {
+		return models.KindVoice
+	}
+	return ""
+}
+
+func attachmentIDs(attachments []models.Attachment) []uint {
+	ids := make([]uint, len(attachments))
+	for i, attachment := range attachments {
+		ids[i] = attachment.ID
+	}
+	return ids
+}
+
+func attachmentsSize(attachments []models.Attachment) int64 {
+	var size int64
+	for _, attachment := range attachments {
+		size += attachment.Size
+	}
+	return size
+}
+
+// отправляет сообщение, отмеченное автомодерацией, в очередь жалоб
+func (c *Client) flagMessage(messageID uint, verdict automod.Result) {
+	var rules []string
+	for _, match := range verdict.Matches {
+		if match.Action == models.AutomodFlag && !match.DryRun {
+			rules = append(rules, match.Name)
+		}
+	}
+
+	report, err := moderation.FileReport(messageID, 0, "automod: "+strings.Join(rules, ", "))
+	if err != nil {
+		log.Printf("Error filing automod report: %v", err)
+		return
+	}
+	c.Hub.NotifyModerators(NoticeEvent{
+		Type:      "report_created",
+		MessageID: messageID,
+		Reason:    report.Reason,
+		Report:    report,
+	})
+}
+
+// списывает токен из лимитов соединения и пользователя, а для ограниченных аккаунтов - и из сниженного
+// лимита; при превышении отправляет кадр rate_limited, а после RateLimitMaxViolations нарушений за окно
+// закрывает соединение
+func (c *Client) throttle(kind string, restriction moderation.Restriction) (limited bool, disconnect bool) {
+	allowed, retryAfter := c.limits[kind].Allow()
+	if allowed && c.UserID != 0 {
+		allowed, retryAfter = userLimits[kind].Allow(strconv.FormatUint(uint64(c.UserID), 10))
+	}
+	if allowed && restriction.Limited() {
+		allowed, retryAfter = restrictedLimiter(restriction.RateDivisor).Allow(strconv.FormatUint(uint64(c.UserID), 10))
+	}
+	if allowed {
+		return false, false
+	}
+
+	now := time.Now()
+	recent := c.violations[:0]
+	for _, at := range c.violations {
+		if now.Sub(at) < config.RateLimitViolationWindow {
+			recent = append(recent, at)
+		}
+	}
+	c.violations = append(recent, now)
+
+	if len(c.violations) >= config.RateLimitMaxViolations {
+		log.Printf("Disconnecting %s for repeated rate limit violations", c.Username)
+		c.close("Disconnected for exceeding rate limits")
+		return true, true
+	}
+
+	c.send(ErrorEvent{
+		Type:         "error",
+		Code:         "rate_limited",
+		Error:        "Too many " + kind + " events, slow down",
+		RetryAfterMs: retryAfter.Milliseconds() + 1,
+	})
+	return true, false
+}
+
+// возвращает ограничения нового аккаунта и режима рейда; модераторы и анонимные клиенты от них освобождены
+func (c *Client) restriction() moderation.Restriction {
+	if c.UserID == 0 {
+		return moderation.Restriction{}
+	}
+	restriction := moderation.Restrictions(c.createdAt)
+	if (restriction.NewAccount || restriction.Limited()) && c.can(0, rbac.UsersModerate) {
+		return moderation.Restriction{}
+	}
+	return restriction
+}
+
+// отправляет клиенту кадр с ошибкой, не затрагивая остальных участников
+func (c *Client) sendError(code, message string) {
+	c.send(ErrorEvent{Type: "error", Code: code, Error: message})
+}
+
+// кладет событие в очередь клиента; при переполненной очереди событие отбрасывается
+func (c *Client) send(event interface{}) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	// хаб мог уже закрыть очередь медленного клиента
+	c.enqueue(data)
+}
+
+// кладет кадр в очередь клиента без ожидания; false, если очередь полна или уже закрыта
+func (c *Client) enqueue(data []byte) bool {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	if c.closed {
+		return false
+	}
+	select {
+	case c.Send <- data:
+		return true
+	default:
+		return false
+	}
+}
+
+// закрывает очередь клиента один раз; WritePump после этого завершает соединение
+func (c *Client) closeSend() {
+	c.sendMutex.Lock()
+	defer c.sendMutex.Unlock()
+
+	if !c.closed {
+		c.closed = true
+		close(c.Send)
+	}
+}
+
+// закрывает соединение с кадром закрытия; ReadPump затем снимает клиента с регистрации
+func (c *Client) close(reason string) {
+	if len(reason) > 120 {
+		reason = strings.ToValidUTF8(reason[:120], "")
+	}
+	deadline := time.Now().Add(time.Second)
+	c.Conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason), deadline)
+	c.Conn.Close()
+}
+
+// сообщения без указания комнаты попадают в комнату по умолчанию
+func roomOrDefault(roomID uint) uint {
+	if roomID == 0 {
+		return database.DefaultRoomID
+	}
+	return roomID
+}
+
+// проверяет право клиента в комнате
+func (c *Client) can(roomID uint, permission rbac.Permission) bool {
+	return rbac.Can(c.role(roomID), permission)
+}
+
+// возвращает роль клиента в комнате; анонимные клиенты считаются гостями
+func (c *Client) role(roomID uint) string {
+	if c.UserID == 0 {
+		return models.RoleGuest
+	}
+	var user models.User
+	if err := database.DB.First(&user, c.UserID).Error; err != nil {
+		return models.RoleGuest
+	}
+	return rbac.EffectiveRole(&user, roomID)
+}
+
+// возвращает, сколько пользователю осталось ждать до следующего сообщения в комнате с медленным режимом
+func SlowModeWait(room *models.Room, username string) time.Duration {
+	if room.SlowModeSeconds <= 0 {
+		return 0
+	}
+
+	var last models.Message
+	err := database.DB.Unscoped().Select("created_at").
+		Where("room_id = ? AND username = ?", room.ID, username).
+		Order("id desc").First(&last).Error
+	if err != nil {
+		return 0
+	}
+
+	wait := time.Until(last.CreatedAt.Add(time.Duration(room.SlowModeSeconds) * time.Second))
+	if wait < 0 {
+		return 0
+	}
+	return wait
+}
+
+// проверяет, ограничен ли аккаунт клиента до подтверждения email
+func (c *Client) emailVerificationPending() bool {
+	if !config.EmailVerificationRequired() {
+		return false
+	}
+	if c.UserID == 0 {
+		return true
+	}
+	var user models.User
+	if err := database.DB.Select("email_verified").First(&user, c.UserID).Error; err != nil {
+		return true
+	}
+	return !user.EmailVerified
+}
+
 func (c *Client) WritePump() {
 	defer func() {
 		c.Conn.Close()
@@ -278,19 +916,28 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	var username string
+	var userID uint
+	var createdAt time.Time
+	canPost := true
 
 	if tokenString != "" {
-		// парсинг и проверка JWT токена
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.JWTSecret), nil
-		})
-
-		if err == nil && token.Valid {
-			if claims, ok := token.Claims.(jwt.MapClaims); ok {
-				if usernameClaim, ok := claims["username"].(string); ok {
-					username = usernameClaim
-				}
+		// проверка JWT сессии или персонального токена
+		remoteIP, _, _ := net.SplitHostPort(r.RemoteAddr)
+		principal, err := auth.ResolveBearer(tokenString, remoteIP)
+		var banned *auth.BanError
+		if errors.As(err, &banned) {
+			http.Error(w, banned.Error(), http.StatusForbidden)
+			return
+		}
+		if err == nil {
+			if !principal.HasScope(models.ScopeMessagesRead) {
+				http.Error(w, "Token lacks required scope: "+models.ScopeMessagesRead, http.StatusForbidden)
+				return
 			}
+			username = principal.User.Username
+			userID = principal.User.ID
+			createdAt = principal.User.CreatedAt
+			canPost = principal.HasScope(models.ScopeMessagesWrite)
 		}
 	}
 
@@ -306,11 +953,15 @@ func WebSocketHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	client := &Client{
-		ID:       "client-" + conn.RemoteAddr().String(),
-		Username: username,
-		Conn:     conn,
-		Hub:      GlobalHub,
-		Send:     make(chan []byte, 256),
+		ID:        "client-" + conn.RemoteAddr().String(),
+		UserID:    userID,
+		Username:  username,
+		CanPost:   canPost,
+		Conn:      conn,
+		Hub:       GlobalHub,
+		Send:      make(chan []byte, 256),
+		limits:    newConnectionLimits(),
+		createdAt: createdAt,
 	}
 
 	client.Hub.register <- client
@@ -14,6 +14,13 @@ const profileBtn = document.getElementById('profileBtn');
 const onlineUsersContainer = document.getElementById('onlineUsers');
 const onlineCountSpan = document.getElementById('onlineCount');
 const typingIndicator = document.getElementById('typing-indicator');
+const attachBtn = document.getElementById('attachBtn');
+const attachmentInput = document.getElementById('attachmentInput');
+const recordBtn = document.getElementById('recordBtn');
+const pendingAttachmentsContainer = document.getElementById('pendingAttachments');
+
+// Files uploaded but not yet sent
+let pendingAttachments = [];
 
 // Event listeners
 loginForm.addEventListener('submit', handleLogin);
@@ -27,9 +34,21 @@ messageInput.addEventListener('keypress', (e) => {
 messageInput.addEventListener('input', handleTyping);
 logoutBtn.addEventListener('click', handleLogout);
 profileBtn.addEventListener('click', goToProfile);
+attachBtn.addEventListener('click', () => attachmentInput.click());
+attachmentInput.addEventListener('change', uploadAttachments);
+recordBtn.addEventListener('click', toggleRecording);
 
 // Check if user is already logged in
 document.addEventListener('DOMContentLoaded', function() {
+    handleSSORedirect();
+    loadAuthProviders();
+
+    if (passkeysSupported()) {
+        const passkeyBtn = document.getElementById('passkeyLoginBtn');
+        passkeyBtn.style.display = 'inline-block';
+        passkeyBtn.addEventListener('click', handlePasskeyLogin);
+    }
+
     const savedToken = localStorage.getItem('authToken');
     const savedUsername = localStorage.getItem('username');
     
@@ -40,6 +59,44 @@ document.addEventListener('DOMContentLoaded', function() {
     }
 });
 
+// Pick up the token passed back from the SSO callback in the URL fragment
+function handleSSORedirect() {
+    if (!window.location.hash) {
+        return;
+    }
+
+    const params = new URLSearchParams(window.location.hash.substring(1));
+    const ssoToken = params.get('sso_token');
+    const ssoError = params.get('sso_error');
+    if (!ssoToken && !ssoError) {
+        return;
+    }
+
+    history.replaceState(null, '', window.location.pathname);
+
+    if (ssoToken) {
+        localStorage.setItem('authToken', ssoToken);
+        localStorage.setItem('username', params.get('username'));
+    } else {
+        alert('Login failed: ' + ssoError);
+    }
+}
+
+async function loadAuthProviders() {
+    try {
+        const response = await fetch('/api/auth/providers');
+        const data = await response.json();
+
+        if (response.ok && data.oidc && data.oidc.enabled) {
+            const ssoBtn = document.getElementById('ssoLoginBtn');
+            ssoBtn.textContent = `Login with ${data.oidc.name}`;
+            ssoBtn.style.display = 'inline-block';
+        }
+    } catch (error) {
+        console.error('Error loading auth providers:', error);
+    }
+}
+
 async function handleLogin(e) {
     e.preventDefault();
     const username = document.getElementById('loginUsername').value;
@@ -72,10 +129,25 @@ async function handleLogin(e) {
     }
 }
 
+async function handlePasskeyLogin() {
+    try {
+        const data = await loginWithPasskey();
+        currentUser = data.username;
+        localStorage.setItem('authToken', data.token);
+        localStorage.setItem('username', data.username);
+        showChatInterface();
+        connectWebSocket();
+    } catch (error) {
+        console.error('Passkey login error:', error);
+        alert('Login failed: ' + error.message);
+    }
+}
+
 async function handleRegister(e) {
     e.preventDefault();
     const username = document.getElementById('registerUsername').value;
     const password = document.getElementById('registerPassword').value;
+    const email = document.getElementById('registerEmail').value.trim();
 
     try {
         const response = await fetch('/api/register', {
@@ -83,13 +155,17 @@ async function handleRegister(e) {
             headers: {
                 'Content-Type': 'application/json',
             },
-            body: JSON.stringify({ username, password }),
+            body: JSON.stringify({ username, password, email }),
         });
 
         const data = await response.json();
         
         if (response.ok) {
-            alert('Registration successful! Please login.');
+            if (email) {
+                alert('Registration successful! Check your email to verify the address, then login.');
+            } else {
+                alert('Registration successful! Please login.');
+            }
             // Switch to login tab
             document.getElementById('login-tab').click();
         } else {
@@ -114,7 +190,9 @@ function showAuthForms() {
 
 async function loadMessageHistory() {
     try {
-        const response = await fetch('/api/messages?limit=50');
+        const response = await fetch('/api/messages?limit=50', {
+            headers: { 'Authorization': `Bearer ${localStorage.getItem('authToken')}` },
+        });
         const data = await response.json();
         
         if (response.ok && data.messages) {
@@ -123,7 +201,7 @@ async function loadMessageHistory() {
             
             // Add historical messages
             data.messages.forEach(msg => {
-                addMessage(msg.username, msg.content, msg.created_at, msg.avatar);
+                addMessage(msg.username, msg.content, msg.created_at, msg.avatar, msg.id, msg.attachments);
             });
             
             console.log(`Loaded ${data.count} messages from history`);
@@ -156,18 +234,41 @@ function connectWebSocket() {
             // Check if it's a typing event
             if (data.type === 'typing_start' || data.type === 'typing_stop') {
                 handleTypingEvent(data);
+            } else if (data.type === 'error') {
+                addMessage('System', data.error, new Date());
+                if (data.retry_after_ms) {
+                    startSendCountdown(data.retry_after_ms);
+                }
+            } else if (data.type === 'room_updated') {
+                if (data.room.slow_mode_seconds > 0) {
+                    addMessage('System', `Slow mode: one message every ${data.room.slow_mode_seconds}s in #${data.room.name}`, new Date());
+                }
+            } else if (data.type === 'attachment_updated') {
+                updateAttachment(data.attachment);
+            } else if (data.type === 'attachment_scanned') {
+                updatePendingAttachment(data.attachment);
+            } else if (data.type === 'attachment_rejected') {
+                pendingAttachments = pendingAttachments.filter(a => a.id !== data.attachment.id);
+                renderPendingAttachments();
+                addMessage('System', `${data.attachment.filename}: ${data.reason}`, new Date());
+            } else if (data.type === 'message_deleted') {
+                removeMessage(data.message_id);
+            } else if (data.type === 'warning') {
+                addMessage('System', 'Warning from moderators: ' + data.reason, new Date());
+            } else if (data.type === 'report_created') {
+                addMessage('System', `New report on message #${data.message_id}: ${data.reason}`, new Date());
             } else {
                 // Regular message
-                addMessage(data.username, data.content, data.timestamp, data.avatar);
+                addMessage(data.username, data.content, data.timestamp, data.avatar, data.id, data.attachments);
             }
         } catch (error) {
             console.error('Error parsing message:', error);
         }
     };
 
-    ws.onclose = function() {
+    ws.onclose = function(event) {
         console.log('WebSocket disconnected');
-        addMessage('System', 'Disconnected from chat server', new Date());
+        addMessage('System', event.reason || 'Disconnected from chat server', new Date());
     };
 
     ws.onerror = function(error) {
@@ -178,23 +279,232 @@ function connectWebSocket() {
 
 function sendMessage() {
     const message = messageInput.value.trim();
-    if (!message || !ws || ws.readyState !== WebSocket.OPEN) {
+    if ((!message && pendingAttachments.length === 0) || !ws || ws.readyState !== WebSocket.OPEN) {
         return;
     }
 
     const messageData = {
         username: currentUser,
         content: message,
-        timestamp: new Date().toISOString()
+        timestamp: new Date().toISOString(),
+        attachment_ids: pendingAttachments.map(a => a.id)
     };
 
     ws.send(JSON.stringify(messageData));
     messageInput.value = '';
+    pendingAttachments = [];
+    renderPendingAttachments();
+}
+
+async function uploadAttachments() {
+    for (const file of attachmentInput.files) {
+        await uploadAttachment(file, file.name);
+    }
+    attachmentInput.value = '';
+    renderPendingAttachments();
+}
+
+async function uploadAttachment(file, filename, kind = '') {
+    const formData = new FormData();
+    formData.append('file', file, filename);
+    if (kind) {
+        formData.append('kind', kind);
+    }
+
+    try {
+        const response = await fetch('/api/attachments', {
+            method: 'POST',
+            headers: { 'Authorization': `Bearer ${localStorage.getItem('authToken')}` },
+            body: formData,
+        });
+        const data = await response.json();
+        if (response.ok) {
+            pendingAttachments.push(data.attachment);
+        } else {
+            addMessage('System', `${filename}: ${data.error}`, new Date());
+        }
+    } catch (error) {
+        console.error('Upload error:', error);
+    }
 }
 
-function addMessage(username, message, timestamp, avatar = null) {
+// Voice messages are recorded as Opus; the server validates the container and computes the waveform
+let recorder = null;
+async function toggleRecording() {
+    if (recorder) {
+        recorder.stop();
+        return;
+    }
+
+    const mimeType = ['audio/ogg;codecs=opus', 'audio/webm;codecs=opus'].find(type => MediaRecorder.isTypeSupported(type));
+    if (!mimeType) {
+        addMessage('System', 'Voice recording is not supported by this browser', new Date());
+        return;
+    }
+
+    let stream;
+    try {
+        stream = await navigator.mediaDevices.getUserMedia({ audio: true });
+    } catch (error) {
+        addMessage('System', 'Microphone access denied', new Date());
+        return;
+    }
+
+    const chunks = [];
+    recorder = new MediaRecorder(stream, { mimeType });
+    recorder.ondataavailable = (e) => chunks.push(e.data);
+    recorder.onstop = async () => {
+        stream.getTracks().forEach(track => track.stop());
+        recorder = null;
+        recordBtn.classList.remove('btn-danger');
+        const extension = mimeType.startsWith('audio/ogg') ? 'ogg' : 'webm';
+        await uploadAttachment(new Blob(chunks, { type: mimeType }), `voice.${extension}`, 'voice');
+        renderPendingAttachments();
+    };
+    recorder.start();
+    recordBtn.classList.add('btn-danger');
+}
+
+function updatePendingAttachment(attachment) {
+    pendingAttachments = pendingAttachments.map(a => a.id === attachment.id ? attachment : a);
+    renderPendingAttachments();
+}
+
+function renderPendingAttachments() {
+    const scanLabels = { pending: ' (scanning...)', failed: ' (scan failed)' };
+    pendingAttachmentsContainer.textContent = pendingAttachments.length
+        ? 'Attached: ' + pendingAttachments.map(a => a.filename + (scanLabels[a.scan_status] || '')).join(', ')
+        : '';
+}
+
+// Attachments require authorization, so they are fetched and shown through object URLs
+function renderAttachments(container, attachments) {
+    for (const attachment of attachments) {
+        const element = document.createElement('div');
+        element.dataset.attachmentId = attachment.id;
+        container.appendChild(element);
+        renderAttachment(element, attachment);
+    }
+}
+
+// Attachment URLs are signed by the server for the current user, so they work without the auth header
+function renderAttachment(element, attachment) {
+    element.replaceChildren();
+    if (attachment.kind === 'voice') {
+        renderVoice(element, attachment);
+        return;
+    }
+    const preview = attachment.thumbnail_url ||
+        (attachment.content_type.startsWith('image/') ? attachment.url : null);
+    if (preview) {
+        const img = document.createElement('img');
+        img.src = preview;
+        img.alt = attachment.filename;
+        img.className = 'attachment-image';
+        if (attachment.width && attachment.height) {
+            // Same box as the .attachment-image max-width/max-height
+            const scale = Math.min(1, 320 / attachment.width, 240 / attachment.height);
+            img.width = Math.round(attachment.width * scale);
+            img.height = Math.round(attachment.height * scale);
+        }
+        element.appendChild(img);
+        if (attachment.content_type.startsWith('image/')) {
+            return;
+        }
+    }
+
+    const link = document.createElement('a');
+    link.href = attachment.url;
+    link.download = attachment.filename;
+    link.textContent = `${attachment.filename} (${Math.ceil(attachment.size / 1024)} KB)`;
+    link.className = 'attachment-link d-block';
+    element.appendChild(link);
+}
+
+// The waveform and duration come with the message, so the file is only fetched on play
+function renderVoice(element, attachment) {
+    const player = document.createElement('div');
+    player.className = 'voice-message';
+
+    const button = document.createElement('button');
+    button.className = 'btn btn-sm btn-outline-primary';
+    button.textContent = '▶';
+
+    const waveform = document.createElement('div');
+    waveform.className = 'voice-waveform';
+    const bars = (attachment.waveform || []).map(value => {
+        const bar = document.createElement('span');
+        bar.style.height = `${Math.max(value, 8)}%`;
+        waveform.appendChild(bar);
+        return bar;
+    });
+
+    const duration = document.createElement('span');
+    duration.className = 'voice-duration small text-muted';
+    duration.textContent = formatDuration(attachment.duration_ms);
+
+    let audio = null;
+    button.addEventListener('click', () => {
+        if (!audio) {
+            audio = new Audio(attachment.url);
+            audio.addEventListener('timeupdate', () => {
+                const played = audio.currentTime * 1000 / attachment.duration_ms;
+                bars.forEach((bar, i) => bar.classList.toggle('played', i / bars.length < played));
+                duration.textContent = formatDuration(audio.currentTime * 1000);
+            });
+            audio.addEventListener('pause', () => { button.textContent = '▶'; });
+            audio.addEventListener('play', () => { button.textContent = '⏸'; });
+            audio.addEventListener('ended', () => {
+                bars.forEach(bar => bar.classList.remove('played'));
+                duration.textContent = formatDuration(attachment.duration_ms);
+            });
+        }
+        audio.paused ? audio.play() : audio.pause();
+    });
+
+    player.append(button, waveform, duration);
+    element.appendChild(player);
+}
+
+function formatDuration(ms) {
+    const seconds = Math.round((ms || 0) / 1000);
+    return `${Math.floor(seconds / 60)}:${String(seconds % 60).padStart(2, '0')}`;
+}
+
+function updateAttachment(attachment) {
+    const element = messagesContainer.querySelector(`[data-attachment-id="${attachment.id}"]`);
+    if (element) {
+        renderAttachment(element, attachment);
+    }
+}
+
+// Disable the send button until the server-side limit allows the next message
+let sendCountdown = null;
+function startSendCountdown(ms) {
+    clearInterval(sendCountdown);
+    const until = Date.now() + ms;
+    sendBtn.disabled = true;
+
+    const tick = () => {
+        const left = Math.ceil((until - Date.now()) / 1000);
+        if (left <= 0) {
+            clearInterval(sendCountdown);
+            sendBtn.disabled = false;
+            sendBtn.textContent = 'Send';
+            return;
+        }
+        sendBtn.textContent = `Send (${left}s)`;
+    };
+    tick();
+    sendCountdown = setInterval(tick, 250);
+}
+
+function addMessage(username, message, timestamp, avatar = null, id = null, attachments = null) {
     const messageElement = document.createElement('div');
     messageElement.className = 'message';
+    if (id) {
+        messageElement.dataset.messageId = id;
+    }
     
     // Format timestamp
     let timeDisplay = '';
@@ -220,11 +530,11 @@ function addMessage(username, message, timestamp, avatar = null) {
     }
     
     // Default avatar if none provided
-    const avatarUrl = avatar || '/static/images/default_avatar.svg';
+    const avatarUrl = avatar || '/static/images/default-avatar.svg';
     
     messageElement.innerHTML = `
         <div class="message-header">
-            <img src="${avatarUrl}" alt="Avatar" class="user-avatar" onerror="this.src='/static/images/default_avatar.svg'">
+            <img src="${avatarUrl}" alt="Avatar" class="user-avatar" onerror="this.src='/static/images/default-avatar.svg'">
             <div class="message-info">
                 <div class="username">${username}</div>
                 <div class="timestamp">${timeDisplay}</div>
@@ -233,13 +543,63 @@ function addMessage(username, message, timestamp, avatar = null) {
         <div class="content">${message}</div>
     `;
 
+    if (id) {
+        const reportLink = document.createElement('a');
+        reportLink.href = '#';
+        reportLink.className = 'report-link small text-muted';
+        reportLink.textContent = 'Report';
+        reportLink.addEventListener('click', (e) => {
+            e.preventDefault();
+            reportMessage(id);
+        });
+        messageElement.querySelector('.message-info').appendChild(reportLink);
+    }
+
+    if (attachments && attachments.length) {
+        const attachmentsElement = document.createElement('div');
+        attachmentsElement.className = 'attachments';
+        messageElement.appendChild(attachmentsElement);
+        renderAttachments(attachmentsElement, attachments);
+    }
+
     messagesContainer.appendChild(messageElement);
     messagesContainer.scrollTop = messagesContainer.scrollHeight;
 }
 
+function removeMessage(id) {
+    const element = messagesContainer.querySelector(`[data-message-id="${id}"]`);
+    if (element) {
+        element.remove();
+    }
+}
+
+async function reportMessage(id) {
+    const reason = prompt('Why are you reporting this message?');
+    if (!reason) {
+        return;
+    }
+
+    try {
+        const response = await fetch(`/api/messages/${id}/report`, {
+            method: 'POST',
+            headers: {
+                'Authorization': `Bearer ${localStorage.getItem('authToken')}`,
+                'Content-Type': 'application/json',
+            },
+            body: JSON.stringify({ reason }),
+        });
+        const data = await response.json();
+        alert(response.ok ? 'Report submitted. Thank you!' : 'Report failed: ' + data.error);
+    } catch (error) {
+        console.error('Report error:', error);
+    }
+}
+
 async function loadOnlineUsers() {
     try {
-        const response = await fetch('/api/users/online');
+        const response = await fetch('/api/users/online', {
+            headers: { 'Authorization': `Bearer ${localStorage.getItem('authToken')}` },
+        });
         const data = await response.json();
         
         if (response.ok && data.users) {
@@ -264,11 +624,11 @@ function updateOnlineUsersList(users) {
         userElement.className = 'online-user';
         
         // Default avatar if none provided
-        const avatarUrl = user.avatar || '/static/images/default_avatar.svg';
+        const avatarUrl = user.avatar || '/static/images/default-avatar.svg';
         
         userElement.innerHTML = `
             <div class="online-user-info">
-                <img src="${avatarUrl}" alt="Avatar" class="online-user-avatar" onerror="this.src='/static/images/default_avatar.svg'">
+                <img src="${avatarUrl}" alt="Avatar" class="online-user-avatar" onerror="this.src='/static/images/default-avatar.svg'">
                 <span class="status-indicator"></span>
                 <span class="online-username">${user.username}</span>
             </div>
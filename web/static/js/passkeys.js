@@ -0,0 +1,92 @@
+// Passkey (WebAuthn) helpers shared by the chat and profile pages
+
+function base64urlToBuffer(value) {
+    const base64 = value.replace(/-/g, '+').replace(/_/g, '/');
+    const padded = base64 + '='.repeat((4 - base64.length % 4) % 4);
+    return Uint8Array.from(atob(padded), c => c.charCodeAt(0)).buffer;
+}
+
+function bufferToBase64url(buffer) {
+    const bytes = new Uint8Array(buffer);
+    let binary = '';
+    bytes.forEach(b => binary += String.fromCharCode(b));
+    return btoa(binary).replace(/\+/g, '-').replace(/\//g, '_').replace(/=+$/, '');
+}
+
+function passkeysSupported() {
+    return !!(window.PublicKeyCredential && navigator.credentials);
+}
+
+// Run the registration ceremony for the logged in user
+async function registerPasskey(authToken, name) {
+    const headers = { 'Authorization': `Bearer ${authToken}` };
+
+    const beginResponse = await fetch('/api/profile/passkeys/register/begin', { method: 'POST', headers });
+    const options = await beginResponse.json();
+    if (!beginResponse.ok) {
+        throw new Error(options.error || 'Failed to start passkey registration');
+    }
+
+    const publicKey = options.publicKey;
+    publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+    publicKey.user.id = base64urlToBuffer(publicKey.user.id);
+    (publicKey.excludeCredentials || []).forEach(c => c.id = base64urlToBuffer(c.id));
+
+    const credential = await navigator.credentials.create({ publicKey });
+
+    const finishResponse = await fetch(`/api/profile/passkeys/register/finish?name=${encodeURIComponent(name)}`, {
+        method: 'POST',
+        headers: { ...headers, 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+            id: credential.id,
+            rawId: bufferToBase64url(credential.rawId),
+            type: credential.type,
+            response: {
+                clientDataJSON: bufferToBase64url(credential.response.clientDataJSON),
+                attestationObject: bufferToBase64url(credential.response.attestationObject),
+                transports: credential.response.getTransports ? credential.response.getTransports() : []
+            }
+        })
+    });
+    const result = await finishResponse.json();
+    if (!finishResponse.ok) {
+        throw new Error(result.error || 'Passkey registration failed');
+    }
+    return result.passkey;
+}
+
+// Run the assertion ceremony and return the same payload as /api/login
+async function loginWithPasskey() {
+    const beginResponse = await fetch('/api/auth/passkey/login/begin', { method: 'POST' });
+    const options = await beginResponse.json();
+    if (!beginResponse.ok) {
+        throw new Error(options.error || 'Failed to start passkey login');
+    }
+
+    const publicKey = options.publicKey;
+    publicKey.challenge = base64urlToBuffer(publicKey.challenge);
+    (publicKey.allowCredentials || []).forEach(c => c.id = base64urlToBuffer(c.id));
+
+    const assertion = await navigator.credentials.get({ publicKey });
+
+    const finishResponse = await fetch('/api/auth/passkey/login/finish', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({
+            id: assertion.id,
+            rawId: bufferToBase64url(assertion.rawId),
+            type: assertion.type,
+            response: {
+                clientDataJSON: bufferToBase64url(assertion.response.clientDataJSON),
+                authenticatorData: bufferToBase64url(assertion.response.authenticatorData),
+                signature: bufferToBase64url(assertion.response.signature),
+                userHandle: assertion.response.userHandle ? bufferToBase64url(assertion.response.userHandle) : null
+            }
+        })
+    });
+    const result = await finishResponse.json();
+    if (!finishResponse.ok) {
+        throw new Error(result.error || 'Passkey login failed');
+    }
+    return result;
+}
@@ -28,6 +28,10 @@ document.addEventListener('DOMContentLoaded', function() {
     });
     document.getElementById('avatarFile').addEventListener('change', handleAvatarFileSelect);
     document.getElementById('uploadAvatarBtn').addEventListener('click', uploadAvatar);
+
+    // Passkey management
+    document.getElementById('addPasskeyBtn').addEventListener('click', addPasskey);
+    loadPasskeys();
 });
 
 // Load user profile data
@@ -75,7 +79,7 @@ function updateAvatarPreview(avatarUrl = null) {
     if (avatarUrl) {
         avatarImg.src = avatarUrl;
     } else {
-        avatarImg.src = '/static/images/default_avatar.svg';
+        avatarImg.src = '/static/images/default-avatar.svg';
     }
 }
 
@@ -261,4 +265,107 @@ async function uploadAvatar() {
         console.error('Error uploading avatar:', error);
         showMessage('Ошибка загрузки аватара', 'error');
     }
-} 
\ No newline at end of file
+} 
+// Load registered passkeys
+async function loadPasskeys() {
+    try {
+        const response = await fetch('/api/profile/passkeys', {
+            headers: { 'Authorization': `Bearer ${authToken}` }
+        });
+        const data = await response.json();
+        if (!response.ok) {
+            return;
+        }
+
+        const list = document.getElementById('passkeyList');
+        list.innerHTML = '';
+        if (data.passkeys.length === 0) {
+            list.innerHTML = '<li class="list-group-item text-muted">Нет ключей доступа</li>';
+            return;
+        }
+
+        data.passkeys.forEach(passkey => {
+            const item = document.createElement('li');
+            item.className = 'list-group-item d-flex justify-content-between align-items-center';
+
+            const lastUsed = passkey.last_used_at ? new Date(passkey.last_used_at).toLocaleString('ru-RU') : 'не использовался';
+            const label = document.createElement('span');
+            label.textContent = `${passkey.name} (${lastUsed})`;
+
+            const actions = document.createElement('div');
+            const renameBtn = document.createElement('button');
+            renameBtn.className = 'btn btn-sm btn-outline-secondary me-2';
+            renameBtn.textContent = 'Переименовать';
+            renameBtn.addEventListener('click', () => renamePasskey(passkey));
+            const deleteBtn = document.createElement('button');
+            deleteBtn.className = 'btn btn-sm btn-outline-danger';
+            deleteBtn.textContent = 'Удалить';
+            deleteBtn.addEventListener('click', () => deletePasskey(passkey));
+            actions.append(renameBtn, deleteBtn);
+
+            item.append(label, actions);
+            list.appendChild(item);
+        });
+    } catch (error) {
+        console.error('Error loading passkeys:', error);
+    }
+}
+
+// Register a new passkey on this device
+async function addPasskey() {
+    if (!passkeysSupported()) {
+        showMessage('Браузер не поддерживает ключи доступа', 'error');
+        return;
+    }
+
+    try {
+        const name = document.getElementById('passkeyName').value.trim();
+        await registerPasskey(authToken, name);
+        document.getElementById('passkeyName').value = '';
+        showMessage('Ключ доступа добавлен', 'success');
+        loadPasskeys();
+    } catch (error) {
+        console.error('Error registering passkey:', error);
+        showMessage(error.message || 'Ошибка добавления ключа доступа', 'error');
+    }
+}
+
+async function renamePasskey(passkey) {
+    const name = prompt('Новое название ключа', passkey.name);
+    if (!name) {
+        return;
+    }
+
+    const response = await fetch(`/api/profile/passkeys/${passkey.id}`, {
+        method: 'PUT',
+        headers: {
+            'Authorization': `Bearer ${authToken}`,
+            'Content-Type': 'application/json'
+        },
+        body: JSON.stringify({ name })
+    });
+    if (response.ok) {
+        loadPasskeys();
+    } else {
+        const error = await response.json();
+        showMessage(error.error || 'Ошибка переименования ключа', 'error');
+    }
+}
+
+async function deletePasskey(passkey) {
+    if (!confirm(`Удалить ключ доступа "${passkey.name}"?`)) {
+        return;
+    }
+
+    const response = await fetch(`/api/profile/passkeys/${passkey.id}`, {
+        method: 'DELETE',
+        headers: { 'Authorization': `Bearer ${authToken}` }
+    });
+    if (response.ok) {
+        showMessage('Ключ доступа удален', 'success');
+        loadPasskeys();
+    } else {
+        const error = await response.json();
+        showMessage(error.error || 'Ошибка удаления ключа', 'error');
+    }
+}